@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/wisepythagoras/gis-utils/gis"
+)
+
+func main() {
+	pbfPtr := flag.String("pbf", "", "The path to the OSM data file that you need to clip")
+	outputPtr := flag.String("output", "", "The output path of the .osm.pbf")
+	bboxPtr := flag.String("bbox", "", "The area to clip (min Lon,min Lat,max Lon,max Lat, lat,lon,radius, z/x/y, a file or a place name)")
+	gazetteerPtr := flag.String("gazetteer", "", "A CSV file of place names and their bounding boxes")
+	polyPtr := flag.String("poly", "", "An Osmosis .poly file with the polygon of the area to clip")
+	geojsonPtr := flag.String("geojson", "", "A GeoJSON file with the polygon of the area to clip")
+	completeRelationsPtr := flag.Bool("complete-relations", false, "Whether to include all of the members of relations")
+	logLevelPtr := flag.String("log-level", "info", "The lowest level of the messages that are logged to stderr (debug, info, warn or error)")
+	logFormatPtr := flag.String("log-format", "text", "The format of the messages that are logged (text or json)")
+	flag.Parse()
+
+	if len(*pbfPtr) == 0 {
+		fmt.Println("A path to an OSM data file is required (use -pbf path/to/file.osm.pbf).")
+		os.Exit(1)
+	}
+
+	var area gis.Area
+	var gazetteer gis.Gazetteer
+	var err error
+
+	if len(*gazetteerPtr) > 0 {
+		if gazetteer, err = gis.ReadGazetteerFile(*gazetteerPtr); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(*polyPtr) > 0 {
+		area, err = gis.ReadPolyFile(*polyPtr)
+	} else if len(*geojsonPtr) > 0 {
+		area, err = gis.ReadGeoJSONPolygonFile(*geojsonPtr)
+	} else if len(*bboxPtr) > 0 {
+		area, err = gis.ParseBBox(*bboxPtr, gazetteer)
+	} else {
+		err = errors.New("an area is required (use -bbox, -poly or -geojson)")
+	}
+
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	outputPath := *outputPtr
+
+	// Construct a default filename for the output, in case one was not passed.
+	if len(outputPath) == 0 {
+		_, filename := path.Split(*pbfPtr)
+		filename = strings.SplitN(filename, ".", 2)[0]
+		outputPath = fmt.Sprintf("%s_clipped.osm.pbf", filename)
+	}
+
+	logger, err := gis.NewLogger(os.Stderr, *logLevelPtr, *logFormatPtr)
+
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	pbf := &gis.PBF{Logger: logger}
+	pbf.Init()
+
+	if err := pbf.LoadFile(*pbfPtr); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	data := pbf.Extract(area, *completeRelationsPtr)
+
+	fmt.Printf("%d nodes, %d ways and %d relations found within the area.\n", len(data.Nodes), len(data.Ways), len(data.Relations))
+
+	f, err := os.Create(outputPath)
+
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	defer f.Close()
+
+	if err := gis.WritePBF(f, data); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("The clipped data was saved as %s\n", outputPath)
+}
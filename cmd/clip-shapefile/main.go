@@ -1,57 +1,22 @@
 package main
 
 import (
-	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
 
 	"github.com/wisepythagoras/gis-utils/gis"
 )
 
-func parseBBox(bboxStr string) (*gis.BBox, error) {
-	parts := strings.Split(bboxStr, ",")
-
-	if len(parts) < 4 {
-		return nil, errors.New("invalid bounding box")
-	}
-
-	bbox := &gis.BBox{}
-
-	for i, part := range parts {
-		part = strings.TrimSpace(part)
-		coord, err := strconv.ParseFloat(part, 64)
-
-		if err != nil {
-			return nil, err
-		}
-
-		if i == 0 {
-			bbox.NE.Lon = coord
-		} else if i == 1 {
-			bbox.NE.Lat = coord
-		} else if i == 2 {
-			bbox.SW.Lon = coord
-		} else if i == 3 {
-			bbox.SW.Lat = coord
-		}
-	}
-
-	if bbox.NE.Lon < bbox.SW.Lon || bbox.NE.Lat < bbox.SW.Lat {
-		return nil, errors.New("the ordering of the bounding box coordinates is invalid")
-	}
-
-	return bbox, nil
-}
-
 func main() {
 	shapefilePtr := flag.String("shapefile", "", "The path to the shapefile that you need to clip")
 	outputPtr := flag.String("output", "", "The output path")
-	bboxPtr := flag.String("bbox", "", "The bounding box of the area to clip (NE Lon,NE Lat,SW Lon,SW Lat")
+	bboxPtr := flag.String("bbox", "", "The area to clip (min Lon,min Lat,max Lon,max Lat, lat,lon,radius, z/x/y, a file or a place name)")
+	gazetteerPtr := flag.String("gazetteer", "", "A CSV file of place names and their bounding boxes")
+	polyPtr := flag.String("poly", "", "A polygon (.poly or GeoJSON file) of the area to clip")
 	flag.Parse()
 
 	if len(*shapefilePtr) == 0 {
@@ -59,14 +24,32 @@ func main() {
 		os.Exit(1)
 	}
 
-	bbox, err := parseBBox(*bboxPtr)
+	var area gis.Area
+	var gazetteer gis.Gazetteer
+	var err error
+	areaName := strings.ReplaceAll(*bboxPtr, "/", "-")
+
+	if len(*gazetteerPtr) > 0 {
+		if gazetteer, err = gis.ReadGazetteerFile(*gazetteerPtr); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(*polyPtr) > 0 {
+		area, err = gis.ReadAreaFile(*polyPtr)
+		_, areaName = path.Split(*polyPtr)
+		areaName = strings.TrimSuffix(areaName, filepath.Ext(areaName))
+	} else {
+		area, err = gis.ParseBBox(*bboxPtr, gazetteer)
+	}
 
 	if err != nil {
 		fmt.Println("Error:", err)
 		os.Exit(1)
 	}
 
-	geojson, _ := bbox.ToGeoJSONStr()
+	geojson, _ := area.Bounds().ToGeoJSONStr()
 	fmt.Println(string(geojson))
 	outputPath := *outputPtr
 
@@ -74,12 +57,12 @@ func main() {
 	if len(outputPath) == 0 {
 		_, filename := path.Split(*shapefilePtr)
 		filename = strings.TrimSuffix(filename, filepath.Ext(filename))
-		outputPath = fmt.Sprintf("%s_%s.shp", filename, *bboxPtr)
+		outputPath = fmt.Sprintf("%s_%s.shp", filename, areaName)
 	}
 
 	shapefile := &gis.Shapefile{Filename: *shapefilePtr}
 	shapefile.Load()
-	features, err := shapefile.Clip(bbox)
+	features, err := shapefile.Clip(area)
 
 	fmt.Println(len(features), "features found within the bounding box.")
 
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"strings"
@@ -14,8 +16,8 @@ import (
 	"github.com/wroge/wgs84"
 )
 
-func indexShapefile(tx *buntdb.Tx, shapefile *gis.Shapefile) error {
-	return shapefile.Iter(func(i int, p *shp.Polygon) error {
+func indexShapefile(ctx context.Context, tx *buntdb.Tx, shapefile *gis.Shapefile) error {
+	return shapefile.IterContext(ctx, func(i int, p *shp.Polygon) error {
 		points := ""
 
 		for j, point := range p.Points {
@@ -44,8 +46,13 @@ func indexShapefile(tx *buntdb.Tx, shapefile *gis.Shapefile) error {
 	})
 }
 
-func indexPbf(tx *buntdb.Tx, pbf *gis.PBF) error {
+func indexPbf(ctx context.Context, tx *buntdb.Tx, pbf *gis.PBF) error {
 	for _, way := range pbf.Ways() {
+		// Returning the error rolls the transaction back, so nothing is saved when it's interrupted.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		points := ""
 
 		for _, ring := range way.Points {
@@ -76,7 +83,9 @@ func indexPbf(tx *buntdb.Tx, pbf *gis.PBF) error {
 
 func main() {
 	shapefilePtr := flag.String("shapefile", "", "The path to the land shapefile")
-	pbfPtr := flag.String("pbf", "", "The path to the land PBF")
+	pbfPtr := flag.String("pbf", "", "The path to the land PBF (or .osm, .osm.bz2, .osm.gz)")
+	logLevelPtr := flag.String("log-level", "info", "The lowest level of the messages that are logged to stderr (debug, info, warn or error)")
+	logFormatPtr := flag.String("log-format", "text", "The format of the messages that are logged (text or json)")
 	flag.Parse()
 
 	if len(*shapefilePtr) == 0 && len(*pbfPtr) == 0 {
@@ -84,6 +93,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	logger, err := gis.NewLogger(os.Stderr, *logLevelPtr, *logFormatPtr)
+
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	var shapefile *gis.Shapefile
 	var pbf *gis.PBF
 
@@ -94,18 +113,10 @@ func main() {
 			panic(err)
 		}
 	} else {
-		pbf = &gis.PBF{}
+		pbf = &gis.PBF{Logger: logger}
 		pbf.Init()
 
-		f, err := os.Open(*pbfPtr)
-
-		if err != nil {
-			panic(err)
-		}
-
-		defer f.Close()
-
-		if err := pbf.Load(f); err != nil {
+		if err := pbf.LoadFileContext(ctx, *pbfPtr); err != nil {
 			panic(err)
 		}
 	}
@@ -135,9 +146,9 @@ func main() {
 		fmt.Println("Saving indecies.")
 
 		if shapefile != nil {
-			err = indexShapefile(tx, shapefile)
+			err = indexShapefile(ctx, tx, shapefile)
 		} else if pbf != nil {
-			err = indexPbf(tx, pbf)
+			err = indexPbf(ctx, tx, pbf)
 		}
 
 		fmt.Println("Interrated over all features.")
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/wisepythagoras/gis-utils/config"
+	"github.com/wisepythagoras/gis-utils/gis"
+)
+
+func main() {
+	stylesPtr := flag.String("styles", "", "A comma separated list of style configuration files to check")
+	strictPtr := flag.Bool("strict", false, "Whether warnings should fail the check too")
+	logLevelPtr := flag.String("log-level", "info", "The lowest level of the messages that are logged to stderr (debug, info, warn or error)")
+	logFormatPtr := flag.String("log-format", "text", "The format of the messages that are logged (text or json)")
+	flag.Parse()
+
+	if len(*stylesPtr) == 0 {
+		fmt.Println("A style configuration file is required (use -styles path/to/styles.yaml).")
+		os.Exit(1)
+	}
+
+	logger, err := gis.NewLogger(os.Stderr, *logLevelPtr, *logFormatPtr)
+
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	failed := false
+
+	for _, filename := range strings.Split(*stylesPtr, ",") {
+		filename = strings.TrimSpace(filename)
+		conf := &config.Config{Logger: logger}
+
+		if err := conf.ParseFile(filename); err != nil {
+			fmt.Printf("%s: error: %s\n", filename, err)
+			failed = true
+			continue
+		}
+
+		for _, problem := range conf.Validate() {
+			fmt.Printf("%s: %s\n", filename, problem)
+
+			if !problem.Warning || *strictPtr {
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
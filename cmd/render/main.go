@@ -1,83 +1,365 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 
-	"github.com/tdewolff/canvas"
 	"github.com/wisepythagoras/gis-utils/config"
 	"github.com/wisepythagoras/gis-utils/gis"
 )
 
+// loadShapefile starts loading the land shapefile in the background, so that it's read at the same
+// time as the OSM data, and returns a function that waits for it.
+func loadShapefile(filename string, progress gis.Progress) func() (*gis.Shapefile, error) {
+	shapefile := &gis.Shapefile{Filename: filename, Progress: progress}
+	loaded := make(chan struct{})
+	var err error
+
+	go func() {
+		err = shapefile.Load()
+		close(loaded)
+	}()
+
+	return func() (*gis.Shapefile, error) {
+		<-loaded
+		return shapefile, err
+	}
+}
+
+func loadLandPolygons(ctx context.Context, waitForShapefile func() (*gis.Shapefile, error), area gis.Area) ([]*gis.ShapePolygon, error) {
+	shapefile, err := waitForShapefile()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer shapefile.Close()
+
+	return shapefile.ClipContext(ctx, area)
+}
+
+// progressPrinter prints the percentage of every stage that's done, on the same line until the
+// stage changes. The shapefile is loaded on another goroutine, so the calls are serialised.
+type progressPrinter struct {
+	line  string
+	mutex sync.Mutex
+}
+
+func (p *progressPrinter) print(line string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if line == p.line {
+		return
+	}
+
+	if len(p.line) > 0 && !strings.HasPrefix(line, strings.SplitN(p.line, ":", 2)[0]+":") {
+		fmt.Println()
+	}
+
+	fmt.Printf("\r%s", line)
+	p.line = line
+}
+
+func (p *progressPrinter) BytesRead(read, total int64) {
+	if total > 0 {
+		p.print(fmt.Sprintf("Reading the OSM data: %d%%", read*100/total))
+	}
+}
+
+// FeaturesProcessed skips the stages without a total, like the objects while the OSM data is read,
+// since the bytes read already show how far those have got.
+func (p *progressPrinter) FeaturesProcessed(stage string, done, total int) {
+	if total > 0 {
+		p.print(fmt.Sprintf("Processing the %s: %d%%", stage, done*100/total))
+	}
+}
+
+// done ends the line of the last stage.
+func (p *progressPrinter) done() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.line) > 0 {
+		fmt.Println()
+		p.line = ""
+	}
+}
+
+// exitOnError prints the error and exits, which is how cancelling or timing out ends the command.
+func exitOnError(err error, printer *progressPrinter) {
+	if err != nil {
+		printer.done()
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
+
 func main() {
 	shapefilePtr := flag.String("shapefile", "", "The path to the land shapefile")
-	outputPtr := flag.String("output", "out.png", "The output path")
-	pbfPtr := flag.String("pbf", "", "The path to the OSM Protobuf file")
+	outputPtr := flag.String("output", "out.png", "The output path (.png, .jpg, .webp, .tif, .svg or .pdf)")
+	pbfPtr := flag.String("pbf", "", "The path to the OSM data file (.osm.pbf, .osm, .osm.bz2 or .osm.gz)")
+	changesPtr := flag.String("changes", "", "A comma separated list of change files (.osc, .osc.gz or .osc.bz2) to apply")
 	stylesPtr := flag.String("styles", "", "The path to the style configuration file")
-	widthPtr := flag.Float64("width", 320, "The width of the output image")
-	verbosePtr := flag.Bool("verbose", false, "Whether to print debug information or not")
+	bboxPtr := flag.String("bbox", "", "The area to render, instead of the bounds of the data (min Lon,min Lat,max Lon,max Lat, lat,lon,radius, z/x/y, a file or a place name)")
+	gazetteerPtr := flag.String("gazetteer", "", "A CSV file of place names and their bounding boxes")
+	polyPtr := flag.String("poly", "", "A polygon (.poly or GeoJSON file) to limit the rendered area to")
+	centerPtr := flag.String("center", "", "The center of the area to render (lat,lon), used along with -zoom")
+	zoomPtr := flag.Float64("zoom", -1, "The zoom level of the area around -center, as on a 96 DPI screen")
+	widthPtr := flag.Float64("width", 320, "The width of the output image in millimetres")
+	heightPtr := flag.Float64("height", 0, "The height of the output image in millimetres (computed from the area if it's 0)")
+	sizePtr := flag.String("size", "", "The size of the output image in pixels (e.g. 1920x1080), instead of -width and -height")
+	paperPtr := flag.String("paper", "", "A paper size (A0-A5, Letter, Legal or Tabloid), instead of -width and -height")
+	landscapePtr := flag.Bool("landscape", false, "Whether to use the paper in landscape orientation")
+	dpiPtr := flag.Float64("dpi", 600, "The resolution of the raster outputs")
+	qualityPtr := flag.Int("quality", gis.DefaultQuality, "The quality of JPEG and WebP outputs (1-100)")
+	losslessPtr := flag.Bool("lossless", false, "Whether to write WebP outputs losslessly")
+	marginPtr := flag.Float64("margin", 0, "The margin around the map in millimetres")
+	projectionPtr := flag.String("projection", "", "The projection of the map, as an EPSG code (e.g. EPSG:32635) or a UTM zone (e.g. UTM35N), instead of Web Mercator")
+	atlasPtr := flag.String("atlas", "", "Split the area into a PDF atlas with a grid of pages (e.g. 3x2, or 3 to fit the rows to the page)")
+	overlapPtr := flag.Float64("overlap", 0.1, "The fraction of each atlas page that overlaps its neighbours")
+	verbosePtr := flag.Bool("verbose", false, "Whether to print the problems of the styles, and log at the debug level")
+	debugStylesPtr := flag.Bool("debug-styles", false, "Whether to log which styles every feature matched, and why, at the debug level")
+	workersPtr := flag.Int("workers", 0, "The number of goroutines that the features are prepared on (one for every CPU if it's 0)")
+	progressPtr := flag.Bool("progress", false, "Whether to print how much of the data has been loaded and of the map has been drawn")
+	logLevelPtr := flag.String("log-level", "info", "The lowest level of the messages that are logged to stderr (debug, info, warn or error)")
+	logFormatPtr := flag.String("log-format", "text", "The format of the messages that are logged (text or json)")
+	timeoutPtr := flag.Duration("timeout", 0, "How long to give up rendering after (e.g. 30s, or no limit if it's 0)")
 	flag.Parse()
 
+	if *verbosePtr || *debugStylesPtr {
+		*logLevelPtr = "debug"
+	}
+
+	logger, err := gis.NewLogger(os.Stderr, *logLevelPtr, *logFormatPtr)
+
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *timeoutPtr > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeoutPtr)
+		defer cancel()
+	}
+
+	var progress gis.Progress
+	printer := &progressPrinter{}
+
+	if *progressPtr {
+		progress = printer
+	}
+
 	if len(*shapefilePtr) == 0 {
 		fmt.Println("A path to a shapefile is required (use -shapefile path/to/land.shp).")
 		os.Exit(1)
 	} else if len(*pbfPtr) == 0 {
-		fmt.Println("A path to a *.pbf is required (use -pbf path/to/file.pbf).")
+		fmt.Println("A path to an OSM data file is required (use -pbf path/to/file.pbf).")
 		os.Exit(1)
 	} else if len(*stylesPtr) == 0 {
 		fmt.Println("A style configuration file is required (use -styles path/to/styles.yaml).")
 		os.Exit(1)
 	}
 
-	conf := &config.Config{UseMap: true}
-	err := conf.ParseFile(*stylesPtr)
+	width, height := *widthPtr, *heightPtr
+
+	if len(*paperPtr) > 0 {
+		width, height, err = gis.PaperSize(*paperPtr, *landscapePtr)
+	} else if len(*sizePtr) > 0 {
+		var widthPx, heightPx float64
+
+		if _, err = fmt.Sscanf(*sizePtr, "%fx%f", &widthPx, &heightPx); err == nil {
+			width = gis.PixelsToMM(widthPx, *dpiPtr)
+			height = gis.PixelsToMM(heightPx, *dpiPtr)
+		}
+	}
 
 	if err != nil {
 		panic(err)
 	}
 
-	f, err := os.Open(*pbfPtr)
+	projection, err := gis.ParseProjection(*projectionPtr)
 
 	if err != nil {
 		panic(err)
 	}
 
-	defer f.Close()
+	// The format of the output is checked before anything is loaded, since WebP needs a build with cgo.
+	// Atlases are always PDFs.
+	var format gis.ImageFormat
 
-	pbf := &gis.PBF{Verbose: *verbosePtr}
-	pbf.Init()
+	if len(*atlasPtr) == 0 {
+		format, err = gis.ImageFormatFromFilename(*outputPtr)
+
+		if err == nil && *losslessPtr && format == gis.FormatWebP {
+			format = gis.FormatWebPLossless
+		}
+
+		if err == nil {
+			err = format.Available()
+		}
+
+		exitOnError(err, printer)
+	}
 
-	if err := pbf.Load(f); err != nil {
+	waitForShapefile := loadShapefile(*shapefilePtr, progress)
+	conf := &config.Config{UseMap: true, Debug: *debugStylesPtr, Logger: logger}
+	err = conf.ParseFile(*stylesPtr)
+
+	if err != nil {
 		panic(err)
 	}
 
+	if *verbosePtr {
+		for _, problem := range conf.Validate() {
+			fmt.Println(problem)
+		}
+	}
+
+	pbf := &gis.PBF{Logger: logger, Progress: progress}
+	pbf.Init()
+	exitOnError(pbf.LoadFileContext(ctx, *pbfPtr), printer)
+
+	if len(*changesPtr) > 0 {
+		for _, changeFile := range strings.Split(*changesPtr, ",") {
+			if err := pbf.ApplyChangeFile(strings.TrimSpace(changeFile)); err != nil {
+				panic(err)
+			}
+		}
+	}
+
 	ways := pbf.Ways()
 	relations := pbf.Relations()
-	// TODO: Add a bbox override for custom bbox from input.
 	bbox := pbf.BBox()
 
-	shapefile := &gis.Shapefile{Filename: *shapefilePtr}
+	if len(*bboxPtr) > 0 {
+		var gazetteer gis.Gazetteer
 
-	err = shapefile.Load()
+		if len(*gazetteerPtr) > 0 {
+			if gazetteer, err = gis.ReadGazetteerFile(*gazetteerPtr); err != nil {
+				panic(err)
+			}
+		}
 
-	if err != nil {
-		panic(err)
+		if bbox, err = gis.ParseBBox(*bboxPtr, gazetteer); err != nil {
+			panic(err)
+		}
 	}
 
-	polygons, err := shapefile.Clip(bbox)
+	if len(*centerPtr) > 0 && *zoomPtr >= 0 {
+		var center gis.Point
 
-	if err != nil {
-		panic(err)
+		if _, err = fmt.Sscanf(*centerPtr, "%f,%f", &center.Lat, &center.Lon); err != nil {
+			panic(err)
+		}
+
+		// Without a height, the map is square.
+		mapHeight := height
+
+		if mapHeight <= 0 {
+			mapHeight = width
+		}
+
+		// The zoom levels are defined for screens, so convert the size of the map to 96 DPI pixels.
+		widthPx := (width - 2*(*marginPtr)) / 25.4 * 96
+		heightPx := (mapHeight - 2*(*marginPtr)) / 25.4 * 96
+		bbox = gis.BBoxFromCenter(center, *zoomPtr, widthPx, heightPx)
+	}
+
+	var area gis.Area = bbox
+
+	if len(*polyPtr) > 0 {
+		poly, err := gis.ReadAreaFile(*polyPtr)
+
+		if err != nil {
+			panic(err)
+		}
+
+		area = poly
+		bbox = poly.Bounds()
+		ways = gis.FilterWays(ways, area)
+		relations = gis.FilterWays(relations, area)
+	}
+
+	if len(*atlasPtr) > 0 {
+		atlas := &gis.Atlas{
+			BBox:       bbox,
+			Overlap:    *overlapPtr,
+			PageWidth:  width,
+			PageHeight: height,
+			Margin:     *marginPtr,
+			Projection: projection,
+			Config:     conf,
+		}
+
+		if _, err := fmt.Sscanf(*atlasPtr, "%dx%d", &atlas.Columns, &atlas.Rows); err != nil && atlas.Columns == 0 {
+			panic(err)
+		}
+
+		if atlas.PageHeight <= 0 {
+			fmt.Println("An atlas needs a page height (use -paper or -height).")
+			os.Exit(1)
+		}
+
+		polygons, err := loadLandPolygons(ctx, waitForShapefile, area)
+		exitOnError(err, printer)
+
+		f, err := os.Create(*outputPtr)
+
+		if err != nil {
+			panic(err)
+		}
+
+		defer f.Close()
+
+		err = atlas.WritePDF(f, func(image *gis.Image) error {
+			image.Workers = *workersPtr
+			image.Progress = progress
+
+			if err := image.DrawShapePolygonsContext(ctx, polygons); err != nil {
+				return err
+			}
+
+			if err := image.DrawWaysContext(ctx, ways); err != nil {
+				return err
+			}
+
+			if err := image.DrawWaysContext(ctx, relations); err != nil {
+				return err
+			}
+
+			image.DrawGrids()
+			image.DrawFurniture()
+			return nil
+		})
+
+		printer.done()
+		exitOnError(err, printer)
+		return
 	}
 
 	image := &gis.Image{
-		BBox:   bbox,
-		Width:  *widthPtr,
-		Config: conf,
+		BBox:       bbox,
+		Width:      width,
+		Height:     height,
+		Margin:     *marginPtr,
+		DPI:        *dpiPtr,
+		Projection: projection,
+		Config:     conf,
+		Workers:    *workersPtr,
+		Progress:   progress,
 	}
+
 	err = image.Init()
 
 	if err != nil {
@@ -85,10 +367,30 @@ func main() {
 		return
 	}
 
-	image.DrawShapePolygons(polygons)
-	image.DrawWays(ways)
-	image.DrawWays(relations)
-	image.PNG(*outputPtr, canvas.DPI(600))
+	// The image may have grown the bounding box to fill the page, so the land polygons are clipped
+	// with the final one.
+	if len(*polyPtr) == 0 {
+		area = image.BBox
+	}
+
+	polygons, err := loadLandPolygons(ctx, waitForShapefile, area)
+	exitOnError(err, printer)
+	exitOnError(image.DrawShapePolygonsContext(ctx, polygons), printer)
+	exitOnError(image.DrawWaysContext(ctx, ways), printer)
+	exitOnError(image.DrawWaysContext(ctx, relations), printer)
+	printer.done()
+	image.DrawGrids()
+	image.DrawFurniture()
+
+	if format != gis.FormatPNG {
+		if err := image.WriteFile(*outputPtr, format, *qualityPtr); err != nil {
+			panic(err)
+		}
+
+		return
+	}
+
+	image.PNG(*outputPtr, image.Resolution())
 
 	filename := strings.TrimSuffix(*outputPtr, filepath.Ext(*outputPtr))
 	image.SVG(fmt.Sprintf("%s.svg", filename))
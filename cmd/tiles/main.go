@@ -1,13 +1,114 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log/slog"
 	"math"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/paulmach/orb/maptile"
+	"github.com/wisepythagoras/gis-utils/config"
 	"github.com/wisepythagoras/gis-utils/gis"
 )
 
+// layer is a set of styles that the tiles are rendered with, in its own directory and format.
+type layer struct {
+	name    string
+	config  *config.Config
+	format  gis.ImageFormat
+	quality int
+}
+
+// loadLayers reads each style file as a layer, which is named after the file. The format and the
+// quality in the style file take precedence over the default ones.
+func loadLayers(filenames []string, defaultFormat gis.ImageFormat, defaultQuality int, logger *slog.Logger) ([]*layer, error) {
+	layers := make([]*layer, 0, len(filenames))
+
+	for _, filename := range filenames {
+		filename = strings.TrimSpace(filename)
+		conf := &config.Config{UseMap: true, Logger: logger}
+
+		if err := conf.ParseFile(filename); err != nil {
+			return nil, err
+		}
+
+		l := &layer{
+			name:    strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)),
+			config:  conf,
+			format:  defaultFormat,
+			quality: defaultQuality,
+		}
+
+		if len(conf.GetFormat()) > 0 {
+			format, err := gis.ParseImageFormat(conf.GetFormat())
+
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filename, err)
+			}
+
+			l.format = format
+		}
+
+		if err := l.format.Available(); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+
+		if conf.GetQuality() > 0 {
+			l.quality = conf.GetQuality()
+		}
+
+		layers = append(layers, l)
+	}
+
+	return layers, nil
+}
+
+// renderTile renders the tile in every layer, into dir/layer/z/x/y.ext. The shapefile is optional,
+// and has to have been read into memory, so that it's clipped to every tile without reading it again.
+func renderTile(tile gis.Tile, layers []*layer, pbf *gis.PBF, shapefile *gis.Shapefile, dir string) error {
+	var polygons []*gis.ShapePolygon
+
+	if shapefile != nil {
+		var err error
+
+		if polygons, err = shapefile.Clip(tile.BBox()); err != nil {
+			return err
+		}
+	}
+
+	ways := gis.FilterWays(pbf.Ways(), tile.BBox())
+	relations := gis.FilterWays(pbf.Relations(), tile.BBox())
+
+	for _, l := range layers {
+		image, err := tile.NewImage(l.config)
+
+		if err != nil {
+			return err
+		}
+
+		image.DrawShapePolygons(polygons)
+		image.DrawWays(ways)
+		image.DrawWays(relations)
+
+		tileDir := filepath.Join(dir, l.name, fmt.Sprint(tile.Z), fmt.Sprint(tile.X))
+
+		if err := os.MkdirAll(tileDir, 0755); err != nil {
+			return err
+		}
+
+		filename := filepath.Join(tileDir, fmt.Sprintf("%d.%s", tile.Y, l.format.Extension()))
+
+		if err := image.WriteFile(filename, l.format, l.quality); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func deg2rad(d float64) float64 {
 	return d * math.Pi / 180.0
 }
@@ -21,6 +122,112 @@ func getTileURL(lat, lon float64, zoom int) (int, float64, float64) {
 }
 
 func main() {
+	polyPtr := flag.String("poly", "", "A polygon (.poly or GeoJSON file) to list the tiles of")
+	bboxPtr := flag.String("bbox", "", "An area to list the tiles of (min Lon,min Lat,max Lon,max Lat, lat,lon,radius, z/x/y, a file or a place name)")
+	gazetteerPtr := flag.String("gazetteer", "", "A CSV file of place names and their bounding boxes")
+	zoomPtr := flag.Uint("zoom", 10, "The zoom level of the tiles")
+	renderPtr := flag.String("render", "", "Render the tiles into this directory, instead of listing them")
+	pbfPtr := flag.String("pbf", "", "The OSM data file to render the tiles from")
+	shapefilePtr := flag.String("shapefile", "", "The land shapefile to render the tiles with (optional)")
+	stylesPtr := flag.String("styles", "", "A comma separated list of style files, each of which is rendered as a layer")
+	formatPtr := flag.String("format", "png", "The image format of the layers that don't set one (png, jpeg, webp or webp-lossless)")
+	qualityPtr := flag.Int("quality", gis.DefaultQuality, "The quality of the lossy formats (1-100)")
+	logLevelPtr := flag.String("log-level", "info", "The lowest level of the messages that are logged to stderr (debug, info, warn or error)")
+	logFormatPtr := flag.String("log-format", "text", "The format of the messages that are logged (text or json)")
+	flag.Parse()
+
+	if len(*polyPtr) > 0 || len(*bboxPtr) > 0 {
+		var area gis.Area
+		var gazetteer gis.Gazetteer
+		var err error
+
+		if len(*gazetteerPtr) > 0 {
+			gazetteer, err = gis.ReadGazetteerFile(*gazetteerPtr)
+		}
+
+		if err == nil && len(*polyPtr) > 0 {
+			area, err = gis.ReadAreaFile(*polyPtr)
+		} else if err == nil {
+			area, err = gis.ParseBBox(*bboxPtr, gazetteer)
+		}
+
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		tiles := gis.TilesInArea(area, uint32(*zoomPtr))
+
+		if len(*renderPtr) == 0 {
+			for _, tile := range tiles {
+				fmt.Println(tile)
+			}
+
+			return
+		}
+
+		if len(*pbfPtr) == 0 || len(*stylesPtr) == 0 {
+			fmt.Println("Rendering tiles requires an OSM data file and styles (use -pbf and -styles).")
+			os.Exit(1)
+		}
+
+		logger, err := gis.NewLogger(os.Stderr, *logLevelPtr, *logFormatPtr)
+
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		format, err := gis.ParseImageFormat(*formatPtr)
+
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		layers, err := loadLayers(strings.Split(*stylesPtr, ","), format, *qualityPtr, logger)
+
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		pbf := &gis.PBF{Logger: logger}
+		pbf.Init()
+
+		if err := pbf.LoadFile(*pbfPtr); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		var shapefile *gis.Shapefile
+
+		if len(*shapefilePtr) > 0 {
+			shapefile = &gis.Shapefile{Filename: *shapefilePtr}
+
+			if err := shapefile.Load(); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+
+			if err := shapefile.ReadAll(); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}
+
+		for _, tile := range tiles {
+			if err := renderTile(tile, layers, pbf, shapefile, *renderPtr); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+
+			fmt.Println(tile)
+		}
+
+		return
+	}
+
 	lon := 9.0
 	lat := 52.0
 
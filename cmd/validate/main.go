@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/wisepythagoras/gis-utils/gis"
+)
+
+var issueKinds = []gis.IssueKind{
+	gis.IssueMissingNodes,
+	gis.IssueUnclosedMultipolygon,
+	gis.IssueSelfIntersection,
+	gis.IssueDuplicateNodes,
+	gis.IssueZeroLength,
+}
+
+// writeText writes every issue on its own line, followed by the number of issues of each kind.
+func writeText(report *gis.QualityReport, w io.Writer) error {
+	for _, issue := range report.Issues {
+		if _, err := fmt.Fprintln(w, issue); err != nil {
+			return err
+		}
+	}
+
+	for _, kind := range issueKinds {
+		if _, err := fmt.Fprintf(w, "%s: %d\n", kind, report.Count(kind)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	pbfPtr := flag.String("pbf", "", "The path to the OSM data file to check (.osm.pbf, .osm, .osm.bz2 or .osm.gz)")
+	changesPtr := flag.String("changes", "", "A comma separated list of change files (.osc, .osc.gz or .osc.bz2) to apply first")
+	formatPtr := flag.String("format", "text", "The format of the report (text, json or geojson)")
+	outputPtr := flag.String("output", "", "The path to write the report to, instead of stdout")
+	logLevelPtr := flag.String("log-level", "info", "The lowest level of the messages that are logged to stderr (debug, info, warn or error)")
+	logFormatPtr := flag.String("log-format", "text", "The format of the messages that are logged (text or json)")
+	flag.Parse()
+
+	if len(*pbfPtr) == 0 {
+		fmt.Println("A path to an OSM data file is required (use -pbf path/to/file.osm.pbf).")
+		os.Exit(1)
+	}
+
+	write := map[string]func(*gis.QualityReport, io.Writer) error{
+		"text":    writeText,
+		"json":    (*gis.QualityReport).WriteJSON,
+		"geojson": (*gis.QualityReport).WriteGeoJSON,
+	}[strings.ToLower(*formatPtr)]
+
+	if write == nil {
+		fmt.Printf("Unknown report format %q (use text, json or geojson).\n", *formatPtr)
+		os.Exit(1)
+	}
+
+	logger, err := gis.NewLogger(os.Stderr, *logLevelPtr, *logFormatPtr)
+
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	pbf := &gis.PBF{Logger: logger}
+	pbf.Init()
+
+	if err := pbf.LoadFileContext(ctx, *pbfPtr); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	if len(*changesPtr) > 0 {
+		for _, changeFile := range strings.Split(*changesPtr, ",") {
+			if err := pbf.ApplyChangeFile(strings.TrimSpace(changeFile)); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	var w io.Writer = os.Stdout
+
+	if len(*outputPtr) > 0 {
+		f, err := os.Create(*outputPtr)
+
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		defer f.Close()
+		w = f
+	}
+
+	if err := write(pbf.QualityReport(), w); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/samber/lo"
+)
+
+// mapCSSDeclaration is a property of a MapCSS rule, with the position of the rule in the style sheet.
+type mapCSSDeclaration struct {
+	property string
+	value    string
+	order    int
+}
+
+// cascade merges the MapCSS styles that match a feature, the way that MapCSS does: the declarations
+// of every rule that matches apply in the order of the style sheet, so later rules only override the
+// properties that they set. Each ::layer is merged on its own.
+type cascade struct {
+	// The ::layer of each style, and its declarations, by the index of the style.
+	layers       []string
+	declarations [][]mapCSSDeclaration
+	// The ::layers in the order that they first appear in.
+	layerOrder []string
+	// The styles that have been merged, by their layer and the indexes of the styles, so that every
+	// feature with the same matches is drawn with the same style.
+	merged map[string]*FeatureStyle
+	mutex  sync.Mutex
+}
+
+func newCascade() *cascade {
+	return &cascade{merged: make(map[string]*FeatureStyle)}
+}
+
+// addStyle adds a style in the ::layer, and returns its index.
+func (c *cascade) addStyle(layer string) int {
+	if !lo.Contains(c.layerOrder, layer) {
+		c.layerOrder = append(c.layerOrder, layer)
+	}
+
+	c.layers = append(c.layers, layer)
+	c.declarations = append(c.declarations, nil)
+
+	return len(c.layers) - 1
+}
+
+// selectStyles merges the matches of each ::layer into one match, with the default layer first.
+func (c *cascade) selectStyles(matches []StyleMatch) []StyleMatch {
+	byLayer := make(map[string][]StyleMatch)
+
+	for _, match := range matches {
+		layer := c.layers[match.Index]
+		byLayer[layer] = append(byLayer[layer], match)
+	}
+
+	selected := make([]StyleMatch, 0, len(byLayer))
+
+	for _, layer := range c.layerOrder {
+		if group := byLayer[layer]; len(group) > 0 {
+			selected = append(selected, c.mergeMatches(layer, group))
+		}
+	}
+
+	// The default layer goes first, so that the others with the same z-index are drawn over it.
+	sort.SliceStable(selected, func(i, j int) bool {
+		return !selected[i].Style.Additional && selected[j].Style.Additional
+	})
+
+	return selected
+}
+
+// mergeMatches returns the match of the style that the matches of a ::layer merge into. It has the
+// name and the conditions of the most specific of them, for the legend.
+func (c *cascade) mergeMatches(layer string, group []StyleMatch) StyleMatch {
+	sort.Slice(group, func(i, j int) bool {
+		return group[i].Index < group[j].Index
+	})
+
+	best := group[0]
+	key := &strings.Builder{}
+	reasons := make([]string, len(group))
+	key.WriteString(layer)
+
+	for i, match := range group {
+		if match.Specificity >= best.Specificity {
+			best = match
+		}
+
+		key.WriteString("," + strconv.Itoa(match.Index))
+		reasons[i] = match.Reason
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	style, ok := c.merged[key.String()]
+
+	if !ok {
+		style = c.mergeStyles(layer, best.Style, group)
+		c.merged[key.String()] = style
+	}
+
+	return StyleMatch{
+		Style:       style,
+		Index:       best.Index,
+		Specificity: best.Specificity,
+		Reason:      strings.Join(reasons, "; "),
+		Merged:      group,
+	}
+}
+
+// mergeStyles applies the declarations of the styles in the order of the style sheet.
+func (c *cascade) mergeStyles(layer string, best *FeatureStyle, group []StyleMatch) *FeatureStyle {
+	style := &FeatureStyle{
+		Name:       best.Name,
+		Queries:    best.Queries,
+		Require:    best.Require,
+		Exclude:    best.Exclude,
+		Layer:      best.Layer,
+		Additional: layer != defaultMapCSSLayer,
+		WidthStops: [][]float64{{0, 1}},
+	}
+	declarations := make([]mapCSSDeclaration, 0)
+
+	for _, match := range group {
+		declarations = append(declarations, c.declarations[match.Index]...)
+	}
+
+	sort.SliceStable(declarations, func(i, j int) bool {
+		return declarations[i].order < declarations[j].order
+	})
+
+	// The declarations that can't be applied were reported when the style sheet was parsed.
+	for _, declaration := range declarations {
+		applyMapCSSDeclaration(style, declaration.property, declaration.value)
+	}
+
+	return style
+}
+
+// SelectStyles returns the matches that are drawn, like the SelectStyles function. The matches of a
+// MapCSS style sheet cascade instead, into one style for each of their ::layers.
+func (c *Config) SelectStyles(matches []StyleMatch) []StyleMatch {
+	if c.cascade == nil {
+		return SelectStyles(matches)
+	}
+
+	return c.cascade.selectStyles(matches)
+}
@@ -4,51 +4,228 @@ import (
 	"errors"
 	"fmt"
 	"image/color"
+	"math"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
-// ParseHexColor returns a color type which was parsed from a raw hex color
-// string. Adapted from here: https://stackoverflow.com/questions/54197913/parse-hex-string-to-image-color
+var colorFunctionRe = regexp.MustCompile(`^(rgba?|hsla?)\((.*)\)$`)
+
+// ParseHexColor returns a color type which was parsed from a raw hex color string, which can be
+// #rgb, #rgba, #rrggbb or #rrggbbaa. Adapted from here: https://stackoverflow.com/questions/54197913/parse-hex-string-to-image-color
 func ParseHexColor(hexColor string) (*color.RGBA, error) {
-	c := &color.RGBA{}
-	c.A = 255
+	if len(hexColor) == 0 || hexColor[0] != '#' {
+		return nil, errors.New("invalid color string")
+	}
+
+	digits := hexColor[1:]
+
+	// Short colors repeat every digit, e.g. #f80 is #ff8800.
+	if len(digits) == 3 || len(digits) == 4 {
+		long := make([]byte, 0, 2*len(digits))
+
+		for i := 0; i < len(digits); i++ {
+			long = append(long, digits[i], digits[i])
+		}
 
-	if hexColor[0] != '#' {
-		return c, errors.New("invalid color string")
+		digits = string(long)
 	}
 
-	if len(hexColor) == 7 {
-		_, err := fmt.Sscanf(hexColor, "#%02x%02x%02x", &c.R, &c.G, &c.B)
-		return c, err
-	} else if len(hexColor) == 4 {
-		_, err := fmt.Sscanf(hexColor, "#%1x%1x%1x", &c.R, &c.G, &c.B)
-		c.R *= 17
-		c.G *= 17
-		c.B *= 17
-		return c, err
-	} else {
-		return nil, errors.New("invalid hex color length (must be 6 or 3)")
+	if len(digits) != 6 && len(digits) != 8 {
+		return nil, errors.New("invalid hex color length (must be 3, 4, 6 or 8)")
+	}
+
+	channels := []uint8{255, 255, 255, 255}
+
+	for i := 0; i < len(digits); i += 2 {
+		value, err := strconv.ParseUint(digits[i:i+2], 16, 8)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex color %s", hexColor)
+		}
+
+		channels[i/2] = uint8(value)
 	}
+
+	return premultiply(float64(channels[0]), float64(channels[1]), float64(channels[2]), float64(channels[3])/255), nil
 }
 
-// ParseRGBAColor parses an rgba color string.
+// ParseRGBAColor parses an rgb() or rgba() color string. The channels are from 0 to 255, or
+// percentages, and the alpha is from 0 to 1, or a percentage. An integer alpha above 1 that's
+// separated with a comma is from 0 to 255, as in rgba(0, 0, 0, 128), which is how they used to be
+// written in the styles.
 func ParseRGBAColor(rgbaColor string) (*color.RGBA, error) {
-	re := regexp.MustCompile(`^rgba\(\d+, \d+, \d+, \d+\)`)
+	name, args, slash, err := splitColorFunction(rgbaColor)
+
+	if err != nil {
+		return nil, err
+	} else if name != "rgb" && name != "rgba" {
+		return nil, errors.New("invalid string color")
+	}
+
+	channels := make([]float64, 3)
+
+	for i := range channels {
+		if channels[i], err = parseColorNumber(args[i], 255); err != nil {
+			return nil, err
+		}
+	}
+
+	alpha := 1.0
 
-	if len(re.FindString(rgbaColor)) == 0 {
+	if len(args) == 4 {
+		if alpha, err = parseAlpha(args[3], !slash); err != nil {
+			return nil, err
+		}
+	}
+
+	return premultiply(channels[0], channels[1], channels[2], alpha), nil
+}
+
+// ParseHSLColor parses an hsl() or hsla() color string, e.g. hsl(120, 50%, 40%) or
+// hsla(120deg 50% 40% / 0.5).
+func ParseHSLColor(hslColor string) (*color.RGBA, error) {
+	name, args, _, err := splitColorFunction(hslColor)
+
+	if err != nil {
+		return nil, err
+	} else if name != "hsl" && name != "hsla" {
 		return nil, errors.New("invalid string color")
 	}
 
-	c := &color.RGBA{}
-	_, err := fmt.Sscanf(rgbaColor, "rgba(%d, %d, %d, %d)", &c.R, &c.G, &c.B, &c.A)
+	hue, err := strconv.ParseFloat(strings.TrimSuffix(args[0], "deg"), 64)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid hue %s", args[0])
+	}
+
+	saturation, err := parseColorNumber(args[1], 1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	lightness, err := parseColorNumber(args[2], 1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	alpha := 1.0
+
+	if len(args) == 4 {
+		if alpha, err = parseAlpha(args[3], false); err != nil {
+			return nil, err
+		}
+	}
+
+	// https://www.w3.org/TR/css-color-4/#hsl-to-rgb
+	hue = math.Mod(math.Mod(hue, 360)+360, 360)
+	channel := func(n float64) float64 {
+		k := math.Mod(n+hue/30, 12)
+		a := saturation * math.Min(lightness, 1-lightness)
+
+		return 255 * (lightness - a*math.Max(-1, math.Min(k-3, math.Min(9-k, 1))))
+	}
+
+	return premultiply(channel(0), channel(8), channel(4), alpha), nil
+}
 
-	return c, err
+// ParseNamedColor returns one of the named colors of CSS, e.g. steelblue.
+func ParseNamedColor(name string) (*color.RGBA, error) {
+	hex, ok := namedColors[strings.ToLower(name)]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown color name %s", name)
+	}
+
+	return ParseHexColor(hex)
 }
 
+// ParseColor parses a color in any of the CSS syntaxes: #rgb, #rgba, #rrggbb, #rrggbbaa, rgb(),
+// rgba(), hsl(), hsla() or a color name. Colors are premultiplied by their alpha, the way that the
+// canvas expects them.
 func ParseColor(colorStr string) (*color.RGBA, error) {
-	if colorStr[0] == '#' {
+	colorStr = strings.TrimSpace(colorStr)
+
+	if len(colorStr) == 0 {
+		return nil, errors.New("empty color string")
+	} else if colorStr[0] == '#' {
 		return ParseHexColor(colorStr)
-	} else {
+	}
+
+	lower := strings.ToLower(colorStr)
+
+	if strings.HasPrefix(lower, "rgb") {
 		return ParseRGBAColor(colorStr)
+	} else if strings.HasPrefix(lower, "hsl") {
+		return ParseHSLColor(colorStr)
+	}
+
+	return ParseNamedColor(colorStr)
+}
+
+// splitColorFunction splits a color like rgba(1, 2, 3, 0.5) or rgb(1 2 3 / 50%) into the name of the
+// function and its 3 or 4 arguments, and returns whether the alpha is separated with a slash.
+func splitColorFunction(colorStr string) (string, []string, bool, error) {
+	match := colorFunctionRe.FindStringSubmatch(strings.ToLower(strings.TrimSpace(colorStr)))
+
+	if match == nil {
+		return "", nil, false, errors.New("invalid string color")
+	}
+
+	args := strings.FieldsFunc(strings.ReplaceAll(match[2], "/", " "), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+
+	if len(args) != 3 && len(args) != 4 {
+		return "", nil, false, fmt.Errorf("invalid color %s (it needs 3 or 4 values)", colorStr)
+	}
+
+	return match[1], args, strings.Contains(match[2], "/"), nil
+}
+
+// parseColorNumber parses a number that's from 0 to max, or a percentage of max.
+func parseColorNumber(s string, max float64) (float64, error) {
+	percentage := strings.HasSuffix(s, "%")
+	value, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid color value %s", s)
+	}
+
+	if percentage {
+		value = value * max / 100
+	}
+
+	return math.Max(0, math.Min(max, value)), nil
+}
+
+// parseAlpha parses the alpha of a color, from 0 to 1. If legacy is set, integers above 1 are from 0
+// to 255, which is how rgba() colors used to be written in the styles.
+func parseAlpha(s string, legacy bool) (float64, error) {
+	if strings.HasSuffix(s, "%") {
+		return parseColorNumber(s, 1)
+	}
+
+	if legacy && !strings.ContainsAny(s, ".eE") {
+		if value, err := strconv.ParseFloat(s, 64); err == nil && value > 1 {
+			return math.Min(255, value) / 255, nil
+		}
+	}
+
+	return parseColorNumber(s, 1)
+}
+
+// premultiply returns the color with the channels from 0 to 255 and the alpha from 0 to 1.
+func premultiply(r, g, b, alpha float64) *color.RGBA {
+	alpha = math.Max(0, math.Min(1, alpha))
+
+	return &color.RGBA{
+		R: uint8(math.Round(r * alpha)),
+		G: uint8(math.Round(g * alpha)),
+		B: uint8(math.Round(b * alpha)),
+		A: uint8(math.Round(alpha * 255)),
 	}
 }
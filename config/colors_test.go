@@ -0,0 +1,103 @@
+package config
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		input string
+		want  color.RGBA
+		// Whether the color is invalid.
+		invalid bool
+	}{
+		{input: "#ff8800", want: color.RGBA{255, 136, 0, 255}},
+		{input: "#f80", want: color.RGBA{255, 136, 0, 255}},
+		{input: "#FF880080", want: color.RGBA{128, 68, 0, 128}},
+		{input: "#f808", want: color.RGBA{136, 73, 0, 136}},
+		{input: "#ff888", invalid: true},
+		{input: "#gg8800", invalid: true},
+		{input: "rgb(255, 136, 0)", want: color.RGBA{255, 136, 0, 255}},
+		{input: "rgb(100%, 0%, 50%)", want: color.RGBA{255, 0, 128, 255}},
+		{input: "rgb(255 136 0)", want: color.RGBA{255, 136, 0, 255}},
+		{input: "rgba(200, 0, 0, 1)", want: color.RGBA{200, 0, 0, 255}},
+		{input: "rgba(0, 0, 0, 1)", want: color.RGBA{0, 0, 0, 255}},
+		{input: "rgba(200, 0, 0, 0)", want: color.RGBA{0, 0, 0, 0}},
+		{input: "rgba(200, 0, 0, 0.5)", want: color.RGBA{100, 0, 0, 128}},
+		{input: "rgba(200, 0, 0, 50%)", want: color.RGBA{100, 0, 0, 128}},
+		{input: "rgb(10 20 30 / 1)", want: color.RGBA{10, 20, 30, 255}},
+		{input: "rgb(200 0 0 / 0.5)", want: color.RGBA{100, 0, 0, 128}},
+		{input: "rgb(200 0 0 / 128)", want: color.RGBA{200, 0, 0, 255}},
+		// The old way of writing the alpha, from 0 to 255.
+		{input: "rgba(200, 0, 0, 128)", want: color.RGBA{100, 0, 0, 128}},
+		{input: "rgba(200, 0, 0, 255)", want: color.RGBA{200, 0, 0, 255}},
+		{input: "rgb(1, 2)", invalid: true},
+		{input: "rgb(a, b, c)", invalid: true},
+		{input: "hsl(120, 100%, 50%)", want: color.RGBA{0, 255, 0, 255}},
+		{input: "hsl(0deg 100% 50%)", want: color.RGBA{255, 0, 0, 255}},
+		{input: "hsl(-120, 100%, 50%)", want: color.RGBA{0, 0, 255, 255}},
+		{input: "hsla(120, 100%, 50%, 0.5)", want: color.RGBA{0, 128, 0, 128}},
+		{input: "hsla(120deg 100% 50% / 1)", want: color.RGBA{0, 255, 0, 255}},
+		{input: "steelblue", want: color.RGBA{70, 130, 180, 255}},
+		{input: " SteelBlue ", want: color.RGBA{70, 130, 180, 255}},
+		{input: "notacolor", invalid: true},
+		{input: "", invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := ParseColor(test.input)
+
+			if test.invalid {
+				if err == nil {
+					t.Errorf("got %v, want an error", got)
+				}
+			} else if err != nil {
+				t.Errorf("got the error %v", err)
+			} else if *got != test.want {
+				t.Errorf("got %v, want %v", *got, test.want)
+			}
+		})
+	}
+}
+
+func TestPaletteColors(t *testing.T) {
+	c := &Config{}
+	err := c.Parse([]byte(`
+palette:
+  road: "#ff8800"
+  major: road
+  translucent: "rgba(0, 0, 0, 1)"
+styles:
+  - queries: [{attribute: highway, value: primary}]
+    stroke_color: major
+    fill_color: translucent
+    casing: {color: road}
+  - queries: [{attribute: highway, value: secondary}]
+    stroke_color: steelblue
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, got, want string
+	}{
+		{"a name that refers to another one", c.GetStyles().Styles[0].StrokeColor, "#ff8800"},
+		{"a color function", c.GetStyles().Styles[0].FillColor, "rgba(0, 0, 0, 1)"},
+		{"a nested color", c.GetStyles().Styles[0].Casing.Color, "#ff8800"},
+		{"a named color", c.GetStyles().Styles[1].StrokeColor, "steelblue"},
+	}
+
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s got %q, want %q", test.name, test.got, test.want)
+		}
+
+		if _, err := ParseColor(test.got); err != nil {
+			t.Errorf("%s got the error %v", test.name, err)
+		}
+	}
+}
@@ -2,12 +2,14 @@ package config
 
 import (
 	"errors"
-	"fmt"
 	"image/color"
 	"io/ioutil"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"strings"
 
-	"github.com/samber/lo"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 const NOT_LOADED_ERR = "no loaded styles were found"
@@ -16,10 +18,25 @@ const NO_STYLE_ERR = "no corresponding style found"
 type FeatureStyleMap map[string]map[string]*FeatureStyle
 
 type Config struct {
-	UseMap      bool
-	Verbose     bool
+	UseMap  bool
+	Verbose bool
+	// Logger is where the styles that are parsed and the problems with drawing them are logged.
+	Logger *slog.Logger
+	// Whether to print which styles every feature matched, and why.
+	Debug       bool
 	styleConfig *StyleConfig
 	styleMap    FeatureStyleMap
+	matcher     *matcher
+	// The directory of the style file, which relative paths in it are resolved against.
+	baseDir string
+	// The YAML that the styles were parsed from, for finding the lines of problems, and the number of
+	// styles that come before its own from the files that it includes.
+	source         []byte
+	includedStyles int
+	// The parts of a MapLibre style or a MapCSS style sheet that couldn't be converted.
+	importProblems []Problem
+	// How the styles of a MapCSS style sheet are merged, or nil for the other styles.
+	cascade *cascade
 }
 
 func (c *Config) ParseFile(filename string) error {
@@ -33,29 +50,82 @@ func (c *Config) ParseFile(filename string) error {
 		return err
 	}
 
+	c.baseDir = filepath.Dir(filename)
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return c.ParseMapLibre(source)
+	case ".mapcss":
+		return c.ParseMapCSS(source)
+	}
+
 	return c.Parse(source)
 }
 
 func (c *Config) Parse(source []byte) error {
 	var styleConfig StyleConfig
+	var err error
+	expanded := source
+	c.includedStyles = 0
+
+	if usesExpansion(source) {
+		if expanded, c.includedStyles, err = expand(source, c.baseDir); err != nil {
+			return err
+		}
+	}
 
-	err := yaml.Unmarshal(source, &styleConfig)
+	err = yaml.Unmarshal(expanded, &styleConfig)
 
 	if err != nil {
 		return err
 	}
 
+	// Colors are resolved here, so that everything that reads the styles gets plain colors.
+	if len(styleConfig.Palette) > 0 {
+		resolvePalette(reflect.ValueOf(&styleConfig), styleConfig.Palette)
+	}
+
+	c.useStyles(&styleConfig)
+	c.source = source
+	c.importProblems = nil
+
+	return nil
+}
+
+// useStyles makes the styles the ones that are queried, and indexes them.
+func (c *Config) useStyles(styleConfig *StyleConfig) {
 	if c.UseMap {
 		c.styleMap = c.parseStyles(styleConfig.Styles)
 	}
 
-	c.styleConfig = &styleConfig
+	c.styleConfig = styleConfig
+	c.matcher = newMatcher(styleConfig.Styles)
+	c.cascade = nil
+	c.warnLayers()
+}
 
-	return nil
+// warnLayers warns about the styles that are in a layer which isn't defined, which are drawn under
+// all of the layers instead, and about the z-indexes that are clamped to the range of a layer when
+// they're drawn. Validate reports them too, with their lines.
+func (c *Config) warnLayers() {
+	logger := c.Log()
+
+	for _, style := range c.styleConfig.Styles {
+		if layer, _ := c.GetLayer(style.Layer); layer == nil && len(style.Layer) > 0 {
+			logger.Warn("the layer of the style isn't defined, so it's drawn under all of the layers",
+				"style", style.Name, "layer", style.Layer)
+		}
+
+		if style.ZIndex < -MaxZIndex || style.ZIndex > MaxZIndex {
+			logger.Warn("the z-index of the style is outside of the range of a layer, so it's clamped",
+				"style", style.Name, "z_index", style.ZIndex, "max", MaxZIndex)
+		}
+	}
 }
 
 func (c *Config) parseStyles(styles []FeatureStyle) FeatureStyleMap {
 	styleMap := make(FeatureStyleMap)
+	logger := c.Log()
 
 	for i, style := range styles {
 		for _, query := range style.Queries {
@@ -65,9 +135,7 @@ func (c *Config) parseStyles(styles []FeatureStyle) FeatureStyleMap {
 
 			styleMap[query.Attribute][query.Value] = &styles[i]
 
-			if c.Verbose {
-				fmt.Println(query.Attribute, query.Value, style)
-			}
+			logger.Debug("style", "name", style.Name, "attribute", query.Attribute, "value", query.Value)
 		}
 	}
 
@@ -83,15 +151,13 @@ func (c *Config) Query(attribute, value string) (*FeatureStyle, error) {
 		return c.queryMap(attribute, value)
 	}
 
-	style, ok := lo.Find(c.styleConfig.Styles, func(fs FeatureStyle) bool {
-		return lo.Some(fs.Queries, []FeatureQuery{{Attribute: attribute, Value: value}})
-	})
+	style, ok := c.matcher.first(attribute, value)
 
 	if !ok {
 		return nil, errors.New(NO_STYLE_ERR)
 	}
 
-	return &style, nil
+	return style, nil
 }
 
 func (c *Config) QueryId(wayId int64) (*FeatureStyle, error) {
@@ -99,15 +165,13 @@ func (c *Config) QueryId(wayId int64) (*FeatureStyle, error) {
 		return nil, errors.New(NOT_LOADED_ERR)
 	}
 
-	style, ok := lo.Find(c.styleConfig.Styles, func(fs FeatureStyle) bool {
-		return lo.Some(fs.WayIdQueries, []int64{wayId})
-	})
+	style, ok := c.matcher.firstWithWayId(wayId)
 
 	if !ok {
 		return nil, errors.New(NO_STYLE_ERR)
 	}
 
-	return &style, nil
+	return style, nil
 }
 
 func (c *Config) queryMap(attribute, value string) (*FeatureStyle, error) {
@@ -181,3 +245,83 @@ func (c *Config) GetLandStrokeWidth() (float64, error) {
 
 	return c.styleConfig.Land.StrokeWidth, nil
 }
+
+// GetFormat returns the image format that tiles should be rendered in, or an empty string if it
+// wasn't set.
+func (c *Config) GetFormat() string {
+	if c.styleConfig == nil {
+		return ""
+	}
+
+	return c.styleConfig.Format
+}
+
+// GetQuality returns the quality of the lossy image formats, or 0 if it wasn't set.
+func (c *Config) GetQuality() int {
+	if c.styleConfig == nil {
+		return 0
+	}
+
+	return c.styleConfig.Quality
+}
+
+// GetLayer returns the layer with the name and its position in the drawing order, or nil and -1 if
+// there's no such layer.
+func (c *Config) GetLayer(name string) (*Layer, int) {
+	if c.styleConfig == nil || len(name) == 0 {
+		return nil, -1
+	}
+
+	for i := range c.styleConfig.Layers {
+		if c.styleConfig.Layers[i].Name == name {
+			return &c.styleConfig.Layers[i], i
+		}
+	}
+
+	return nil, -1
+}
+
+// GetFurniture returns the configuration of the map furniture.
+func (c *Config) GetFurniture() *Furniture {
+	if c.styleConfig == nil {
+		return &Furniture{}
+	}
+
+	return &c.styleConfig.Furniture
+}
+
+// GetGraticule returns the style of the graticule, or nil if it shouldn't be drawn.
+func (c *Config) GetGraticule() *GraticuleStyle {
+	if c.styleConfig == nil {
+		return nil
+	}
+
+	return c.styleConfig.Graticule
+}
+
+// GetGrid returns the style of the UTM grid, or nil if it shouldn't be drawn.
+func (c *Config) GetGrid() *GridStyle {
+	if c.styleConfig == nil {
+		return nil
+	}
+
+	return c.styleConfig.Grid
+}
+
+// GetOpacity returns the opacity of all of the features, which is 1 if it wasn't set.
+func (c *Config) GetOpacity() float64 {
+	if c.styleConfig == nil || c.styleConfig.Opacity == nil {
+		return 1
+	}
+
+	return *c.styleConfig.Opacity
+}
+
+// ResolvePath returns the path relative to the directory of the style file, unless it's absolute.
+func (c *Config) ResolvePath(path string) string {
+	if filepath.IsAbs(path) || len(c.baseDir) == 0 {
+		return path
+	}
+
+	return filepath.Join(c.baseDir, path)
+}
@@ -0,0 +1,339 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+// The keys of a style that aren't inherited by the styles that extend it.
+var notInherited = []string{"name", "queries", "way_id_queries", "extends"}
+
+// usesExpansion returns whether the YAML includes other files, has variables or has styles that extend
+// others. Anything else is parsed as it is, and so is YAML that can't be parsed, which reports the
+// error.
+func usesExpansion(source []byte) bool {
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(source, &doc); err != nil || len(doc.Content) == 0 {
+		return false
+	}
+
+	root := doc.Content[0]
+
+	if mappingValue(root, "include") != nil || mappingValue(root, "variables") != nil {
+		return true
+	}
+
+	if styles := mappingValue(root, "styles"); styles != nil {
+		for _, style := range styles.Content {
+			if mappingValue(style, "extends") != nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// expand merges the files that the YAML includes into it, replaces the variables with their values,
+// and merges the styles that others extend into them. It returns the YAML that's left, along with
+// the number of styles that came from the included files.
+func expand(source []byte, dir string) ([]byte, int, error) {
+	root, includedStyles, err := expandIncludes(source, dir, nil)
+
+	if err != nil || root == nil {
+		return source, 0, err
+	}
+
+	if err := replaceVariables(root); err != nil {
+		return nil, 0, err
+	}
+
+	if err := extendStyles(root); err != nil {
+		return nil, 0, err
+	}
+
+	expanded, err := yaml.Marshal(root)
+
+	return expanded, includedStyles, err
+}
+
+// expandIncludes parses the YAML and merges the files that it includes under it, in the order that
+// they're listed in. The styles and the layers of the included files come first, and the rest of
+// their keys are overridden by the ones of the file that includes them. The files that are being
+// included are in the stack, so that files can't include themselves.
+func expandIncludes(source []byte, dir string, stack []string) (*yaml.Node, int, error) {
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(source, &doc); err != nil {
+		return nil, 0, err
+	}
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, 0, nil
+	}
+
+	root := doc.Content[0]
+	includes := mappingValue(root, "include")
+
+	if includes == nil {
+		return root, 0, nil
+	}
+
+	filenames := []*yaml.Node{includes}
+
+	if includes.Kind == yaml.SequenceNode {
+		filenames = includes.Content
+	}
+
+	base := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+
+	for _, filename := range filenames {
+		path := filename.Value
+
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		if lo.Contains(stack, filepath.Clean(path)) {
+			return nil, 0, fmt.Errorf("line %d: %s includes itself", filename.Line, path)
+		}
+
+		included, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: %w", filename.Line, err)
+		}
+
+		includedRoot, _, err := expandIncludes(included, filepath.Dir(path), append(stack, filepath.Clean(path)))
+
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if includedRoot != nil {
+			rebasePaths(includedRoot, filepath.Dir(filename.Value))
+			base = mergeNodes(base, includedRoot, true)
+		}
+	}
+
+	includedStyles := 0
+
+	if styles := mappingValue(base, "styles"); styles != nil {
+		includedStyles = len(styles.Content)
+	}
+
+	merged := mergeNodes(base, root, true)
+	deleteKey(merged, "include")
+
+	return merged, includedStyles, nil
+}
+
+// rebasePaths makes the relative paths of the images of the fill patterns of an included file
+// relative to the file that includes it, by joining them to the directory of the include.
+func rebasePaths(root *yaml.Node, dir string) {
+	styles := mappingValue(root, "styles")
+
+	if styles == nil || styles.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for _, style := range styles.Content {
+		image := mappingValue(mappingValue(style, "fill_pattern"), "image")
+
+		if image == nil || image.Kind != yaml.ScalarNode || len(image.Value) == 0 ||
+			strings.HasPrefix(image.Value, "$") || filepath.IsAbs(image.Value) {
+			continue
+		}
+
+		image.Value = filepath.Join(dir, image.Value)
+	}
+}
+
+// mergeNodes returns the mapping with the keys of over merged into the ones of base. Mappings are
+// merged key by key, and the rest of the values are replaced, except for the styles and the layers
+// at the top level, which are appended.
+func mergeNodes(base, over *yaml.Node, topLevel bool) *yaml.Node {
+	if base.Kind != yaml.MappingNode || over.Kind != yaml.MappingNode {
+		return over
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: base.Tag, Line: over.Line, Column: over.Column}
+	merged.Content = append(merged.Content, base.Content...)
+
+	for i := 0; i+1 < len(over.Content); i += 2 {
+		key, value := over.Content[i], over.Content[i+1]
+		j := keyIndex(merged, key.Value)
+
+		if j < 0 {
+			merged.Content = append(merged.Content, key, value)
+			continue
+		}
+
+		existing := merged.Content[j+1]
+
+		switch {
+		case topLevel && (key.Value == "styles" || key.Value == "layers") && existing.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			appended := *value
+			appended.Content = append(append([]*yaml.Node{}, existing.Content...), value.Content...)
+			merged.Content[j+1] = &appended
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			merged.Content[j+1] = mergeNodes(existing, value, false)
+		default:
+			merged.Content[j+1] = value
+		}
+	}
+
+	return merged
+}
+
+// replaceVariables replaces the values like $name with the values of the variables at the top level,
+// which keeps their types, so that they can be used for widths as well as colors.
+func replaceVariables(root *yaml.Node) error {
+	variablesNode := mappingValue(root, "variables")
+
+	if variablesNode == nil {
+		return nil
+	}
+
+	variables := make(map[string]*yaml.Node)
+
+	for i := 0; i+1 < len(variablesNode.Content); i += 2 {
+		variables[variablesNode.Content[i].Value] = variablesNode.Content[i+1]
+	}
+
+	var replace func(node *yaml.Node, depth int) error
+
+	replace = func(node *yaml.Node, depth int) error {
+		if node.Kind == yaml.ScalarNode && strings.HasPrefix(node.Value, "$") && node.Tag == "!!str" {
+			name := strings.TrimPrefix(node.Value, "$")
+			value, ok := variables[name]
+
+			if !ok {
+				return fmt.Errorf("line %d: unknown variable $%s", node.Line, name)
+			} else if depth > len(variables) {
+				return fmt.Errorf("line %d: the variable $%s refers to itself", node.Line, name)
+			}
+
+			line, column := node.Line, node.Column
+			*node = *value
+			node.Line, node.Column = line, column
+
+			// The value can be another variable.
+			return replace(node, depth+1)
+		}
+
+		for _, child := range node.Content {
+			if err := replace(child, depth); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return replace(root, 0)
+}
+
+// extendStyles merges every style that has extends with the style with that name. The keys of the
+// style override the ones that it extends, and mappings like the casing are merged key by key.
+func extendStyles(root *yaml.Node) error {
+	styles := mappingValue(root, "styles")
+
+	if styles == nil || styles.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	byName := make(map[string]int)
+
+	for i, style := range styles.Content {
+		if name := mappingValue(style, "name"); name != nil {
+			if _, ok := byName[name.Value]; !ok {
+				byName[name.Value] = i
+			}
+		}
+	}
+
+	resolved := make(map[int]bool)
+	resolving := make(map[int]bool)
+
+	var resolve func(i int) error
+
+	resolve = func(i int) error {
+		style := styles.Content[i]
+		extends := mappingValue(style, "extends")
+
+		if resolved[i] || extends == nil {
+			return nil
+		} else if resolving[i] {
+			return fmt.Errorf("line %d: the style extends itself", style.Line)
+		}
+
+		parentIndex, ok := byName[extends.Value]
+
+		if !ok {
+			return fmt.Errorf("line %d: the style extends %q, which isn't the name of a style", extends.Line, extends.Value)
+		}
+
+		resolving[i] = true
+
+		if err := resolve(parentIndex); err != nil {
+			return err
+		}
+
+		inherited := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		inherited.Content = append(inherited.Content, styles.Content[parentIndex].Content...)
+
+		for _, key := range notInherited {
+			deleteKey(inherited, key)
+		}
+
+		styles.Content[i] = mergeNodes(inherited, style, false)
+		resolved[i] = true
+
+		return nil
+	}
+
+	for i := range styles.Content {
+		if err := resolve(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keyIndex returns the index of the key in the content of the mapping, or -1.
+func keyIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// mappingValue returns the value of the key in the mapping, or nil.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	if i := keyIndex(mapping, key); i >= 0 {
+		return mapping.Content[i+1]
+	}
+
+	return nil
+}
+
+func deleteKey(mapping *yaml.Node, key string) {
+	if i := keyIndex(mapping, key); i >= 0 {
+		mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+	}
+}
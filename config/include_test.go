@@ -0,0 +1,228 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes the files, by their paths relative to the directory, and creates the
+// directories that they're in.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIncludedImagePaths(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"styles.yaml": `
+include: [base/base.yaml]
+styles:
+  - name: own
+    queries: [{attribute: landuse, value: meadow}]
+    fill_pattern: {type: image, image: meadow.png}
+`,
+		"base/base.yaml": `
+include: [more/more.yaml]
+styles:
+  - name: included
+    queries: [{attribute: landuse, value: forest}]
+    fill_pattern: {type: image, image: forest.png}
+  - name: absolute
+    queries: [{attribute: landuse, value: farmland}]
+    fill_pattern: {type: image, image: /patterns/farmland.png}
+`,
+		"base/more/more.yaml": `
+styles:
+  - name: nested
+    queries: [{attribute: natural, value: scrub}]
+    fill_pattern: {type: image, image: ../scrub.png}
+`,
+	})
+
+	c := &Config{}
+
+	if err := c.ParseFile(filepath.Join(dir, "styles.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"nested":   filepath.Join(dir, "base/scrub.png"),
+		"included": filepath.Join(dir, "base/forest.png"),
+		"absolute": "/patterns/farmland.png",
+		"own":      filepath.Join(dir, "meadow.png"),
+	}
+
+	for _, style := range c.GetStyles().Styles {
+		if got := c.ResolvePath(style.FillPattern.Image); got != want[style.Name] {
+			t.Errorf("the image of %s got %s, want %s", style.Name, got, want[style.Name])
+		}
+	}
+}
+
+func TestUsesExpansion(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"include: [base.yaml]\n", true},
+		{"variables: {road: '#fff'}\n", true},
+		{"styles:\n  - name: a\n  - name: b\n    extends: a\n", true},
+		{"styles:\n  - name: a\n    queries: [{attribute: highway, value: primary}]\n", false},
+		// The keys only count where they're used.
+		{"# include: base.yaml\nfill_color: '#fff'\n", false},
+		{"styles:\n  - name: 'extends: a'\n", false},
+		{"furniture:\n  legend:\n    title: 'variables: none'\n", false},
+		{"styles: [\n", false},
+	}
+
+	for _, test := range tests {
+		if got := usesExpansion([]byte(test.source)); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.source, got, test.want)
+		}
+	}
+}
+
+func TestExtendStyles(t *testing.T) {
+	c := &Config{}
+	err := c.Parse([]byte(`
+styles:
+  - name: road
+    stroke_color: "#ffffff"
+    stroke_width: 2
+    casing: {width: 1, color: "#999999"}
+  - name: major
+    extends: road
+    stroke_width: 4
+    casing: {color: "#666666"}
+  - name: primary
+    extends: major
+    queries: [{attribute: highway, value: primary}]
+    stroke_color: "#fcd6a4"
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	primary := c.GetStyles().Styles[2]
+
+	if primary.Name != "primary" || primary.StrokeColor != "#fcd6a4" || primary.StrokeWidth != 4 {
+		t.Errorf("got the style %+v, want the width of major and its own color", primary)
+	}
+
+	if primary.Casing == nil || primary.Casing.Width != 1 || primary.Casing.Color != "#666666" {
+		t.Errorf("got the casing %+v, want the width of road and the color of major", primary.Casing)
+	}
+
+	if len(c.GetStyles().Styles[1].Queries) != 0 {
+		t.Errorf("major got the queries %v, which aren't inherited", c.GetStyles().Styles[1].Queries)
+	}
+}
+
+func TestExpansionErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "cycle",
+			source: "styles:\n  - name: a\n    extends: b\n  - name: b\n    extends: a\n",
+			want:   "the style extends itself",
+		},
+		{
+			name:   "unknown style",
+			source: "styles:\n  - name: a\n    extends: c\n",
+			want:   `line 3: the style extends "c", which isn't the name of a style`,
+		},
+		{
+			name:   "unknown variable",
+			source: "variables: {road: '#fff'}\nfill_color: $water\n",
+			want:   "line 2: unknown variable $water",
+		},
+		{
+			name:   "variable that refers to itself",
+			source: "variables: {road: $road}\nfill_color: $road\n",
+			want:   "the variable $road refers to itself",
+		},
+		{
+			name:   "variables that refer to each other",
+			source: "variables: {a: $b, b: $a}\nfill_color: $a\n",
+			want:   "refers to itself",
+		},
+	}
+
+	for _, test := range tests {
+		c := &Config{}
+
+		if err := c.Parse([]byte(test.source)); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got the error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	c := &Config{}
+	err := c.Parse([]byte(`
+variables:
+  road: $white
+  white: "#ffffff"
+  width: 3
+fill_color: $white
+styles:
+  - queries: [{attribute: highway, value: primary}]
+    stroke_color: $road
+    stroke_width: $width
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	styles := c.GetStyles()
+
+	if styles.FillColor != "#ffffff" || styles.Styles[0].StrokeColor != "#ffffff" || styles.Styles[0].StrokeWidth != 3 {
+		t.Errorf("got the fill color %s and the style %+v, want the values of the variables", styles.FillColor, styles.Styles[0])
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"styles.yaml": "include: [a.yaml]\n",
+		"a.yaml":      "include: [sub/b.yaml]\n",
+		"sub/b.yaml":  "include: [../a.yaml]\n",
+	})
+
+	c := &Config{}
+	err := c.ParseFile(filepath.Join(dir, "styles.yaml"))
+
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(dir, "a.yaml")+" includes itself") {
+		t.Errorf("got the error %v, want a.yaml to include itself", err)
+	}
+
+	// A file can be included more than once, as long as it doesn't include itself.
+	writeFiles(t, dir, map[string]string{
+		"styles.yaml": "include: [a.yaml, sub/b.yaml]\n",
+		"a.yaml":      "include: [sub/b.yaml]\n",
+		"sub/b.yaml":  "fill_color: '#ffffff'\n",
+	})
+
+	if err := c.ParseFile(filepath.Join(dir, "styles.yaml")); err != nil {
+		t.Errorf("got the error %v, want none", err)
+	}
+}
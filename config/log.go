@@ -0,0 +1,32 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// discardHandler drops every record, for when there's no logger.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// LoggerOrDefault returns the logger if it's set. Otherwise the debug records are written to stderr
+// if verbose is set, the way the verbose output used to be, and nothing is logged if it isn't.
+func LoggerOrDefault(logger *slog.Logger, verbose bool) *slog.Logger {
+	if logger != nil {
+		return logger
+	} else if verbose {
+		return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	return slog.New(discardHandler{})
+}
+
+// Log returns the logger of the configuration, or the default one for Verbose.
+func (c *Config) Log() *slog.Logger {
+	return LoggerOrDefault(c.Logger, c.Verbose)
+}
@@ -0,0 +1,558 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The layer of the MapCSS rules that don't have a ::layer.
+const defaultMapCSSLayer = "default"
+
+// mapCSSParser turns the rules of a MapCSS style sheet into styles.
+type mapCSSParser struct {
+	source      string
+	styleConfig *StyleConfig
+	// The styles by their selectors, so that the rules with the same selector are merged.
+	bySelector map[string]int
+	cascade    *cascade
+	problems   []Problem
+	// The number of selectors so far, which is the priority of the next one.
+	order int
+}
+
+// ParseMapCSS parses a MapCSS style sheet, the way that JOSM styles are written, e.g.
+//
+//	way|z12-[highway=primary][!tunnel] { width: 4; color: #f2935c; z-index: 3; }
+//	way[highway=primary]::casing { width: 6; color: #8d4a1f; }
+//
+// Every selector becomes a style, and the rules with the same selector are merged into it. The
+// styles cascade like in MapCSS: a feature is drawn with the declarations of all of the rules that
+// match it, in the order of the style sheet, so later rules only override the properties that they
+// set. Every ::layer is merged on its own and drawn along with the default one, and the z-indexes
+// order all of them, so the casing above is drawn under the road. The widths and the dashes are in
+// pixels. The parts of the style sheet that can't be converted are reported by Validate.
+func (c *Config) ParseMapCSS(source []byte) error {
+	p := &mapCSSParser{
+		source:      stripMapCSSComments(string(source)),
+		styleConfig: &StyleConfig{Layers: []Layer{{Name: defaultMapCSSLayer}}},
+		bySelector:  make(map[string]int),
+		cascade:     newCascade(),
+	}
+
+	if err := p.parse(); err != nil {
+		return err
+	}
+
+	c.useStyles(p.styleConfig)
+	c.cascade = p.cascade
+	c.importProblems = p.problems
+	c.source = nil
+	c.includedStyles = 0
+
+	return nil
+}
+
+func (p *mapCSSParser) parse() error {
+	offset := 0
+
+	for {
+		open := strings.IndexByte(p.source[offset:], '{')
+
+		if open < 0 {
+			if rest := strings.TrimSpace(p.source[offset:]); len(rest) > 0 {
+				return fmt.Errorf("line %d: unexpected %q", p.line(offset+strings.Index(p.source[offset:], rest)), rest)
+			}
+
+			return nil
+		}
+
+		open += offset
+		end := matchingBrace(p.source, open)
+
+		if end < 0 {
+			return fmt.Errorf("line %d: the rule isn't closed", p.line(open))
+		}
+
+		selectors := strings.TrimSpace(p.source[offset:open])
+		line := p.line(offset + strings.Index(p.source[offset:open], selectors))
+
+		switch {
+		case len(selectors) == 0:
+			return fmt.Errorf("line %d: the rule has no selector", p.line(open))
+		case strings.HasPrefix(selectors, "@"):
+			p.warnf(line, "%s blocks aren't supported, so they're skipped", strings.Fields(selectors)[0])
+		case selectors != "meta":
+			p.parseRule(selectors, p.source[open+1:end], line, open+1)
+		}
+
+		offset = end + 1
+	}
+}
+
+// parseRule applies the declarations of a rule to the styles of all of its selectors.
+func (p *mapCSSParser) parseRule(selectors, block string, line, blockOffset int) {
+	for _, selector := range splitOutside(selectors, ',') {
+		selector = strings.TrimSpace(selector)
+
+		if selector == "canvas" {
+			p.applyCanvas(block, blockOffset)
+			continue
+		}
+
+		style, err := parseMapCSSSelector(selector)
+
+		if err != nil {
+			p.warnf(line, "the selector %s was skipped: %s", selector, err)
+			continue
+		}
+
+		key := strings.Join(strings.Fields(selector), "")
+		i, ok := p.bySelector[key]
+
+		// All of the styles are in one layer, so that the z-indexes order the ::layers too.
+		if !ok {
+			i = p.cascade.addStyle(style.Layer)
+			style.Layer = defaultMapCSSLayer
+			p.styleConfig.Styles = append(p.styleConfig.Styles, style)
+			p.bySelector[key] = i
+		}
+
+		p.styleConfig.Styles[i].Priority = p.order
+
+		p.forEachDeclaration(block, blockOffset, func(property, value string, line int) {
+			if err := applyMapCSSDeclaration(&p.styleConfig.Styles[i], property, value); err != nil {
+				p.warnf(line, "%s: %s", property, err)
+				return
+			}
+
+			p.cascade.declarations[i] = append(p.cascade.declarations[i], mapCSSDeclaration{property, value, p.order})
+		})
+
+		p.order++
+	}
+}
+
+// applyCanvas sets the background of the map, which is also the color of the land.
+func (p *mapCSSParser) applyCanvas(block string, blockOffset int) {
+	p.forEachDeclaration(block, blockOffset, func(property, value string, line int) {
+		if property != "fill-color" && property != "background-color" {
+			p.warnf(line, "the property %s of the canvas isn't supported", property)
+			return
+		}
+
+		p.styleConfig.FillColor = value
+		p.styleConfig.Land.FillColor = value
+	})
+}
+
+// forEachDeclaration calls the function with every property of the block and its value.
+func (p *mapCSSParser) forEachDeclaration(block string, blockOffset int, f func(property, value string, line int)) {
+	offset := blockOffset
+
+	for _, declaration := range splitOutside(block, ';') {
+		line := p.line(offset + len(declaration) - len(strings.TrimLeft(declaration, " \t\r\n")))
+		offset += len(declaration) + 1
+		declaration = strings.TrimSpace(declaration)
+
+		if len(declaration) == 0 {
+			continue
+		}
+
+		property, value, ok := strings.Cut(declaration, ":")
+
+		if !ok {
+			p.warnf(line, "the declaration %q has no value", declaration)
+			continue
+		}
+
+		value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "!important"))
+		f(strings.ToLower(strings.TrimSpace(property)), unquote(value), line)
+	}
+}
+
+func (p *mapCSSParser) warnf(line int, format string, args ...interface{}) {
+	p.problems = append(p.problems, Problem{Line: line, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+// line returns the line number of an offset in the source.
+func (p *mapCSSParser) line(offset int) int {
+	return strings.Count(p.source[:offset], "\n") + 1
+}
+
+// parseMapCSSSelector converts a selector, like way|z12-16[highway=primary][!tunnel]::casing, into a
+// style with its conditions. The first tag that's compared is the query, the rest of them are
+// required, and the negated ones are excluded.
+func parseMapCSSSelector(selector string) (FeatureStyle, error) {
+	style := FeatureStyle{Name: selector, Layer: defaultMapCSSLayer, WidthStops: [][]float64{{0, 1}}}
+	rest := selector
+	i := strings.IndexAny(rest, "|[:")
+
+	if i < 0 {
+		i = len(rest)
+	}
+
+	switch rest[:i] {
+	case "way", "area", "relation", "*":
+	case "node":
+		return style, errors.New("nodes aren't drawn")
+	default:
+		return style, fmt.Errorf("unsupported type %q", rest[:i])
+	}
+
+	rest = rest[i:]
+
+	if strings.HasPrefix(rest, "|z") {
+		end := strings.IndexAny(rest, "[:")
+
+		if end < 0 {
+			end = len(rest)
+		}
+
+		var err error
+
+		if style.MinZoom, style.MaxZoom, err = parseZoomRange(rest[2:end]); err != nil {
+			return style, err
+		}
+
+		rest = rest[end:]
+	}
+
+	var conditions []FeatureQuery
+
+	for len(rest) > 0 {
+		switch {
+		case rest[0] == '[':
+			end := closingBracket(rest)
+
+			if end < 0 {
+				return style, errors.New("a condition isn't closed")
+			}
+
+			query, negated, err := parseMapCSSCondition(rest[1:end])
+
+			if err != nil {
+				return style, err
+			} else if negated {
+				style.Exclude = append(style.Exclude, query)
+			} else {
+				conditions = append(conditions, query)
+			}
+
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "::"):
+			style.Layer = rest[2:]
+
+			if len(style.Layer) == 0 || strings.ContainsAny(style.Layer, " [:") {
+				return style, fmt.Errorf("invalid layer %q", style.Layer)
+			}
+
+			rest = ""
+		case rest[0] == ':':
+			// Pseudo-classes, like :closed, can't be checked on the tags, so they're ignored.
+			end := strings.IndexAny(rest[1:], "[:")
+
+			if end < 0 {
+				rest = ""
+			} else {
+				rest = rest[end+1:]
+			}
+		default:
+			return style, fmt.Errorf("unsupported selector %q", rest)
+		}
+	}
+
+	if len(conditions) == 0 {
+		return style, errors.New("it needs to compare at least one tag")
+	}
+
+	style.Queries = conditions[:1]
+	style.Require = conditions[1:]
+
+	// The rules in the other layers are drawn along with the ones in the default layer.
+	style.Additional = style.Layer != defaultMapCSSLayer
+
+	return style, nil
+}
+
+// parseMapCSSCondition parses the condition in brackets: key, !key, key=value, key!=value or key?.
+// Negated conditions are returned as exclusions.
+func parseMapCSSCondition(condition string) (FeatureQuery, bool, error) {
+	condition = strings.TrimSpace(condition)
+	negated := strings.HasPrefix(condition, "!")
+	condition = strings.TrimSpace(strings.TrimPrefix(condition, "!"))
+
+	for _, op := range []string{"=~", "^=", "$=", "*=", "~=", "<", ">"} {
+		if strings.Contains(condition, op) {
+			return FeatureQuery{}, false, fmt.Errorf("the operator %s isn't supported", op)
+		}
+	}
+
+	if key, value, ok := strings.Cut(condition, "!="); ok {
+		return FeatureQuery{Attribute: unquote(strings.TrimSpace(key)), Value: unquote(strings.TrimSpace(value))}, !negated, nil
+	} else if key, value, ok := strings.Cut(condition, "="); ok {
+		return FeatureQuery{Attribute: unquote(strings.TrimSpace(key)), Value: unquote(strings.TrimSpace(value))}, negated, nil
+	} else if key, ok := strings.CutSuffix(condition, "?"); ok {
+		return FeatureQuery{Attribute: unquote(strings.TrimSpace(key)), Value: "yes"}, negated, nil
+	}
+
+	return FeatureQuery{Attribute: unquote(condition), Value: "*"}, negated, nil
+}
+
+// parseZoomRange parses the zoom levels of a selector, e.g. 12, 12-, -11 or 12-16, into the minimum
+// and the exclusive maximum.
+func parseZoomRange(zoomRange string) (float64, float64, error) {
+	from, to, isRange := strings.Cut(zoomRange, "-")
+	var min, max float64
+	var err error
+
+	if len(from) > 0 {
+		if min, err = strconv.ParseFloat(from, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid zoom range %q", zoomRange)
+		}
+	}
+
+	if !isRange {
+		return min, min + 1, nil
+	} else if len(to) > 0 {
+		if max, err = strconv.ParseFloat(to, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid zoom range %q", zoomRange)
+		}
+
+		max++
+	}
+
+	return min, max, nil
+}
+
+// applyMapCSSDeclaration sets the property of the style.
+func applyMapCSSDeclaration(style *FeatureStyle, property, value string) error {
+	number := func() (float64, error) {
+		return strconv.ParseFloat(value, 64)
+	}
+
+	color := func(target *string) error {
+		if _, err := ParseColor(value); err != nil {
+			return err
+		}
+
+		*target = value
+
+		return nil
+	}
+
+	casing := func() *CasingStyle {
+		if style.Casing == nil {
+			style.Casing = &CasingStyle{}
+		}
+
+		return style.Casing
+	}
+
+	switch property {
+	case "width":
+		width, err := number()
+		style.WidthStops = [][]float64{{0, width}}
+		return err
+	case "color":
+		return color(&style.StrokeColor)
+	case "fill-color":
+		return color(&style.FillColor)
+	case "opacity", "fill-opacity":
+		opacity, err := number()
+
+		if property == "opacity" {
+			style.StrokeOpacity = &opacity
+		} else {
+			style.FillOpacity = &opacity
+		}
+
+		return err
+	case "dashes":
+		style.DashArray = nil
+
+		if value == "none" {
+			return nil
+		}
+
+		for _, dash := range strings.Split(value, ",") {
+			length, err := strconv.ParseFloat(strings.TrimSpace(dash), 64)
+
+			if err != nil {
+				return err
+			}
+
+			style.DashArray = append(style.DashArray, length)
+		}
+	case "dashes-offset":
+		offset, err := number()
+		style.DashOffset = offset
+		return err
+	case "z-index":
+		zIndex, err := number()
+		style.ZIndex = int(math.Round(zIndex))
+		return err
+	case "linecap":
+		style.LineCap = strings.Replace(value, "none", "butt", 1)
+	case "linejoin":
+		style.LineJoin = value
+	case "casing-width":
+		width, err := number()
+		casing().SideWidth = width
+		return err
+	case "casing-color":
+		return color(&casing().Color)
+	case "text":
+		// Labels with the name are the most common, so it's what auto means.
+		style.Text = strings.Replace(value, "auto", "name", 1)
+	case "text-color":
+		return color(&style.TextColor)
+	case "font-size":
+		size, err := number()
+		style.TextSize = size
+		return err
+	default:
+		return errors.New("the property isn't supported")
+	}
+
+	return nil
+}
+
+// stripMapCSSComments replaces the /* */ and // comments with spaces, which keeps the offsets and the
+// line numbers of everything else.
+func stripMapCSSComments(source string) string {
+	stripped := []byte(source)
+	var quote byte
+
+	for i := 0; i < len(stripped); i++ {
+		c := stripped[i]
+
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+
+			if end < 0 {
+				end = len(source)
+			} else {
+				end += i + 4
+			}
+
+			blank(stripped[i:end])
+			i = end - 1
+		case strings.HasPrefix(source[i:], "//") && (i == 0 || strings.ContainsRune(" \t\n", rune(source[i-1]))):
+			end := strings.IndexByte(source[i:], '\n')
+
+			if end < 0 {
+				end = len(source)
+			} else {
+				end += i
+			}
+
+			blank(stripped[i:end])
+			i = end - 1
+		}
+	}
+
+	return string(stripped)
+}
+
+// blank replaces everything but the newlines with spaces.
+func blank(b []byte) {
+	for i := range b {
+		if b[i] != '\n' {
+			b[i] = ' '
+		}
+	}
+}
+
+// matchingBrace returns the index of the brace that closes the one at open, or -1.
+func matchingBrace(s string, open int) int {
+	depth := 0
+	var quote byte
+
+	for i := open; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// closingBracket returns the index of the bracket that closes the condition at the start of s, or -1.
+func closingBracket(s string) int {
+	var quote byte
+
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ']':
+			return i
+		}
+	}
+
+	return -1
+}
+
+// splitOutside splits s on the separator, except in quotes, brackets and parentheses, so that
+// selectors and values like rgb(1, 2, 3) aren't split.
+func splitOutside(s string, separator byte) []string {
+	parts := make([]string, 0)
+	depth, start := 0, 0
+	var quote byte
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case c == separator && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// unquote removes the quotes around a string, if it has them.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
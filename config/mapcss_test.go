@@ -0,0 +1,246 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/samber/lo"
+)
+
+func TestMapCSSCasingWidth(t *testing.T) {
+	c := &Config{}
+
+	// The casing is set before the width of the line, which it still follows.
+	if err := c.ParseMapCSS([]byte(`way[highway=primary] { casing-width: 1; casing-color: #c0a070; width: 5; }`)); err != nil {
+		t.Fatal(err)
+	}
+
+	style := &c.GetStyles().Styles[0]
+
+	if got := style.CasingWidthAtZoom(10); got != 7 {
+		t.Errorf("got a casing width of %v, want 7", got)
+	}
+
+	// The width of the casing changes with the width of the line at the zoom level.
+	style.WidthStops = [][]float64{{10, 2}, {14, 10}}
+
+	for zoom, want := range map[float64]float64{8: 4, 12: 8, 16: 12} {
+		if got := style.CasingWidthAtZoom(zoom); got != want {
+			t.Errorf("got a casing width of %v at zoom %v, want %v", got, zoom, want)
+		}
+	}
+}
+
+func TestParseMapCSSSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     FeatureStyle
+		invalid  bool
+	}{
+		{
+			selector: "way[highway=primary]",
+			want:     FeatureStyle{Queries: []FeatureQuery{{"highway", "primary"}}, Layer: "default"},
+		},
+		{
+			selector: `area["landuse"='forest'][leisure?]`,
+			want:     FeatureStyle{Queries: []FeatureQuery{{"landuse", "forest"}}, Require: []FeatureQuery{{"leisure", "yes"}}, Layer: "default"},
+		},
+		{
+			selector: "way[highway][!tunnel][bridge!=yes]",
+			want: FeatureStyle{
+				Queries: []FeatureQuery{{"highway", "*"}},
+				Exclude: []FeatureQuery{{"tunnel", "*"}, {"bridge", "yes"}},
+				Layer:   "default",
+			},
+		},
+		{
+			selector: "way[!oneway!=yes][highway=primary]",
+			want: FeatureStyle{
+				Queries: []FeatureQuery{{"oneway", "yes"}, {"highway", "primary"}}[:1],
+				Require: []FeatureQuery{{"highway", "primary"}},
+				Layer:   "default",
+			},
+		},
+		{
+			selector: "way|z12-16[highway=primary]",
+			want:     FeatureStyle{Queries: []FeatureQuery{{"highway", "primary"}}, Layer: "default", MinZoom: 12, MaxZoom: 17},
+		},
+		{
+			selector: "way|z12-[highway=primary]",
+			want:     FeatureStyle{Queries: []FeatureQuery{{"highway", "primary"}}, Layer: "default", MinZoom: 12},
+		},
+		{
+			selector: "way|z-11[highway=primary]",
+			want:     FeatureStyle{Queries: []FeatureQuery{{"highway", "primary"}}, Layer: "default", MaxZoom: 12},
+		},
+		{
+			selector: "way|z14[highway=primary]",
+			want:     FeatureStyle{Queries: []FeatureQuery{{"highway", "primary"}}, Layer: "default", MinZoom: 14, MaxZoom: 15},
+		},
+		{
+			selector: "way[highway=primary]:closed::casing",
+			want:     FeatureStyle{Queries: []FeatureQuery{{"highway", "primary"}}, Layer: "casing", Additional: true},
+		},
+		{selector: "way|zx[highway=primary]", invalid: true},
+		{selector: "way[highway=primary", invalid: true},
+		{selector: "way[name=~/foo/]", invalid: true},
+		{selector: "way::", invalid: true},
+		{selector: "way", invalid: true},
+		{selector: "node[amenity]", invalid: true},
+		{selector: "line[highway]", invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.selector, func(t *testing.T) {
+			got, err := parseMapCSSSelector(test.selector)
+
+			if test.invalid {
+				if err == nil {
+					t.Errorf("got %+v, want an error", got)
+				}
+
+				return
+			} else if err != nil {
+				t.Fatalf("got the error %v", err)
+			}
+
+			// Only the conditions and the layer are set, and empty lists are the same as none.
+			conditions := func(style FeatureStyle) string {
+				return fmt.Sprintf("%v %v %v %s %t %v-%v", style.Queries, style.Require, style.Exclude,
+					style.Layer, style.Additional, style.MinZoom, style.MaxZoom)
+			}
+
+			if got, want := conditions(got), conditions(test.want); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestMapCSSProblems(t *testing.T) {
+	c := &Config{}
+	err := c.ParseMapCSS([]byte(`meta { title: "Test"; }
+@media print { way[highway] { width: 1; } }
+node[amenity] { width: 3; }
+way[highway=primary] {
+  bogus: 3;
+  width: wide;
+  color red;
+}
+canvas { text: auto; }
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Problem{
+		{Line: 2, Message: "@media blocks aren't supported, so they're skipped", Warning: true},
+		{Line: 3, Message: "the selector node[amenity] was skipped: nodes aren't drawn", Warning: true},
+		{Line: 5, Message: "bogus: the property isn't supported", Warning: true},
+		{Line: 6, Message: `width: strconv.ParseFloat: parsing "wide": invalid syntax`, Warning: true},
+		{Line: 7, Message: `the declaration "color red" has no value`, Warning: true},
+		{Line: 9, Message: "the property text of the canvas isn't supported", Warning: true},
+	}
+
+	if got := c.Validate(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got the problems\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestMapCSSSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		source, want string
+	}{
+		{"way[highway] { width: 1;", "line 1: the rule isn't closed"},
+		{"\n{ width: 1; }", "line 2: the rule has no selector"},
+		{"way[highway] { width: 1; }\nway", `line 2: unexpected "way"`},
+	}
+
+	for _, test := range tests {
+		c := &Config{}
+
+		if err := c.ParseMapCSS([]byte(test.source)); err == nil || err.Error() != test.want {
+			t.Errorf("%q got the error %v, want %s", test.source, err, test.want)
+		}
+	}
+}
+
+// cascaded returns the styles that the tags are drawn with at the zoom level.
+func cascaded(c *Config, tags map[string]string, zoom float64) []*FeatureStyle {
+	matches := make([]StyleMatch, 0)
+
+	for _, match := range c.Match(tags, 1) {
+		if match.Style.UsedAtZoom(zoom) {
+			matches = append(matches, match)
+		}
+	}
+
+	return lo.Map(c.SelectStyles(matches), func(match StyleMatch, _ int) *FeatureStyle {
+		return match.Style
+	})
+}
+
+func TestMapCSSCascade(t *testing.T) {
+	c := &Config{}
+	err := c.ParseMapCSS([]byte(`
+way|z12-[highway=primary][!tunnel] { width: 4; color: #f2935c; z-index: 3; }
+way[highway=primary]::casing { width: 6; color: #8d4a1f; }
+way[highway=primary] { color: red; }
+way[bridge=yes] { dashes: 4, 2; }
+way[highway=primary]::casing { color: black; }
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	primary := map[string]string{"highway": "primary"}
+	styles := cascaded(c, primary, 14)
+
+	if len(styles) != 2 {
+		t.Fatalf("got %d styles, want the road and its casing", len(styles))
+	}
+
+	road, casing := styles[0], styles[1]
+
+	// The later rule only overrides the color, and the width and the z-index of the earlier one stay.
+	if road.StrokeColor != "red" || road.WidthAtZoom(14) != 4 || road.ZIndex != 3 || road.Additional {
+		t.Errorf("got the road %+v", road)
+	}
+
+	// The casing has the default z-index, so it's drawn under the road.
+	if casing.StrokeColor != "black" || casing.WidthAtZoom(14) != 6 || casing.ZIndex != 0 || !casing.Additional {
+		t.Errorf("got the casing %+v", casing)
+	}
+
+	if road.Layer != casing.Layer {
+		t.Errorf("the road is in the layer %s and the casing in %s, want one layer", road.Layer, casing.Layer)
+	}
+
+	// Below zoom 12, and in tunnels, only the rules without a zoom range or a negation match.
+	for _, tags := range []map[string]string{primary, {"highway": "primary", "tunnel": "yes"}} {
+		zoom := 10.0
+
+		if len(tags) > 1 {
+			zoom = 14
+		}
+
+		if road := cascaded(c, tags, zoom)[0]; road.StrokeColor != "red" || road.WidthAtZoom(zoom) != 1 || road.ZIndex != 0 {
+			t.Errorf("got the road %+v for %v at zoom %v", road, tags, zoom)
+		}
+	}
+
+	// Rules with other conditions add their properties.
+	bridge := cascaded(c, map[string]string{"highway": "primary", "bridge": "yes"}, 14)[0]
+
+	if bridge.StrokeColor != "red" || bridge.WidthAtZoom(14) != 4 || len(bridge.DashArray) != 2 {
+		t.Errorf("got the bridge %+v", bridge)
+	}
+
+	// The features with the same matches share their style.
+	if again := cascaded(c, map[string]string{"highway": "primary", "name": "Main Street"}, 14); again[0] != road {
+		t.Errorf("got another style for the same matches")
+	}
+}
@@ -0,0 +1,453 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// mapLibreStyle is the part of a MapLibre (or Mapbox GL) style that's imported.
+// https://maplibre.org/maplibre-style-spec/
+type mapLibreStyle struct {
+	Layers []mapLibreLayer `json:"layers"`
+}
+
+type mapLibreLayer struct {
+	ID      string                 `json:"id"`
+	Type    string                 `json:"type"`
+	Filter  interface{}            `json:"filter"`
+	MinZoom float64                `json:"minzoom"`
+	MaxZoom float64                `json:"maxzoom"`
+	Layout  map[string]interface{} `json:"layout"`
+	Paint   map[string]interface{} `json:"paint"`
+}
+
+// conditions are the queries, the required tags and the excluded tags that a filter turns into.
+type conditions struct {
+	queries []FeatureQuery
+	require []FeatureQuery
+	exclude []FeatureQuery
+}
+
+// ParseMapLibre imports the fill, line and background layers of a MapLibre style. Every layer
+// becomes a layer of the styles with one style, so they're drawn in the same order, and the widths
+// of the lines are interpolated at the zoom level of the map. The filters need to compare the tags
+// of the features, so styles for OSM data work, but styles for vector tile schemas don't. The layers
+// that can't be imported are reported by Validate.
+func (c *Config) ParseMapLibre(source []byte) error {
+	var style mapLibreStyle
+
+	if err := json.Unmarshal(source, &style); err != nil {
+		return err
+	}
+
+	styleConfig := &StyleConfig{}
+	c.importProblems = nil
+
+	for _, layer := range style.Layers {
+		properties := &mapLibreProperties{}
+
+		if err := importMapLibreLayer(styleConfig, layer, properties); err != nil {
+			c.importProblems = append(c.importProblems, Problem{
+				Message: fmt.Sprintf("the layer %q was skipped: %s", layer.ID, err),
+				Warning: true,
+			})
+			continue
+		}
+
+		for _, skipped := range properties.skipped {
+			c.importProblems = append(c.importProblems, Problem{
+				Message: fmt.Sprintf("the layer %q was imported without %s", layer.ID, skipped),
+				Warning: true,
+			})
+		}
+	}
+
+	c.useStyles(styleConfig)
+	// The keys of the JSON aren't the ones of the YAML, so they aren't checked.
+	c.source = nil
+	c.includedStyles = 0
+
+	return nil
+}
+
+// mapLibreProperties reads the paint and layout properties of a layer, and keeps the ones that have
+// values which can't be imported, like expressions that depend on the tags of the features.
+type mapLibreProperties struct {
+	skipped []string
+}
+
+// string returns the property if it's a string, like a color.
+func (p *mapLibreProperties) string(properties map[string]interface{}, name string) (string, bool) {
+	value, ok := properties[name]
+
+	if !ok {
+		return "", false
+	} else if s, ok := value.(string); ok {
+		return s, true
+	}
+
+	p.skip(name, value)
+
+	return "", false
+}
+
+// number returns the property if it's a number, like an opacity.
+func (p *mapLibreProperties) number(properties map[string]interface{}, name string) (float64, bool) {
+	value, ok := properties[name]
+
+	if !ok {
+		return 0, false
+	} else if n, ok := value.(float64); ok {
+		return n, true
+	}
+
+	p.skip(name, value)
+
+	return 0, false
+}
+
+func (p *mapLibreProperties) skip(name string, value interface{}) {
+	encoded, err := json.Marshal(value)
+
+	if err != nil {
+		encoded = []byte(fmt.Sprint(value))
+	}
+
+	p.skipped = append(p.skipped, fmt.Sprintf("%s, which has the unsupported value %s", name, encoded))
+}
+
+func importMapLibreLayer(styleConfig *StyleConfig, layer mapLibreLayer, properties *mapLibreProperties) error {
+	if layer.Type == "background" {
+		// The background is under everything, so it's the color of the land as well as the sea, which
+		// the styles usually draw as a fill layer.
+		if color, ok := properties.string(layer.Paint, "background-color"); ok {
+			styleConfig.FillColor = color
+			styleConfig.Land.FillColor = color
+		}
+
+		return nil
+	} else if layer.Type != "fill" && layer.Type != "line" {
+		return fmt.Errorf("%s layers aren't supported", layer.Type)
+	} else if layer.Filter == nil {
+		return errors.New("it has no filter, so it would match every feature")
+	}
+
+	filter, err := convertFilter(layer.Filter)
+
+	if err != nil {
+		return err
+	} else if len(filter.queries) == 0 {
+		return errors.New("its filter doesn't compare any tags")
+	}
+
+	// Every layer draws the features that match its filter, so the styles don't compete.
+	style := FeatureStyle{
+		Name:       layer.ID,
+		Queries:    filter.queries,
+		Require:    filter.require,
+		Exclude:    filter.exclude,
+		Additional: true,
+		Layer:      layer.ID,
+	}
+
+	if layer.Type == "fill" {
+		style.FillColor, _ = properties.string(layer.Paint, "fill-color")
+
+		if opacity, ok := properties.number(layer.Paint, "fill-opacity"); ok {
+			style.FillOpacity = &opacity
+		}
+
+		// The outlines of fills are always a pixel wide.
+		if outline, ok := properties.string(layer.Paint, "fill-outline-color"); ok {
+			style.StrokeColor = outline
+			style.WidthStops = [][]float64{{0, 1}}
+		}
+	} else {
+		style.StrokeColor, _ = properties.string(layer.Paint, "line-color")
+		style.LineCap, _ = properties.string(layer.Layout, "line-cap")
+		style.LineJoin, _ = properties.string(layer.Layout, "line-join")
+
+		if opacity, ok := properties.number(layer.Paint, "line-opacity"); ok {
+			style.StrokeOpacity = &opacity
+		}
+
+		// MapLibre draws lines a pixel wide by default.
+		style.WidthStops = [][]float64{{0, 1}}
+
+		if width, ok := layer.Paint["line-width"]; ok {
+			if style.WidthStops, style.WidthBase, err = convertStops(width); err != nil {
+				return err
+			}
+		}
+	}
+
+	styleConfig.Layers = append(styleConfig.Layers, Layer{
+		Name:    layer.ID,
+		Hidden:  layer.Layout["visibility"] == "none",
+		MinZoom: layer.MinZoom,
+		MaxZoom: layer.MaxZoom,
+	})
+	styleConfig.Styles = append(styleConfig.Styles, style)
+
+	return nil
+}
+
+// convertStops converts a number, a {"stops": ...} function or an interpolate expression on the zoom
+// level into width stops and their base.
+func convertStops(value interface{}) ([][]float64, float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return [][]float64{{0, v}}, 0, nil
+	case map[string]interface{}:
+		stops, ok := v["stops"].([]interface{})
+
+		if !ok {
+			return nil, 0, errors.New("the line width function has no stops")
+		}
+
+		base, _ := v["base"].(float64)
+		converted := make([][]float64, 0, len(stops))
+
+		for _, stop := range stops {
+			pair, ok := stop.([]interface{})
+
+			if !ok || len(pair) != 2 {
+				return nil, 0, errors.New("invalid line width stop")
+			}
+
+			zoom, zoomOk := pair[0].(float64)
+			width, widthOk := pair[1].(float64)
+
+			if !zoomOk || !widthOk {
+				return nil, 0, errors.New("invalid line width stop")
+			}
+
+			converted = append(converted, []float64{zoom, width})
+		}
+
+		return converted, base, nil
+	case []interface{}:
+		// ["interpolate", ["linear"] or ["exponential", base], ["zoom"], zoom, width, ...]
+		if len(v) < 5 || v[0] != "interpolate" || fmt.Sprint(v[2]) != "[zoom]" {
+			return nil, 0, fmt.Errorf("unsupported line width expression %v", v)
+		}
+
+		base := 0.0
+
+		if interpolation, ok := v[1].([]interface{}); ok && len(interpolation) == 2 && interpolation[0] == "exponential" {
+			base, _ = interpolation[1].(float64)
+		}
+
+		converted := make([][]float64, 0, (len(v)-3)/2)
+
+		for i := 3; i+1 < len(v); i += 2 {
+			zoom, zoomOk := v[i].(float64)
+			width, widthOk := v[i+1].(float64)
+
+			if !zoomOk || !widthOk {
+				return nil, 0, fmt.Errorf("unsupported line width expression %v", v)
+			}
+
+			converted = append(converted, []float64{zoom, width})
+		}
+
+		return converted, base, nil
+	}
+
+	return nil, 0, fmt.Errorf("unsupported line width %v", value)
+}
+
+// convertFilter converts a filter, in either the legacy syntax or the expression one, into the
+// conditions of a style. Only the filters that the queries of the styles can express are supported:
+// any number of required tags, and one list of alternatives.
+func convertFilter(filter interface{}) (conditions, error) {
+	if filter == true {
+		return conditions{}, nil
+	}
+
+	args, ok := filter.([]interface{})
+
+	if !ok || len(args) == 0 {
+		return conditions{}, fmt.Errorf("unsupported filter %v", filter)
+	}
+
+	op, _ := args[0].(string)
+
+	switch op {
+	case "all":
+		all := conditions{}
+
+		for _, arg := range args[1:] {
+			sub, err := convertFilter(arg)
+
+			if err != nil {
+				return conditions{}, err
+			}
+
+			all.require = append(all.require, sub.require...)
+			all.exclude = append(all.exclude, sub.exclude...)
+
+			if len(sub.queries) == 1 && len(all.queries) > 0 {
+				all.require = append(all.require, sub.queries[0])
+			} else if len(sub.queries) > 0 && len(all.queries) == 1 {
+				all.require = append(all.require, all.queries[0])
+				all.queries = sub.queries
+			} else if len(sub.queries) > 0 && len(all.queries) > 0 {
+				return conditions{}, errors.New("the filter has more than one list of alternatives")
+			} else if len(all.queries) == 0 {
+				all.queries = sub.queries
+			}
+		}
+
+		return all, nil
+	case "any":
+		any := conditions{}
+
+		for _, arg := range args[1:] {
+			sub, err := convertFilter(arg)
+
+			if err != nil {
+				return conditions{}, err
+			} else if len(sub.require) > 0 || len(sub.exclude) > 0 {
+				return conditions{}, errors.New("the alternatives of any can only be single tags")
+			}
+
+			any.queries = append(any.queries, sub.queries...)
+		}
+
+		return any, nil
+	case "==", "!=", "in", "!in", "has", "!has":
+		key, values, err := filterOperands(args)
+
+		if err != nil {
+			return conditions{}, err
+		} else if key == "$type" || key == "geometry-type" {
+			// The geometry comes from the type of the layer.
+			return conditions{}, nil
+		}
+
+		queries := make([]FeatureQuery, 0, len(values))
+
+		for _, value := range values {
+			queries = append(queries, FeatureQuery{Attribute: key, Value: value})
+		}
+
+		if strings.HasPrefix(op, "!") {
+			return conditions{exclude: queries}, nil
+		}
+
+		return conditions{queries: queries}, nil
+	case "match":
+		// ["match", ["get", key], value or [values], true, false]
+		if len(args) != 5 {
+			return conditions{}, errors.New("only match expressions with one list of values are supported")
+		}
+
+		key, ok := getterKey(args[1])
+
+		if !ok {
+			return conditions{}, fmt.Errorf("unsupported match input %v", args[1])
+		}
+
+		values := []interface{}{args[2]}
+
+		if list, ok := args[2].([]interface{}); ok {
+			values = list
+		}
+
+		queries := make([]FeatureQuery, 0, len(values))
+
+		for _, value := range values {
+			queries = append(queries, FeatureQuery{Attribute: key, Value: filterValue(value)})
+		}
+
+		if args[3] == true && args[4] == false {
+			return conditions{queries: queries}, nil
+		} else if args[3] == false && args[4] == true {
+			return conditions{exclude: queries}, nil
+		}
+
+		return conditions{}, errors.New("only match expressions that return true or false are supported")
+	}
+
+	return conditions{}, fmt.Errorf("unsupported filter %v", filter)
+}
+
+// filterOperands returns the key and the values of a comparison, e.g. ["==", "highway", "primary"],
+// ["==", ["get", "highway"], "primary"] or ["in", ["get", "highway"], ["literal", ["a", "b"]]].
+// The value of has is "*", which matches any value.
+func filterOperands(args []interface{}) (string, []string, error) {
+	if len(args) < 2 {
+		return "", nil, fmt.Errorf("unsupported filter %v", args)
+	}
+
+	key, ok := getterKey(args[1])
+
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported filter key %v", args[1])
+	}
+
+	op := strings.TrimPrefix(args[0].(string), "!")
+
+	if op == "has" {
+		return key, []string{"*"}, nil
+	}
+
+	rest := args[2:]
+
+	// The values of the expression syntax of in are in a literal.
+	if len(rest) == 1 {
+		if literal, ok := rest[0].([]interface{}); ok && len(literal) == 2 && literal[0] == "literal" {
+			if list, ok := literal[1].([]interface{}); ok {
+				rest = list
+			}
+		}
+	}
+
+	if len(rest) == 0 || (op == "==" && len(rest) != 1) {
+		return "", nil, fmt.Errorf("unsupported filter %v", args)
+	}
+
+	values := make([]string, 0, len(rest))
+
+	for _, value := range rest {
+		values = append(values, filterValue(value))
+	}
+
+	return key, values, nil
+}
+
+// getterKey returns the key of a legacy filter ("highway") or of a get expression (["get", "highway"]).
+func getterKey(arg interface{}) (string, bool) {
+	if key, ok := arg.(string); ok {
+		return key, true
+	}
+
+	if get, ok := arg.([]interface{}); ok && len(get) == 2 && get[0] == "get" {
+		key, ok := get[1].(string)
+		return key, ok
+	} else if ok && len(get) == 1 && get[0] == "geometry-type" {
+		return "geometry-type", true
+	}
+
+	return "", false
+}
+
+// filterValue formats a value of a filter the way that it's written in the tags.
+func filterValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "yes"
+		}
+
+		return "no"
+	}
+
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// decodeJSON decodes the JSON of a filter or a function, the way that the style is decoded.
+func decodeJSON(t *testing.T, s string) interface{} {
+	t.Helper()
+
+	var value interface{}
+
+	if err := json.Unmarshal([]byte(s), &value); err != nil {
+		t.Fatal(err)
+	}
+
+	return value
+}
+
+func TestConvertFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		// The queries, the required tags and the excluded tags.
+		want    string
+		invalid bool
+	}{
+		{filter: `["==", "highway", "primary"]`, want: "[{highway primary}] [] []"},
+		{filter: `["==", ["get", "highway"], "primary"]`, want: "[{highway primary}] [] []"},
+		{filter: `["!=", "bridge", true]`, want: "[] [] [{bridge yes}]"},
+		{filter: `["in", "highway", "primary", "secondary"]`, want: "[{highway primary} {highway secondary}] [] []"},
+		{filter: `["in", ["get", "highway"], ["literal", ["primary", "secondary"]]]`, want: "[{highway primary} {highway secondary}] [] []"},
+		{filter: `["!in", "access", "private", "no"]`, want: "[] [] [{access private} {access no}]"},
+		{filter: `["has", "name"]`, want: "[{name *}] [] []"},
+		{filter: `["!has", "tunnel"]`, want: "[] [] [{tunnel *}]"},
+		{filter: `["==", "$type", "LineString"]`, want: "[] [] []"},
+		{filter: `["==", ["geometry-type"], "Polygon"]`, want: "[] [] []"},
+		{filter: `["match", ["get", "highway"], ["primary", "trunk"], true, false]`, want: "[{highway primary} {highway trunk}] [] []"},
+		{filter: `["match", ["get", "layer"], 1, false, true]`, want: "[] [] [{layer 1}]"},
+		{
+			filter: `["all", ["==", "$type", "LineString"], ["in", "highway", "primary", "secondary"], ["==", "bridge", "yes"], ["!has", "tunnel"]]`,
+			want:   "[{highway primary} {highway secondary}] [{bridge yes}] [{tunnel *}]",
+		},
+		{
+			// The single tag is required, so the list of alternatives is the queries.
+			filter: `["all", ["==", "bridge", "yes"], ["in", "highway", "primary", "secondary"]]`,
+			want:   "[{highway primary} {highway secondary}] [{bridge yes}] []",
+		},
+		{filter: `["any", ["==", "natural", "wood"], ["==", "landuse", "forest"]]`, want: "[{natural wood} {landuse forest}] [] []"},
+		{filter: `["all", ["in", "highway", "a", "b"], ["in", "railway", "c", "d"]]`, invalid: true},
+		{filter: `["any", ["all", ["==", "a", "b"], ["==", "c", "d"]]]`, invalid: true},
+		{filter: `["match", ["get", "highway"], "primary", "red", "blue"]`, invalid: true},
+		{filter: `[">", "lanes", 2]`, invalid: true},
+		{filter: `"highway"`, invalid: true},
+	}
+
+	for _, test := range tests {
+		got, err := convertFilter(decodeJSON(t, test.filter))
+
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s: got no error", test.filter)
+			}
+
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %v", test.filter, err)
+			continue
+		}
+
+		if s := fmt.Sprintf("%v %v %v", got.queries, got.require, got.exclude); s != test.want {
+			t.Errorf("%s: got %s, want %s", test.filter, s, test.want)
+		}
+	}
+}
+
+func TestConvertStops(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantStops [][]float64
+		wantBase  float64
+		invalid   bool
+	}{
+		{value: `3`, wantStops: [][]float64{{0, 3}}},
+		{value: `{"stops": [[10, 1], [16, 8]]}`, wantStops: [][]float64{{10, 1}, {16, 8}}},
+		{value: `{"base": 1.4, "stops": [[10, 1], [16, 8]]}`, wantStops: [][]float64{{10, 1}, {16, 8}}, wantBase: 1.4},
+		{value: `["interpolate", ["linear"], ["zoom"], 10, 1, 16, 8]`, wantStops: [][]float64{{10, 1}, {16, 8}}},
+		{value: `["interpolate", ["exponential", 1.5], ["zoom"], 5, 0.5, 12, 2, 18, 20]`, wantStops: [][]float64{{5, 0.5}, {12, 2}, {18, 20}}, wantBase: 1.5},
+		{value: `{"base": 1.2}`, invalid: true},
+		{value: `{"stops": [[10]]}`, invalid: true},
+		{value: `["interpolate", ["linear"], ["get", "lanes"], 1, 2, 4, 8]`, invalid: true},
+		{value: `["interpolate", ["linear"], ["zoom"], 10, ["get", "width"]]`, invalid: true},
+		{value: `"wide"`, invalid: true},
+	}
+
+	for _, test := range tests {
+		stops, base, err := convertStops(decodeJSON(t, test.value))
+
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s: got no error", test.value)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", test.value, err)
+		} else if !reflect.DeepEqual(stops, test.wantStops) || base != test.wantBase {
+			t.Errorf("%s: got %v with the base %v, want %v with the base %v", test.value, stops, base, test.wantStops, test.wantBase)
+		}
+	}
+}
+
+func TestMapLibreUnsupportedPaint(t *testing.T) {
+	c := &Config{}
+	err := c.ParseMapLibre([]byte(`{"layers": [
+		{
+			"id": "roads",
+			"type": "line",
+			"filter": ["==", "highway", "primary"],
+			"paint": {
+				"line-color": ["match", ["get", "surface"], "unpaved", "#a08060", "#ffffff"],
+				"line-opacity": {"stops": [[10, 0.5], [14, 1]]},
+				"line-width": 2
+			}
+		},
+		{
+			"id": "water",
+			"type": "fill",
+			"filter": ["==", "natural", "water"],
+			"paint": {"fill-color": "#a0c8f0", "fill-opacity": 0.8}
+		}
+	]}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if styles := c.GetStyles().Styles; len(styles) != 2 || styles[0].StrokeColor != "" || styles[0].StrokeOpacity != nil {
+		t.Errorf("got the styles %+v, want both layers without the unsupported values", styles)
+	}
+
+	problems := c.Validate()
+	want := []string{
+		`the layer "roads" was imported without line-color, which has the unsupported value ["match",["get","surface"],"unpaved","#a08060","#ffffff"]`,
+		`the layer "roads" was imported without line-opacity, which has the unsupported value {"stops":[[10,0.5],[14,1]]}`,
+	}
+
+	for _, message := range want {
+		found := false
+
+		for _, problem := range problems {
+			found = found || (problem.Message == message && problem.Warning)
+		}
+
+		if !found {
+			t.Errorf("got the problems %v, want the warning %q", problems, message)
+		}
+	}
+}
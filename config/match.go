@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The specificity of a match on the id of a way, which beats any match on tags.
+const wayIdSpecificity = 1 << 10
+
+// StyleMatch is a style that matched a feature, along with the reason that it matched.
+type StyleMatch struct {
+	Style *FeatureStyle
+	// The position of the style in the style file, which breaks ties.
+	Index int
+	// The number of conditions that matched.
+	Specificity int
+	// The conditions that matched, e.g. "highway=primary, surface=paved".
+	Reason string
+	// The matches that were merged into the style, if it's the cascade of a MapCSS style sheet.
+	Merged []StyleMatch
+}
+
+func (m StyleMatch) String() string {
+	label := m.Style.Name
+
+	if len(label) == 0 {
+		label = "unnamed"
+	}
+
+	return fmt.Sprintf("style #%d (%s) on %s, priority %d, specificity %d", m.Index+1, label, m.Reason, m.Style.Priority, m.Specificity)
+}
+
+// Match returns all of the styles that match the tags or the id of a way, from the one that wins to
+// the one that loses. Styles with a higher priority win, then the ones with more conditions, and
+// then the ones that come first in the style file, so the order of the tags doesn't matter.
+func (c *Config) Match(tags map[string]string, wayId int64) []StyleMatch {
+	if c.matcher == nil {
+		return nil
+	}
+
+	matches := c.matcher.match(tags, wayId)
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+
+		if a.Style.Priority != b.Style.Priority {
+			return a.Style.Priority > b.Style.Priority
+		} else if a.Specificity != b.Specificity {
+			return a.Specificity > b.Specificity
+		}
+
+		return a.Index < b.Index
+	})
+
+	return matches
+}
+
+// SelectStyles returns the matches that are drawn: the first one that isn't additional, and all of
+// the additional ones, in the order that they're drawn in.
+func SelectStyles(matches []StyleMatch) []StyleMatch {
+	selected := make([]StyleMatch, 0, 1)
+	hasMain := false
+
+	for _, match := range matches {
+		if !match.Style.Additional {
+			if hasMain {
+				continue
+			}
+
+			hasMain = true
+		}
+
+		selected = append(selected, match)
+	}
+
+	// The main style goes first, so that additional ones with the same z-index are drawn over it.
+	sort.SliceStable(selected, func(i, j int) bool {
+		return !selected[i].Style.Additional && selected[j].Style.Additional
+	})
+
+	return selected
+}
+
+// matchRequired checks the tags that the style requires, on top of the query that the tags matched.
+func (fs *FeatureStyle) matchRequired(tags map[string]string, query FeatureQuery) (StyleMatch, bool) {
+	conditions := []string{query.Attribute + "=" + query.Value}
+
+	for _, required := range fs.Require {
+		if !required.Matches(tags) {
+			return StyleMatch{}, false
+		}
+
+		conditions = append(conditions, required.Attribute+"="+required.Value)
+	}
+
+	return StyleMatch{
+		Style:       fs,
+		Specificity: len(conditions),
+		Reason:      strings.Join(conditions, ", "),
+	}, true
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/samber/lo"
+)
+
+// matcher finds the styles of a feature from the tags that it has, rather than by checking every
+// style, so matching takes about the same time however many styles there are. It's built when the
+// styles are parsed.
+type matcher struct {
+	styles []FeatureStyle
+	// The indexes of the styles by the attribute and the value of their queries, where "*" is any
+	// value, in the order of the styles.
+	byTag map[string]map[string][]int
+	// The indexes of the styles by the ids in their way id queries.
+	byWayId map[int64][]int
+	// The indexes of the styles that exclude tags or ways.
+	excludedByTag map[string]map[string][]int
+	excludedWays  map[int64][]int
+}
+
+func newMatcher(styles []FeatureStyle) *matcher {
+	m := &matcher{
+		styles:        styles,
+		byTag:         make(map[string]map[string][]int),
+		byWayId:       make(map[int64][]int),
+		excludedByTag: make(map[string]map[string][]int),
+		excludedWays:  make(map[int64][]int),
+	}
+
+	for i, style := range styles {
+		for _, query := range lo.Uniq(style.Queries) {
+			addTagIndex(m.byTag, query, i)
+		}
+
+		for _, exclusion := range lo.Uniq(style.Exclude) {
+			addTagIndex(m.excludedByTag, exclusion, i)
+		}
+
+		for _, id := range lo.Uniq(style.WayIdQueries) {
+			m.byWayId[id] = append(m.byWayId[id], i)
+		}
+
+		for _, id := range lo.Uniq(style.WayIdExcludes) {
+			m.excludedWays[id] = append(m.excludedWays[id], i)
+		}
+	}
+
+	return m
+}
+
+func addTagIndex(index map[string]map[string][]int, query FeatureQuery, i int) {
+	if index[query.Attribute] == nil {
+		index[query.Attribute] = make(map[string][]int)
+	}
+
+	index[query.Attribute][query.Value] = append(index[query.Attribute][query.Value], i)
+}
+
+// first returns the first style with the query, which has to have exactly the value.
+func (m *matcher) first(attribute, value string) (*FeatureStyle, bool) {
+	if indexes := m.byTag[attribute][value]; len(indexes) > 0 {
+		return &m.styles[indexes[0]], true
+	}
+
+	return nil, false
+}
+
+// firstWithWayId returns the first style with a way id query for the id.
+func (m *matcher) firstWithWayId(wayId int64) (*FeatureStyle, bool) {
+	if indexes := m.byWayId[wayId]; len(indexes) > 0 {
+		return &m.styles[indexes[0]], true
+	}
+
+	return nil, false
+}
+
+// match returns the matches of the styles, in the order of the styles.
+func (m *matcher) match(tags map[string]string, wayId int64) []StyleMatch {
+	excluded := make(map[int]bool)
+
+	for _, i := range m.excludedWays[wayId] {
+		excluded[i] = true
+	}
+
+	for key, value := range tags {
+		if values, ok := m.excludedByTag[key]; ok {
+			for _, i := range values[value] {
+				excluded[i] = true
+			}
+
+			for _, i := range values["*"] {
+				excluded[i] = true
+			}
+		}
+	}
+
+	// The first query of every style that the tags match, since that's the one it matched on.
+	queries := make(map[int]FeatureQuery)
+	matches := make([]StyleMatch, 0)
+
+	for _, i := range m.byWayId[wayId] {
+		if !excluded[i] {
+			matches = append(matches, StyleMatch{
+				Style:       &m.styles[i],
+				Index:       i,
+				Specificity: wayIdSpecificity,
+				Reason:      fmt.Sprintf("way id %d", wayId),
+			})
+			excluded[i] = true
+		}
+	}
+
+	for key, value := range tags {
+		// The name and the website are never used for styling.
+		if key == "name" || key == "website" {
+			continue
+		}
+
+		values, ok := m.byTag[key]
+
+		if !ok {
+			continue
+		}
+
+		for _, query := range []FeatureQuery{{Attribute: key, Value: value}, {Attribute: key, Value: "*"}} {
+			for _, i := range values[query.Value] {
+				if excluded[i] {
+					continue
+				}
+
+				if _, ok := queries[i]; !ok || m.queryIndex(i, query) < m.queryIndex(i, queries[i]) {
+					queries[i] = query
+				}
+			}
+		}
+	}
+
+	for i, query := range queries {
+		if match, ok := m.styles[i].matchRequired(tags, query); ok {
+			match.Index = i
+			matches = append(matches, match)
+		}
+	}
+
+	sort.Slice(matches, func(a, b int) bool {
+		return matches[a].Index < matches[b].Index
+	})
+
+	return matches
+}
+
+// queryIndex returns the position of the query in the queries of the style.
+func (m *matcher) queryIndex(i int, query FeatureQuery) int {
+	return lo.IndexOf(m.styles[i].Queries, query)
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/osm"
+	"github.com/samber/lo"
+)
+
+var testAttributes = []string{"highway", "landuse", "surface", "building", "waterway", "name", "website"}
+var testValues = []string{"primary", "secondary", "forest", "yes", "paved", "river"}
+
+// randomQueries returns up to max queries, from a small set of tags so that they often match, and
+// sometimes with any value.
+func randomQueries(r *rand.Rand, max int) []FeatureQuery {
+	queries := make([]FeatureQuery, r.Intn(max+1))
+
+	for i := range queries {
+		queries[i] = FeatureQuery{
+			Attribute: testAttributes[r.Intn(len(testAttributes))],
+			Value:     testValues[r.Intn(len(testValues))],
+		}
+
+		if r.Intn(5) == 0 {
+			queries[i].Value = "*"
+		}
+	}
+
+	return queries
+}
+
+func randomIds(r *rand.Rand, max int) []int64 {
+	ids := make([]int64, r.Intn(max+1))
+
+	for i := range ids {
+		ids[i] = int64(r.Intn(50))
+	}
+
+	return ids
+}
+
+// randomStyles returns the styles with random queries, way ids, exclusions and requirements, with
+// repeated queries too.
+func randomStyles(r *rand.Rand, n int) []FeatureStyle {
+	styles := make([]FeatureStyle, n)
+
+	for i := range styles {
+		styles[i] = FeatureStyle{
+			Name:          fmt.Sprintf("style %d", i),
+			Queries:       randomQueries(r, 3),
+			WayIdQueries:  randomIds(r, 1),
+			WayIdExcludes: randomIds(r, 1),
+			Exclude:       randomQueries(r, 1),
+			Require:       randomQueries(r, 1),
+			Priority:      r.Intn(3),
+		}
+
+		if len(styles[i].Queries) > 1 && r.Intn(4) == 0 {
+			styles[i].Queries = append(styles[i].Queries, styles[i].Queries[0])
+		}
+	}
+
+	return styles
+}
+
+func randomTags(r *rand.Rand) map[string]string {
+	tags := make(map[string]string)
+
+	for _, query := range randomQueries(r, 4) {
+		if query.Value == "*" {
+			query.Value = "other"
+		}
+
+		tags[query.Attribute] = query.Value
+	}
+
+	return tags
+}
+
+// linearMatch is how the styles were matched before they were indexed: every style is checked, and
+// it matches on its way id, or otherwise on the first of its queries that the tags match.
+func linearMatch(styles []FeatureStyle, tags map[string]string, wayId int64) []StyleMatch {
+	matches := make([]StyleMatch, 0)
+
+	for i := range styles {
+		style := &styles[i]
+
+		if style.ShouldExclude(tags, osm.WayID(wayId)) {
+			continue
+		}
+
+		if lo.Contains(style.WayIdQueries, wayId) {
+			matches = append(matches, StyleMatch{
+				Style:       style,
+				Index:       i,
+				Specificity: wayIdSpecificity,
+				Reason:      fmt.Sprintf("way id %d", wayId),
+			})
+			continue
+		}
+
+		query, ok := lo.Find(style.Queries, func(q FeatureQuery) bool {
+			return q.Attribute != "name" && q.Attribute != "website" && q.Matches(tags)
+		})
+
+		if !ok {
+			continue
+		}
+
+		if match, ok := style.matchRequired(tags, query); ok {
+			match.Index = i
+			matches = append(matches, match)
+		}
+	}
+
+	return matches
+}
+
+func TestMatcherMatchesLikeLinearScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for run := 0; run < 50; run++ {
+		styles := randomStyles(r, 1+r.Intn(40))
+		m := newMatcher(styles)
+
+		for i := 0; i < 200; i++ {
+			tags := randomTags(r)
+			wayId := int64(r.Intn(60))
+			want := linearMatch(styles, tags, wayId)
+
+			if got := m.match(tags, wayId); !reflect.DeepEqual(got, want) {
+				t.Fatalf("for the tags %v and the way %d with the styles %+v:\ngot  %v\nwant %v", tags, wayId, styles, got, want)
+			}
+		}
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	styles := []FeatureStyle{
+		{Name: "any highway", Queries: []FeatureQuery{{"highway", "*"}}, Exclude: []FeatureQuery{{"highway", "primary"}}},
+		{Name: "primary", Queries: []FeatureQuery{{"surface", "paved"}, {"highway", "primary"}}},
+		{Name: "paved primary", Queries: []FeatureQuery{{"highway", "primary"}}, Require: []FeatureQuery{{"surface", "*"}}},
+		{Name: "way 7", WayIdQueries: []int64{7}, Queries: []FeatureQuery{{"highway", "primary"}}},
+		{Name: "not way 7", Queries: []FeatureQuery{{"highway", "*"}}, WayIdExcludes: []int64{7}},
+		{Name: "named", Queries: []FeatureQuery{{"name", "*"}}},
+	}
+
+	tests := []struct {
+		name  string
+		tags  map[string]string
+		wayId int64
+		// The names of the styles and the reasons that they matched.
+		want []string
+	}{
+		{"no tags", map[string]string{}, 1, []string{}},
+		{"any value", map[string]string{"highway": "track"}, 1, []string{"any highway: highway=*", "not way 7: highway=*"}},
+		{
+			name:  "excluded value",
+			tags:  map[string]string{"highway": "primary"},
+			wayId: 1,
+			want:  []string{"primary: highway=primary", "way 7: highway=primary", "not way 7: highway=*"},
+		},
+		{
+			name:  "the first query that matches",
+			tags:  map[string]string{"highway": "primary", "surface": "paved"},
+			wayId: 1,
+			want: []string{
+				"primary: surface=paved",
+				"paved primary: highway=primary, surface=*",
+				"way 7: highway=primary",
+				"not way 7: highway=*",
+			},
+		},
+		{
+			name:  "way id",
+			tags:  map[string]string{"highway": "track"},
+			wayId: 7,
+			want:  []string{"any highway: highway=*", "way 7: way id 7"},
+		},
+		{"name isn't used", map[string]string{"name": "Main Street"}, 1, []string{}},
+	}
+
+	m := newMatcher(styles)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := lo.Map(m.match(test.tags, test.wayId), func(match StyleMatch, _ int) string {
+				return match.Style.Name + ": " + match.Reason
+			})
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQueryLikeLinearScan(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	styles := randomStyles(r, 100)
+	c := &Config{}
+	c.useStyles(&StyleConfig{Styles: styles})
+
+	for _, attribute := range testAttributes {
+		for _, value := range append(testValues, "*", "other") {
+			want, wantOk := lo.Find(styles, func(fs FeatureStyle) bool {
+				return lo.Contains(fs.Queries, FeatureQuery{Attribute: attribute, Value: value})
+			})
+			got, err := c.Query(attribute, value)
+
+			if wantOk != (err == nil) || (wantOk && got.Name != want.Name) {
+				t.Errorf("Query(%q, %q) got %v, %v, want %s", attribute, value, got, err, want.Name)
+			}
+		}
+	}
+
+	for wayId := int64(0); wayId < 60; wayId++ {
+		want, wantOk := lo.Find(styles, func(fs FeatureStyle) bool {
+			return lo.Contains(fs.WayIdQueries, wayId)
+		})
+		got, err := c.QueryId(wayId)
+
+		if wantOk != (err == nil) || (wantOk && got.Name != want.Name) {
+			t.Errorf("QueryId(%d) got %v, %v, want %s", wayId, got, err, want.Name)
+		}
+	}
+}
+
+// benchmarkData returns a config with many styles and the tags of many ways, like a detailed style
+// file and a large extract. Most of the styles are for their own tag, the way that style files are
+// written, and some of them are for any value or have exclusions and requirements.
+func benchmarkData() (*Config, []map[string]string) {
+	r := rand.New(rand.NewSource(3))
+	tag := func() FeatureQuery {
+		return FeatureQuery{Attribute: fmt.Sprintf("key%d", r.Intn(40)), Value: fmt.Sprintf("value%d", r.Intn(20))}
+	}
+	styles := make([]FeatureStyle, 400)
+
+	for i := range styles {
+		styles[i] = FeatureStyle{Queries: []FeatureQuery{tag()}, Priority: r.Intn(3)}
+
+		switch r.Intn(10) {
+		case 0:
+			styles[i].Queries[0].Value = "*"
+		case 1:
+			styles[i].Exclude = []FeatureQuery{tag()}
+		case 2:
+			styles[i].Require = []FeatureQuery{tag()}
+		}
+	}
+
+	c := &Config{}
+	c.useStyles(&StyleConfig{Styles: styles})
+	ways := make([]map[string]string, 10000)
+
+	for i := range ways {
+		ways[i] = make(map[string]string)
+
+		for j := 0; j < 1+r.Intn(4); j++ {
+			query := tag()
+			ways[i][query.Attribute] = query.Value
+		}
+	}
+
+	return c, ways
+}
+
+func BenchmarkMatch(b *testing.B) {
+	c, ways := benchmarkData()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for j, tags := range ways {
+			c.Match(tags, int64(j))
+		}
+	}
+}
+
+func BenchmarkLinearMatch(b *testing.B) {
+	c, ways := benchmarkData()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for j, tags := range ways {
+			linearMatch(c.styleConfig.Styles, tags, int64(j))
+		}
+	}
+}
+
+func BenchmarkQuery(b *testing.B) {
+	c, ways := benchmarkData()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, tags := range ways {
+			for attribute, value := range tags {
+				c.Query(attribute, value)
+			}
+		}
+	}
+}
+
+func BenchmarkQueryId(b *testing.B) {
+	c, ways := benchmarkData()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for j := range ways {
+			c.QueryId(int64(j))
+		}
+	}
+}
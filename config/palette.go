@@ -0,0 +1,68 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// isColorKey returns whether the YAML key holds a color.
+func isColorKey(key string) bool {
+	return key == "color" || strings.HasSuffix(key, "_color")
+}
+
+// yamlName returns the YAML key of the field, which is its lowercase name unless its tag sets it.
+func yamlName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+
+	if len(name) == 0 {
+		name = strings.ToLower(field.Name)
+	}
+
+	return name
+}
+
+// paletteColor returns the color of a palette name, following names that refer to other names, or
+// the string itself if it isn't a name in the palette.
+func paletteColor(palette map[string]string, colorStr string) string {
+	// The limit stops names that refer to each other.
+	for i := 0; i <= len(palette); i++ {
+		value, ok := palette[strings.TrimSpace(colorStr)]
+
+		if !ok {
+			break
+		}
+
+		colorStr = value
+	}
+
+	return colorStr
+}
+
+// resolvePalette replaces the names of the palette in all of the color fields of the value with
+// their colors.
+func resolvePalette(v reflect.Value, palette map[string]string) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			resolvePalette(v.Elem(), palette)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			resolvePalette(v.Index(i), palette)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+
+			if !field.IsExported() {
+				continue
+			}
+
+			if field.Type.Kind() == reflect.String && isColorKey(yamlName(field)) {
+				v.Field(i).SetString(paletteColor(palette, v.Field(i).String()))
+			} else {
+				resolvePalette(v.Field(i), palette)
+			}
+		}
+	}
+}
@@ -1,32 +1,140 @@
 package config
 
 import (
+	"math"
+
 	"github.com/paulmach/osm"
 	"github.com/samber/lo"
 )
 
+// FeatureQuery matches features by one of their tags. A value of "*" matches any value.
 type FeatureQuery struct {
 	Attribute string
 	Value     string
 }
 
+// Matches returns whether the tags have the tag of the query.
+func (q FeatureQuery) Matches(tags map[string]string) bool {
+	v, ok := tags[q.Attribute]
+	return ok && (q.Value == "*" || v == q.Value)
+}
+
+// MaxZIndex is the largest z-index that a style can have, and minus it is the smallest one. Every
+// layer of the styles is drawn in a range of z-indexes of its own, which is twice as large.
+const MaxZIndex = 1<<11 - 1
+
 type FeatureStyle struct {
-	Queries       []FeatureQuery
+	// The label of the style in the legend.
+	Name    string
+	Queries []FeatureQuery
+	// The name of a style that this one inherits everything from, except for its name and queries.
+	Extends       string
 	WayIdQueries  []int64        `yaml:"way_id_queries"`
 	WayIdExcludes []int64        `yaml:"way_id_excludes"`
 	Exclude       []FeatureQuery `yaml:"exclude"`
-	StrokeWidth   float64        `yaml:"stroke_width"`
-	StrokeColor   string         `yaml:"stroke_color"`
-	FillColor     string         `yaml:"fill_color"`
-	ZIndex        int            `yaml:"z_index"`
-	Dashed        bool
+	// Tags that features also need to have for the style to match, on top of one of the queries.
+	// Every one of them makes the style more specific, so it beats styles with fewer conditions.
+	Require []FeatureQuery
+	// When several styles match a feature, the one with the highest priority is drawn.
+	Priority int
+	// An additional style is drawn along with the style that wins, instead of competing with it,
+	// e.g. for drawing an outline over a fill.
+	Additional  bool
+	StrokeWidth float64 `yaml:"stroke_width"`
+	// The width of the stroke in pixels at zoom levels, as pairs of a zoom level and a width, which
+	// overrides the stroke width. The width is interpolated at the zoom level of the map, the way
+	// that web maps do it, and a pixel is a 96th of an inch. The dashes and the width of the casing
+	// of a style with width stops are in pixels too.
+	WidthStops [][]float64 `yaml:"width_stops"`
+	// The base of the exponential interpolation between the width stops, which is linear if it's 0
+	// or 1.
+	WidthBase   float64 `yaml:"width_base"`
+	StrokeColor string  `yaml:"stroke_color"`
+	FillColor   string  `yaml:"fill_color"`
+	ZIndex      int     `yaml:"z_index"`
+	// Dashed draws dashes as long as the width of the line. DashArray takes precedence over it.
+	Dashed bool
+	// The lengths of the dashes and of the gaps between them, in the same units as the stroke width.
+	DashArray  []float64 `yaml:"dash_array"`
+	DashOffset float64   `yaml:"dash_offset"`
+	// The shape of the ends of lines: butt (the default), round or square.
+	LineCap string `yaml:"line_cap"`
+	// The shape of the corners of lines: miter (the default), miter-clip, round, bevel or arcs.
+	LineJoin string `yaml:"line_join"`
+	// How far miter joins can reach, as a multiple of the half of the stroke width (4 by default).
+	MiterLimit float64 `yaml:"miter_limit"`
+	Casing     *CasingStyle
+	// The opacity of the fill and of the stroke, from 0 to 1. They're opaque if they're not set.
+	FillOpacity   *float64     `yaml:"fill_opacity"`
+	StrokeOpacity *float64     `yaml:"stroke_opacity"`
+	FillPattern   *FillPattern `yaml:"fill_pattern"`
+	// The tag whose value labels the features, e.g. name. The labels are drawn over everything, in
+	// the middle of the features.
+	Text      string
+	TextColor string `yaml:"text_color"`
+	// The size of the labels in points (8 by default).
+	TextSize float64 `yaml:"text_size"`
+	// The name of the layer that the style is drawn in. Styles that aren't in a layer are drawn
+	// under all of the layers.
+	Layer string
+	// The style is used from MinZoom up to, but not including, MaxZoom, and other styles can match
+	// the features at the rest of the zoom levels. A MaxZoom of 0 means that there's no maximum.
+	MinZoom float64 `yaml:"min_zoom"`
+	MaxZoom float64 `yaml:"max_zoom"`
+}
+
+// Layer is a named group of styles. Layers are drawn in the order that they're listed in, and the
+// z-indexes of the styles only order the features within their layer.
+type Layer struct {
+	Name string
+	// Hidden layers aren't drawn at all.
+	Hidden bool
+	// The layer is drawn from MinZoom up to, but not including, MaxZoom. A MaxZoom of 0 means that
+	// there's no maximum.
+	MinZoom float64 `yaml:"min_zoom"`
+	MaxZoom float64 `yaml:"max_zoom"`
+	// The opacity of the whole layer, from 0 to 1, which the opacities of its styles are multiplied
+	// by. The layer is opaque if it's not set.
+	Opacity *float64
+}
+
+// FillPattern fills areas with a pattern, which is drawn over their fill color and under their
+// outline. The dimensions are in millimetres on the page, so that the pattern looks the same at
+// every scale.
+type FillPattern struct {
+	// Either hatch, cross-hatch, dots or image.
+	Type  string
+	Color string
+	// The distance between the lines or the dots.
+	Spacing float64
+	// The width of the lines, or the diameter of the dots.
+	Size float64
+	// The angle of the lines in degrees, counter-clockwise from the horizontal.
+	Angle float64
+	// A PNG or SVG file that's tiled over the area, for image patterns. Relative paths are relative
+	// to the style file.
+	Image string
+}
+
+// CasingStyle draws a wider line under a line, which outlines it the way that roads are drawn on
+// most maps.
+type CasingStyle struct {
+	// The full width of the casing, which needs to be wider than the line to be visible.
+	Width float64
+	// The width of the casing on each side of the line, as in MapCSS. It's used instead of Width if
+	// it's set, and the casing then follows the width of the line at every zoom level.
+	SideWidth float64 `yaml:"side_width"`
+	Color     string
+	// The z-index of the casing, which is one less than the one of the line if it's not set, so
+	// that the casings of crossing roads are hidden under their lines.
+	ZIndex *int `yaml:"z_index"`
 }
 
 // ShouldExclude takes in a map of tags (from an OSM Way) and returns whether the style should
 // be excluded or not.
 func (fs *FeatureStyle) ShouldExclude(tagMap map[string]string, wayID osm.WayID) bool {
 	for _, exclusion := range fs.Exclude {
-		if v, ok := tagMap[exclusion.Attribute]; ok && v == exclusion.Value {
+		if exclusion.Matches(tagMap) {
 			return true
 		}
 	}
@@ -44,9 +152,138 @@ type LandStyle struct {
 	StrokeColor string  `yaml:"stroke_color"`
 }
 
+// The positions of the map furniture are the corners of the map: top-left, top-right, bottom-left
+// or bottom-right. Items in the same corner are stacked.
+
+type ScaleBarStyle struct {
+	Position string
+	// Either metric, imperial or both.
+	Units string
+}
+
+type NorthArrowStyle struct {
+	Position string
+}
+
+type AttributionStyle struct {
+	Position string
+	Text     string
+}
+
+type LegendStyle struct {
+	Position string
+	Title    string
+}
+
+// Furniture configures the marginalia of printed maps. Items that are missing aren't drawn.
+type Furniture struct {
+	ScaleBar    *ScaleBarStyle    `yaml:"scale_bar"`
+	NorthArrow  *NorthArrowStyle  `yaml:"north_arrow"`
+	Attribution *AttributionStyle `yaml:"attribution"`
+	Legend      *LegendStyle      `yaml:"legend"`
+}
+
+// GraticuleStyle draws lines of latitude and longitude over the map. The width of the lines is in
+// millimetres on the page, unlike the widths of the features.
+type GraticuleStyle struct {
+	// The degrees between the lines. It's chosen from the size of the map if it's 0.
+	Interval    float64
+	StrokeColor string  `yaml:"stroke_color"`
+	StrokeWidth float64 `yaml:"stroke_width"`
+	HideLabels  bool    `yaml:"hide_labels"`
+}
+
+// GridStyle draws a UTM grid over the map, for navigating with the coordinates of a GPS.
+type GridStyle struct {
+	// The metres between the lines. It's chosen from the size of the map if it's 0.
+	Interval float64
+	// The UTM zone of the grid. The zone of the center of the map is used if it's 0.
+	Zone        int
+	StrokeColor string  `yaml:"stroke_color"`
+	StrokeWidth float64 `yaml:"stroke_width"`
+	HideLabels  bool    `yaml:"hide_labels"`
+}
+
 type StyleConfig struct {
+	// Other style files that are merged under this one, with their styles and layers first. Relative
+	// paths are relative to this file, and so are the images of the fill patterns in the included
+	// files, unless they're set with a variable.
+	Include []string
+	// Values that can be used anywhere in the styles as $name, e.g. for widths and colors.
+	Variables map[string]interface{}
+	// Colors by their names, which can be used instead of the colors anywhere in the styles.
+	Palette   map[string]string
 	FillColor string `yaml:"fill_color"`
 	Land      LandStyle
 	ShowAll   bool `yaml:"show_all"`
 	Styles    []FeatureStyle
+	// The land polygons are drawn in the layer called "land", if there is one.
+	Layers    []Layer
+	Furniture Furniture
+	Graticule *GraticuleStyle
+	Grid      *GridStyle
+	// The opacity of all of the features that are drawn with these styles, from 0 to 1.
+	Opacity *float64
+	// The image format of the tiles that are rendered with these styles (e.g. png, jpeg or webp),
+	// and the quality of the lossy formats.
+	Format  string
+	Quality int
+}
+
+// UsedAtZoom returns whether the style is used at the zoom level.
+func (fs *FeatureStyle) UsedAtZoom(zoom float64) bool {
+	return zoom >= fs.MinZoom && (fs.MaxZoom <= 0 || zoom < fs.MaxZoom)
+}
+
+// CasingWidthAtZoom returns the full width of the casing at the zoom level, in the units of the
+// width of the line, or 0 if there's no casing.
+func (fs *FeatureStyle) CasingWidthAtZoom(zoom float64) float64 {
+	if fs.Casing == nil {
+		return 0
+	} else if fs.Casing.SideWidth <= 0 {
+		return fs.Casing.Width
+	}
+
+	lineWidth := fs.StrokeWidth
+
+	if len(fs.WidthStops) > 0 {
+		lineWidth = fs.WidthAtZoom(zoom)
+	}
+
+	return math.Max(0, lineWidth) + 2*fs.Casing.SideWidth
+}
+
+// WidthAtZoom interpolates the width stops at the zoom level, in pixels.
+func (fs *FeatureStyle) WidthAtZoom(zoom float64) float64 {
+	stops := lo.Filter(fs.WidthStops, func(stop []float64, _ int) bool {
+		return len(stop) == 2
+	})
+
+	if len(stops) == 0 {
+		return 0
+	} else if zoom <= stops[0][0] {
+		return stops[0][1]
+	}
+
+	for i := 1; i < len(stops); i++ {
+		z0, w0 := stops[i-1][0], stops[i-1][1]
+		z1, w1 := stops[i][0], stops[i][1]
+
+		if zoom > z1 {
+			continue
+		} else if z1 == z0 {
+			return w1
+		}
+
+		// https://maplibre.org/maplibre-style-spec/expressions/#interpolate
+		t := (zoom - z0) / (z1 - z0)
+
+		if fs.WidthBase > 0 && fs.WidthBase != 1 {
+			t = (math.Pow(fs.WidthBase, zoom-z0) - 1) / (math.Pow(fs.WidthBase, z1-z0) - 1)
+		}
+
+		return w0 + (w1-w0)*t
+	}
+
+	return stops[len(stops)-1][1]
 }
@@ -0,0 +1,425 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+var lineCaps = []string{"", "butt", "round", "square"}
+var lineJoins = []string{"", "miter", "miter-clip", "round", "bevel", "arcs"}
+var patternTypes = []string{"", "hatch", "cross-hatch", "dots", "image"}
+var furniturePositions = []string{"", "top-left", "top-right", "bottom-left", "bottom-right"}
+var scaleBarUnits = []string{"", "metric", "imperial", "both"}
+
+// Problem is something that's wrong with a style file. Errors are things that are ignored when the
+// map is drawn, and warnings are things that are probably drawn differently than intended.
+type Problem struct {
+	// The line of the style file that the problem is on, or 0 if it's not known.
+	Line    int
+	Message string
+	Warning bool
+}
+
+func (p Problem) String() string {
+	level := "error"
+
+	if p.Warning {
+		level = "warning"
+	}
+
+	if p.Line <= 0 {
+		return fmt.Sprintf("%s: %s", level, p.Message)
+	}
+
+	return fmt.Sprintf("line %d: %s: %s", p.Line, level, p.Message)
+}
+
+// validator collects the problems of a style file, along with the lines of its parts.
+type validator struct {
+	problems []Problem
+	// The lines of the keys and of the list items of the file, by their paths, e.g.
+	// "styles[2].stroke_color".
+	lines   map[string]int
+	palette map[string]string
+	// The number of styles from included files, which aren't in the YAML of this one.
+	styleOffset int
+	variables   map[string]interface{}
+}
+
+// variable returns the value of the variable if the value is one, like $name.
+func (v *validator) variable(value string) string {
+	for i := 0; i <= len(v.variables) && strings.HasPrefix(value, "$"); i++ {
+		variable, ok := v.variables[strings.TrimPrefix(value, "$")]
+
+		if !ok {
+			break
+		}
+
+		value = fmt.Sprint(variable)
+	}
+
+	return value
+}
+
+func (v *validator) errorf(line int, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(line int, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Line: line, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+// line returns the line of the path, or the line of the closest parent that has one.
+func (v *validator) line(path string) int {
+	for len(path) > 0 {
+		if line, ok := v.lines[path]; ok {
+			return line
+		}
+
+		path = path[:strings.LastIndexAny(path, ".[")+1]
+		path = strings.TrimRight(path, ".[")
+	}
+
+	return 0
+}
+
+// styleLine returns the line of a key of the style, or the line of the style if it doesn't have it.
+func (v *validator) styleLine(i int, key string) int {
+	if i -= v.styleOffset; i < 0 {
+		return 0
+	} else if len(key) == 0 {
+		return v.line(fmt.Sprintf("styles[%d]", i))
+	}
+
+	return v.line(fmt.Sprintf("styles[%d].%s", i, key))
+}
+
+// Validate checks the style file for unknown keys, invalid colours and values, and for styles that
+// are hidden by other ones. The problems are sorted by their lines.
+func (c *Config) Validate() []Problem {
+	if c.styleConfig == nil {
+		return []Problem{{Message: NOT_LOADED_ERR}}
+	}
+
+	v := &validator{
+		lines:       make(map[string]int),
+		palette:     c.styleConfig.Palette,
+		styleOffset: c.includedStyles,
+		variables:   c.styleConfig.Variables,
+	}
+
+	if len(c.source) > 0 {
+		var root yaml.Node
+
+		if err := yaml.Unmarshal(c.source, &root); err == nil && len(root.Content) > 0 {
+			v.checkKeys(root.Content[0], reflect.TypeOf(StyleConfig{}), "")
+		}
+	}
+
+	v.problems = append(v.problems, c.importProblems...)
+	c.checkPalette(v)
+	c.checkStyles(v)
+	c.checkFurniture(v)
+
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		return v.problems[i].Line < v.problems[j].Line
+	})
+
+	return v.problems
+}
+
+// yamlFields returns the fields of the struct by their YAML keys.
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.IsExported() && yamlName(field) != "-" {
+			fields[yamlName(field)] = field
+		}
+	}
+
+	return fields
+}
+
+// checkKeys reports the keys of the node that the type doesn't have, and the colours that can't be
+// parsed. It also records the lines of the keys under the path of the node.
+func (v *validator) checkKeys(node *yaml.Node, t reflect.Type, path string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			keyPath := key.Value
+
+			if len(path) > 0 {
+				keyPath = path + "." + key.Value
+			}
+
+			v.lines[keyPath] = key.Line
+
+			if !ok {
+				where := "the top level"
+
+				if len(path) > 0 {
+					where = path
+				}
+
+				v.errorf(key.Line, "unknown key %q in %s", key.Value, where)
+				continue
+			}
+
+			if isColorKey(key.Value) && value.Kind == yaml.ScalarNode && len(value.Value) > 0 {
+				if _, err := ParseColor(paletteColor(v.palette, v.variable(value.Value))); err != nil {
+					v.errorf(value.Line, "invalid %s %q: %s", key.Value, value.Value, err)
+				}
+			}
+
+			v.checkKeys(value, field.Type, keyPath)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.lines[path+"."+node.Content[i].Value] = node.Content[i].Line
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			v.lines[itemPath] = item.Line
+			v.checkKeys(item, t.Elem(), itemPath)
+		}
+	}
+}
+
+// queryKey identifies a query along with the tags that a style requires, which are the conditions
+// that a feature needs to match it with that query.
+func queryKey(query FeatureQuery, require []FeatureQuery) string {
+	conditions := lo.Map(require, func(q FeatureQuery, _ int) string {
+		return q.Attribute + "=" + q.Value
+	})
+	sort.Strings(conditions)
+
+	return strings.Join(append([]string{query.Attribute + "=" + query.Value}, conditions...), ", ")
+}
+
+// beats returns whether a feature that matches both styles with the same conditions is drawn with
+// the first one.
+func beats(a, b *FeatureStyle, aIndex, bIndex int) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+
+	return aIndex < bIndex
+}
+
+func (c *Config) checkPalette(v *validator) {
+	for name, value := range c.styleConfig.Palette {
+		if _, err := ParseColor(paletteColor(c.styleConfig.Palette, value)); err != nil {
+			v.errorf(v.line("palette."+name), "invalid palette color %s %q: %s", name, value, err)
+		}
+	}
+}
+
+func (c *Config) checkStyles(v *validator) {
+	styles := c.styleConfig.Styles
+	layers := make(map[string]bool)
+
+	for i, layer := range c.styleConfig.Layers {
+		if layers[layer.Name] {
+			v.errorf(v.line(fmt.Sprintf("layers[%d]", i)), "the layer %q is defined more than once", layer.Name)
+		}
+
+		layers[layer.Name] = true
+	}
+
+	// The style that wins each set of conditions, by its index.
+	winners := make(map[string]int)
+	extended := make(map[string]bool)
+
+	for _, style := range styles {
+		extended[style.Extends] = true
+	}
+
+	for i := range styles {
+		style := &styles[i]
+
+		// Styles that others extend can be templates without queries.
+		if len(style.Queries) == 0 && len(style.WayIdQueries) == 0 && !extended[style.Name] {
+			v.warnf(v.styleLine(i, "queries"), "the style has no queries, so it's never used")
+		}
+
+		if !lo.Contains(lineCaps, strings.ToLower(style.LineCap)) {
+			v.errorf(v.styleLine(i, "line_cap"), "unknown line cap %q", style.LineCap)
+		}
+
+		if !lo.Contains(lineJoins, strings.ToLower(style.LineJoin)) {
+			v.errorf(v.styleLine(i, "line_join"), "unknown line join %q", style.LineJoin)
+		}
+
+		if len(style.Layer) > 0 && !layers[style.Layer] {
+			v.errorf(v.styleLine(i, "layer"), "the layer %q isn't defined in layers", style.Layer)
+		}
+
+		if pattern := style.FillPattern; pattern != nil {
+			if !lo.Contains(patternTypes, strings.ToLower(pattern.Type)) {
+				v.errorf(v.styleLine(i, "fill_pattern"), "unknown fill pattern %q", pattern.Type)
+			} else if strings.ToLower(pattern.Type) == "image" {
+				if _, err := os.Stat(c.ResolvePath(pattern.Image)); err != nil {
+					v.errorf(v.styleLine(i, "fill_pattern"), "the pattern image can't be read: %s", err)
+				}
+			}
+		}
+
+		if style.Casing != nil && style.Casing.ZIndex != nil && *style.Casing.ZIndex >= style.ZIndex {
+			v.warnf(v.styleLine(i, "casing"), "the casing has a z-index of %d, so it's drawn over the line, which has %d", *style.Casing.ZIndex, style.ZIndex)
+		}
+
+		// Additional styles are drawn anyway, and so are the styles that cascade. Styles with
+		// excludes don't always hide the ones after them.
+		if style.Additional || c.cascade != nil {
+			continue
+		}
+
+		seen := make(map[string]bool)
+		hidden := 0
+
+		for _, query := range style.Queries {
+			key := queryKey(query, style.Require)
+
+			if seen[key] {
+				v.warnf(v.styleLine(i, "queries"), "the query %s is repeated", key)
+				hidden++
+				continue
+			}
+
+			seen[key] = true
+			winner, ok := winners[key]
+
+			switch {
+			case style.MinZoom > 0 || style.MaxZoom > 0:
+				// Other styles are used outside of the zoom levels of the style, so it doesn't
+				// hide them.
+			case !ok:
+				winners[key] = i
+			case beats(&styles[winner], style, winner, i):
+				if len(styles[winner].Exclude) == 0 && len(styles[winner].WayIdExcludes) == 0 {
+					v.warnf(v.styleLine(i, "queries"), "the query %s is also in the style on line %d, which wins", key, v.styleLine(winner, ""))
+					hidden++
+				}
+			default:
+				winners[key] = i
+			}
+		}
+
+		if hidden > 0 && hidden == len(style.Queries) && len(style.WayIdQueries) == 0 {
+			v.warnf(v.styleLine(i, ""), "the style is unreachable, since other styles win all of its queries")
+		}
+	}
+
+	c.checkZIndexes(v)
+}
+
+// checkZIndexes reports the z-indexes that are outside of the range of a layer, which are drawn with
+// the features of another layer, and warns about lines and casings that are drawn at the same
+// z-index, since they're then drawn over or under each other depending on the order of the data.
+func (c *Config) checkZIndexes(v *validator) {
+	styles := c.styleConfig.Styles
+
+	// The z-index that the lines or the casing of the style are drawn at, across all of the layers.
+	// Styles that aren't in any of the layers are drawn under them.
+	layerOf := func(i int) int {
+		_, layer := c.GetLayer(styles[i].Layer)
+		return layer
+	}
+	drawnAt := func(i int, zIndex int) int {
+		return (layerOf(i)+1)*2*(MaxZIndex+1) + zIndex
+	}
+
+	for i := range styles {
+		style := &styles[i]
+
+		if style.ZIndex < -MaxZIndex || style.ZIndex > MaxZIndex {
+			v.errorf(v.styleLine(i, "z_index"), "the z-index %d is outside of the range of a layer (-%d to %d)", style.ZIndex, MaxZIndex, MaxZIndex)
+		}
+
+		if casing := style.Casing; casing != nil && casing.ZIndex != nil && (*casing.ZIndex < -MaxZIndex || *casing.ZIndex > MaxZIndex) {
+			v.errorf(v.styleLine(i, "casing"), "the z-index %d of the casing is outside of the range of a layer (-%d to %d)", *casing.ZIndex, MaxZIndex, MaxZIndex)
+		}
+
+		if style.StrokeWidth <= 0 {
+			continue
+		}
+
+		// Lines of other layers are only drawn at the same z-index when one of them is out of range.
+		for j := 0; j < i; j++ {
+			if layerOf(j) != layerOf(i) && styles[j].StrokeWidth > 0 && drawnAt(j, styles[j].ZIndex) == drawnAt(i, style.ZIndex) {
+				v.warnf(v.styleLine(i, "z_index"), "the lines are drawn at the same z-index as the ones of the style on line %d, which is in another layer", v.styleLine(j, ""))
+			}
+		}
+	}
+
+	for i := range styles {
+		casing := styles[i].Casing
+
+		if casing == nil || (casing.Width <= 0 && casing.SideWidth <= 0) {
+			continue
+		}
+
+		zIndex := styles[i].ZIndex - 1
+
+		if casing.ZIndex != nil {
+			zIndex = *casing.ZIndex
+		}
+
+		for j := range styles {
+			if i == j || styles[j].StrokeWidth <= 0 || drawnAt(j, styles[j].ZIndex) != drawnAt(i, zIndex) {
+				continue
+			}
+
+			v.warnf(v.styleLine(i, "casing"), "the casing has the same z-index (%d) as the lines of the style on line %d", zIndex, v.styleLine(j, ""))
+		}
+	}
+}
+
+func (c *Config) checkFurniture(v *validator) {
+	furniture := c.styleConfig.Furniture
+	positions := make(map[string]string)
+
+	if furniture.ScaleBar != nil {
+		positions["scale_bar"] = furniture.ScaleBar.Position
+
+		if !lo.Contains(scaleBarUnits, strings.ToLower(furniture.ScaleBar.Units)) {
+			v.errorf(v.line("furniture.scale_bar.units"), "unknown scale bar units %q", furniture.ScaleBar.Units)
+		}
+	}
+
+	if furniture.NorthArrow != nil {
+		positions["north_arrow"] = furniture.NorthArrow.Position
+	}
+
+	if furniture.Attribution != nil {
+		positions["attribution"] = furniture.Attribution.Position
+	}
+
+	if furniture.Legend != nil {
+		positions["legend"] = furniture.Legend.Position
+	}
+
+	for name, position := range positions {
+		if !lo.Contains(furniturePositions, strings.ToLower(strings.TrimSpace(position))) {
+			v.errorf(v.line("furniture."+name+".position"), "unknown position %q of the %s", position, strings.ReplaceAll(name, "_", " "))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	c := &Config{}
+	err := c.Parse([]byte(`fill_color: "#aad3df"
+land:
+  fill_colour: "#f2efe9"
+layers:
+  - name: roads
+  - name: labels
+styles:
+  - name: primary
+    queries: [{attribute: highway, value: primary}]
+    stroke_color: "#fcd6a4"
+    stroke_width: 4
+    layer: roads
+  - name: primary again
+    queries:
+      - {attribute: highway, value: primary}
+      - {attribute: highway, value: primary}
+    stroke_color: "#f0d0a0"
+    stroke_width: 4
+  - name: secondary
+    queries: [{attribute: highway, value: secondary}]
+    stroke_color: "#fggfff"
+    stroke_width: 3
+    layer: road
+  - name: tertiary
+    queries: [{attribute: highway, value: tertiary}]
+    stroke_color: rgb(255, 255, 255)
+    stroke_width: 2
+    z_index: 5000
+    layer: roads
+  - name: names
+    queries: [{attribute: highway, value: residential}]
+    stroke_width: 1
+    z_index: 904
+    layer: labels
+  - name: bridges
+    queries: [{attribute: bridge, value: "yes"}]
+    stroke_width: 2
+    z_index: 3
+    casing: {width: 1, color: "#000", z_index: 0}
+    layer: roads
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Problem{
+		{Line: 3, Message: `unknown key "fill_colour" in land`},
+		{Line: 14, Message: "the query highway=primary is also in the style on line 8, which wins", Warning: true},
+		{Line: 14, Message: "the query highway=primary is repeated", Warning: true},
+		{Line: 13, Message: "the style is unreachable, since other styles win all of its queries", Warning: true},
+		{Line: 21, Message: `invalid stroke_color "#fggfff": invalid hex color #fggfff`},
+		{Line: 23, Message: `the layer "road" isn't defined in layers`},
+		{Line: 28, Message: "the z-index 5000 is outside of the range of a layer (-2047 to 2047)"},
+		// The z-index is in range, but the one of the style in the layer before it isn't.
+		{Line: 33, Message: "the lines are drawn at the same z-index as the ones of the style on line 24, which is in another layer", Warning: true},
+		{Line: 39, Message: "the casing has the same z-index (0) as the lines of the style on line 8", Warning: true},
+	}
+
+	problems := c.Validate()
+
+	for _, w := range want {
+		found := false
+
+		for _, problem := range problems {
+			found = found || problem == w
+		}
+
+		if !found {
+			t.Errorf("the problem %s is missing", w)
+		}
+	}
+
+	if len(problems) != len(want) || t.Failed() {
+		t.Errorf("got the problems:\n%s", strings.Join(problemStrings(problems), "\n"))
+	}
+}
+
+func problemStrings(problems []Problem) []string {
+	s := make([]string, len(problems))
+
+	for i, problem := range problems {
+		s[i] = problem.String()
+	}
+
+	return s
+}
+
+func TestWarnLayers(t *testing.T) {
+	logs := &strings.Builder{}
+	c := &Config{Logger: slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelWarn}))}
+	err := c.Parse([]byte(`
+layers:
+  - name: roads
+styles:
+  - name: primary
+    queries: [{attribute: highway, value: primary}]
+    layer: road
+  - name: secondary
+    queries: [{attribute: highway, value: secondary}]
+    layer: roads
+    z_index: 3000
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`msg="the layer of the style isn't defined, so it's drawn under all of the layers" style=primary layer=road`,
+		`msg="the z-index of the style is outside of the range of a layer, so it's clamped" style=secondary z_index=3000`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("got the logs:\n%s\nwant %s", logs, want)
+		}
+	}
+}
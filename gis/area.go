@@ -0,0 +1,70 @@
+package gis
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Area is a region of the map that features can be tested against. Both BBox and Polygon can be
+// used wherever an area is expected.
+type Area interface {
+	// ContainsPoint returns whether the point falls inside the area.
+	ContainsPoint(p Point) bool
+
+	// IntersectsBBox returns whether any part of the area overlaps the bounding box.
+	IntersectsBBox(b *BBox) bool
+
+	// IntersectsSegment returns whether the segment from a to b crosses the edge of the area.
+	IntersectsSegment(a, b Point) bool
+
+	// Bounds returns the bounding box that encloses the whole area.
+	Bounds() *BBox
+}
+
+// FilterWays returns the ways that have at least one point inside the area, or that cross it.
+func FilterWays(ways []*RichWay, area Area) []*RichWay {
+	filtered := make([]*RichWay, 0)
+
+	for _, way := range ways {
+		for _, ring := range way.Points {
+			if lineIntersectsArea(ring, area) {
+				filtered = append(filtered, way)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+// lineIntersectsArea returns whether a point of the line is inside the area, or one of its
+// segments crosses the edge of the area.
+func lineIntersectsArea(line []Point, area Area) bool {
+	for i, point := range line {
+		if area.ContainsPoint(point) || (i > 0 && area.IntersectsSegment(line[i-1], point)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// areaVertex returns a point on the edge of the area, which is inside any ring that surrounds the
+// area without crossing it.
+func areaVertex(area Area) Point {
+	if poly, ok := area.(*Polygon); ok && len(poly.Parts) > 0 && len(poly.Parts[0].Outer) > 0 {
+		return poly.Parts[0].Outer[0]
+	}
+
+	return area.Bounds().SW
+}
+
+// ReadAreaFile reads a polygon from either an Osmosis .poly file or a GeoJSON file, based on the
+// extension of the file.
+func ReadAreaFile(filename string) (*Polygon, error) {
+	if strings.ToLower(filepath.Ext(filename)) == ".poly" {
+		return ReadPolyFile(filename)
+	}
+
+	return ReadGeoJSONPolygonFile(filename)
+}
@@ -0,0 +1,85 @@
+package gis
+
+import (
+	"testing"
+
+	"github.com/jonas-p/go-shp"
+)
+
+// concave returns a U-shaped polygon, whose bounding box is centred on the gap between its arms.
+func concave() *Polygon {
+	return &Polygon{Parts: []PolygonPart{{Outer: []Point{
+		{Lat: 0, Lon: 0}, {Lat: 0, Lon: 10}, {Lat: 10, Lon: 10}, {Lat: 10, Lon: 7},
+		{Lat: 2, Lon: 7}, {Lat: 2, Lon: 3}, {Lat: 10, Lon: 3}, {Lat: 10, Lon: 0},
+	}}}}
+}
+
+func TestFilterWays(t *testing.T) {
+	way := func(points ...Point) *RichWay {
+		return &RichWay{Points: [][]Point{points}}
+	}
+	ways := []*RichWay{
+		way(Point{Lat: 1, Lon: 1}, Point{Lat: 20, Lon: 20}),
+		// Crosses the left arm without a point inside of it.
+		way(Point{Lat: 5, Lon: -1}, Point{Lat: 5, Lon: 5}),
+		// Inside the gap between the arms.
+		way(Point{Lat: 5, Lon: 4}, Point{Lat: 6, Lon: 6}),
+		way(Point{Lat: 20, Lon: 20}, Point{Lat: 21, Lon: 21}),
+	}
+
+	for _, test := range []struct {
+		name string
+		area Area
+		want []*RichWay
+	}{
+		{"box", box(0, 0, 10, 10), ways[:3]},
+		{"concave polygon", concave(), ways[:2]},
+	} {
+		got := FilterWays(ways, test.area)
+
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %d ways, want %d", test.name, len(got), len(test.want))
+			continue
+		}
+
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got the way %v, want %v", test.name, got[i].Points, test.want[i].Points)
+			}
+		}
+	}
+}
+
+func TestClipShape(t *testing.T) {
+	shape := func(points ...shp.Point) *shp.Polygon {
+		return &shp.Polygon{NumParts: 1, NumPoints: int32(len(points)), Parts: []int32{0}, Points: points}
+	}
+
+	tests := []struct {
+		name  string
+		shape *shp.Polygon
+		want  bool
+	}{
+		{"with a point inside", shape(shp.Point{X: 1, Y: 1}, shp.Point{X: 1, Y: -5}, shp.Point{X: -5, Y: 1}, shp.Point{X: 1, Y: 1}), true},
+		{"crossing without a point inside", shape(shp.Point{X: -1, Y: 4}, shp.Point{X: 5, Y: 4}, shp.Point{X: 5, Y: 5}, shp.Point{X: -1, Y: 5}, shp.Point{X: -1, Y: 4}), true},
+		{"surrounding the polygon", shape(shp.Point{X: -5, Y: -5}, shp.Point{X: 15, Y: -5}, shp.Point{X: 15, Y: 15}, shp.Point{X: -5, Y: 15}, shp.Point{X: -5, Y: -5}), true},
+		{"inside the gap between the arms", shape(shp.Point{X: 4, Y: 4}, shp.Point{X: 6, Y: 4}, shp.Point{X: 6, Y: 6}, shp.Point{X: 4, Y: 4}), false},
+		{"outside", shape(shp.Point{X: 20, Y: 20}, shp.Point{X: 21, Y: 20}, shp.Point{X: 21, Y: 21}, shp.Point{X: 20, Y: 20}), false},
+	}
+
+	area := concave()
+
+	for _, test := range tests {
+		clipped := clipShape(test.shape, area, area.Bounds())
+
+		if got := clipped != nil; got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		} else if clipped != nil {
+			for _, p := range clipped.Points {
+				if !area.Bounds().ContainsPoint(p) {
+					t.Errorf("%s: the point %v is outside of the bounds", test.name, p)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package gis
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/pdf"
+	"github.com/wisepythagoras/gis-utils/config"
+)
+
+// Atlas splits a large area into a grid of pages, for printing maps that don't fit on one page.
+// The pages overlap, so that the features along their edges appear on both neighbours. The PDF
+// starts with an index map that shows where each page is.
+type Atlas struct {
+	BBox    *BBox
+	Columns int
+	// If it's 0, it's computed so that the cells have the same shape as the map on the page.
+	Rows int
+	// The fraction of a cell that's added to each of its sides, e.g. 0.1 for 10%.
+	Overlap float64
+	// The dimensions of the pages in millimetres.
+	PageWidth  float64
+	PageHeight float64
+	Margin     float64
+	// The projection of the pages, which is Web Mercator if it's nil.
+	Projection *Projection
+	Config     *config.Config
+}
+
+// AtlasPage is one cell of the grid of an atlas. Pages are numbered from 1, row by row, starting
+// from the north-west corner.
+type AtlasPage struct {
+	Number int
+	Row    int
+	Column int
+	// The area of the cell, without the overlap.
+	BBox *BBox
+	// The area that's printed on the page, with the overlap.
+	Extent *BBox
+}
+
+// Pages splits the area of the atlas into the grid of pages.
+func (atlas *Atlas) Pages() ([]*AtlasPage, error) {
+	if atlas.BBox == nil {
+		return nil, errors.New("no bounding box found")
+	} else if atlas.Columns <= 0 {
+		return nil, errors.New("an atlas needs at least one column")
+	}
+
+	mapWidth := atlas.PageWidth - 2*atlas.Margin
+	mapHeight := atlas.PageHeight - 2*atlas.Margin
+
+	if mapWidth <= 0 || mapHeight <= 0 {
+		return nil, errors.New("the margins don't leave any space for the map")
+	}
+
+	if atlas.Projection == nil {
+		atlas.Projection = DefaultProjection()
+	}
+
+	xmin, ymin, xmax, ymax := atlas.Projection.Extent(atlas.BBox)
+
+	cellWidth := (xmax - xmin) / float64(atlas.Columns)
+	rows := atlas.Rows
+	var cellHeight float64
+
+	if rows > 0 {
+		cellHeight = (ymax - ymin) / float64(rows)
+	} else {
+		// Keep the shape of the page, and center the rows vertically over the area.
+		cellHeight = cellWidth * mapHeight / mapWidth
+		rows = int(math.Max(1, math.Ceil((ymax-ymin)/cellHeight)))
+		grow := float64(rows)*cellHeight - (ymax - ymin)
+		ymax += grow / 2
+	}
+
+	pages := make([]*AtlasPage, 0, rows*atlas.Columns)
+
+	for row := 0; row < rows; row++ {
+		for column := 0; column < atlas.Columns; column++ {
+			x0 := xmin + float64(column)*cellWidth
+			y1 := ymax - float64(row)*cellHeight
+			x1 := x0 + cellWidth
+			y0 := y1 - cellHeight
+			dx := cellWidth * atlas.Overlap
+			dy := cellHeight * atlas.Overlap
+
+			pages = append(pages, &AtlasPage{
+				Number: len(pages) + 1,
+				Row:    row,
+				Column: column,
+				BBox:   atlas.Projection.BBox(x0, y0, x1, y1),
+				Extent: atlas.Projection.BBox(x0-dx, y0-dy, x1+dx, y1+dy),
+			})
+		}
+	}
+
+	return pages, nil
+}
+
+// WritePDF renders the index map and all of the pages into a multi-page PDF. The draw callback is
+// called with every initialized image (the index map included), and it should draw the features
+// of the map onto it.
+func (atlas *Atlas) WritePDF(w io.Writer, draw func(img *Image) error) error {
+	pages, err := atlas.Pages()
+
+	if err != nil {
+		return err
+	}
+
+	index, err := atlas.newImage(atlas.BBox)
+
+	if err != nil {
+		return err
+	}
+
+	if err := draw(index); err != nil {
+		return err
+	}
+
+	atlas.drawIndexGrid(index, pages)
+
+	writer := pdf.New(w, atlas.PageWidth, atlas.PageHeight, nil)
+	index.mapCanvas.RenderTo(writer)
+
+	for _, page := range pages {
+		img, err := atlas.newImage(page.Extent)
+
+		if err != nil {
+			return err
+		}
+
+		if err := draw(img); err != nil {
+			return err
+		}
+
+		atlas.drawPageNumber(img, page, len(pages))
+
+		writer.NewPage(atlas.PageWidth, atlas.PageHeight)
+		img.mapCanvas.RenderTo(writer)
+	}
+
+	return writer.Close()
+}
+
+func (atlas *Atlas) newImage(bbox *BBox) (*Image, error) {
+	img := &Image{
+		BBox:       bbox,
+		Width:      atlas.PageWidth,
+		Height:     atlas.PageHeight,
+		Margin:     atlas.Margin,
+		Projection: atlas.Projection,
+		Config:     atlas.Config,
+	}
+
+	if err := img.Init(); err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// drawIndexGrid outlines every page on the index map and labels it with its number.
+func (atlas *Atlas) drawIndexGrid(img *Image, pages []*AtlasPage) {
+	gridColor := color.RGBA{200, 30, 30, 255}
+	cells := make([]*canvas.Path, 0, len(pages))
+
+	// The cells are converted to page coordinates first, since the view of the map is reset while
+	// drawing them, so that the width of the lines is in millimetres.
+	for _, page := range pages {
+		x0, y0 := img.toPage(page.BBox.SW)
+		x1, y1 := img.toPage(page.BBox.NE)
+		cells = append(cells, canvas.Rectangle(x1-x0, y1-y0).Translate(x0, y0))
+	}
+
+	img.context.Push()
+	img.context.ResetView()
+	img.context.SetZIndex(marginZIndex - 1)
+	img.context.SetFillColor(color.Transparent)
+	img.context.SetStrokeColor(gridColor)
+	img.context.SetStrokeWidth(0.4)
+	img.context.DrawPath(0, 0, cells...)
+	img.context.Pop()
+
+	for _, page := range pages {
+		x, y := img.toPage(page.BBox.Center())
+		img.context.SetZIndex(marginZIndex - 1)
+		img.drawPageText(x, y, fmt.Sprint(page.Number), 14, canvas.FontBold, gridColor, canvas.Center)
+	}
+
+	atlas.drawCaption(img, "Index")
+	img.context.SetZIndex(0)
+}
+
+// drawPageNumber labels the page with its number, below the map if there's a margin, or at the
+// bottom of the map otherwise.
+func (atlas *Atlas) drawPageNumber(img *Image, page *AtlasPage, total int) {
+	atlas.drawCaption(img, fmt.Sprintf("Page %d of %d", page.Number, total))
+	img.context.SetZIndex(0)
+}
+
+func (atlas *Atlas) drawCaption(img *Image, caption string) {
+	y := atlas.Margin / 2
+
+	if atlas.Margin < 5 {
+		y = 3
+	}
+
+	img.context.SetZIndex(marginZIndex + 1)
+	img.drawPageText(atlas.PageWidth/2, y, caption, 9, canvas.FontRegular, canvas.Black, canvas.Center)
+}
@@ -9,11 +9,244 @@ import (
 	"github.com/tomchavakis/geojson/geometry"
 )
 
+// The mean radius of the earth in metres, used for distances on the sphere.
+const EarthRadius = 6371008.8
+
+// BBox is a bounding box defined by its south-west and north-east corners. A box that crosses the
+// antimeridian has a west edge (SW.Lon) that is greater than its east edge (NE.Lon), the same way
+// as in GeoJSON.
 type BBox struct {
 	SW Point
 	NE Point
 }
 
+// CrossesAntimeridian returns whether the box wraps around the 180th meridian.
+func (b *BBox) CrossesAntimeridian() bool {
+	return b.SW.Lon > b.NE.Lon
+}
+
+// lonSpan returns the width of the box in degrees of longitude.
+func (b *BBox) lonSpan() float64 {
+	if b.CrossesAntimeridian() {
+		return b.NE.Lon + 360 - b.SW.Lon
+	}
+
+	return b.NE.Lon - b.SW.Lon
+}
+
+// ContainsPoint returns whether the point is inside the bounding box (edges included).
+func (b *BBox) ContainsPoint(p Point) bool {
+	if p.Lat < b.SW.Lat || p.Lat > b.NE.Lat {
+		return false
+	}
+
+	if b.CrossesAntimeridian() {
+		return p.Lon >= b.SW.Lon || p.Lon <= b.NE.Lon
+	}
+
+	return p.Lon >= b.SW.Lon && p.Lon <= b.NE.Lon
+}
+
+// IntersectsBBox returns whether the two bounding boxes overlap (touching edges included).
+func (b *BBox) IntersectsBBox(other *BBox) bool {
+	return b.Intersection(other) != nil
+}
+
+// Intersection returns the area that is common to both boxes, or nil if they don't overlap. If the
+// boxes overlap on both sides of the antimeridian, only the larger of the two overlaps is returned.
+func (b *BBox) Intersection(other *BBox) *BBox {
+	south := math.Max(b.SW.Lat, other.SW.Lat)
+	north := math.Min(b.NE.Lat, other.NE.Lat)
+
+	if south > north {
+		return nil
+	}
+
+	west, east := b.SW.Lon, b.SW.Lon+b.lonSpan()
+	found := false
+	var bestWest, bestEast float64
+
+	// Compare the box against the other one shifted by a full turn in each direction, so that the
+	// overlap is found no matter which side of the antimeridian the boxes are on.
+	for _, shift := range []float64{-360, 0, 360} {
+		otherWest := other.SW.Lon + shift
+		otherEast := otherWest + other.lonSpan()
+		w := math.Max(west, otherWest)
+		e := math.Min(east, otherEast)
+
+		if w <= e && (!found || e-w > bestEast-bestWest) {
+			bestWest, bestEast = w, e
+			found = true
+		}
+	}
+
+	if !found {
+		return nil
+	}
+
+	return newWrappedBBox(bestWest, south, bestEast, north)
+}
+
+// Union returns the smallest box that contains both boxes.
+func (b *BBox) Union(other *BBox) *BBox {
+	south := math.Min(b.SW.Lat, other.SW.Lat)
+	north := math.Max(b.NE.Lat, other.NE.Lat)
+	west, east := b.SW.Lon, b.SW.Lon+b.lonSpan()
+	bestWest, bestEast := math.Inf(-1), math.Inf(1)
+
+	for _, shift := range []float64{-360, 0, 360} {
+		otherWest := other.SW.Lon + shift
+		otherEast := otherWest + other.lonSpan()
+		w := math.Min(west, otherWest)
+		e := math.Max(east, otherEast)
+
+		if e-w < bestEast-bestWest {
+			bestWest, bestEast = w, e
+		}
+	}
+
+	return newWrappedBBox(bestWest, south, bestEast, north)
+}
+
+// ExpandDegrees returns a copy of the box grown by the number of degrees on every side.
+func (b *BBox) ExpandDegrees(degrees float64) *BBox {
+	return b.expand(degrees, degrees)
+}
+
+// ExpandMeters returns a copy of the box grown by the distance on every side. The longitude is
+// expanded using the latitude that is closest to a pole, so that the distance is covered along the
+// whole height of the box.
+func (b *BBox) ExpandMeters(meters float64) *BBox {
+	latDelta := meters / EarthRadius * 180 / math.Pi
+	maxLat := math.Min(math.Max(math.Abs(b.SW.Lat), math.Abs(b.NE.Lat))+latDelta, 90)
+	cosLat := math.Cos(maxLat * math.Pi / 180)
+
+	if cosLat < 1e-9 {
+		return b.expand(latDelta, 360)
+	}
+
+	return b.expand(latDelta, latDelta/cosLat)
+}
+
+func (b *BBox) expand(latDelta, lonDelta float64) *BBox {
+	south := math.Max(b.SW.Lat-latDelta, -90)
+	north := math.Min(b.NE.Lat+latDelta, 90)
+	west := b.SW.Lon - lonDelta
+
+	return newWrappedBBox(west, south, west+b.lonSpan()+2*lonDelta, north)
+}
+
+// Center returns the point in the middle of the box.
+func (b *BBox) Center() Point {
+	return Point{
+		Lat: (b.SW.Lat + b.NE.Lat) / 2,
+		Lon: normalizeLon(b.SW.Lon + b.lonSpan()/2),
+	}
+}
+
+// WidthMeters returns the width of the box in metres, measured along its middle parallel.
+func (b *BBox) WidthMeters() float64 {
+	lat := b.Center().Lat * math.Pi / 180
+
+	return b.lonSpan() * math.Pi / 180 * EarthRadius * math.Cos(lat)
+}
+
+// HeightMeters returns the height of the box in metres.
+func (b *BBox) HeightMeters() float64 {
+	return (b.NE.Lat - b.SW.Lat) * math.Pi / 180 * EarthRadius
+}
+
+// AspectRatio returns the ratio of the width to the height of the box once it's projected to Web
+// Mercator, which is the shape that it has on the rendered map.
+func (b *BBox) AspectRatio() float64 {
+	mercatorY := func(lat float64) float64 {
+		return math.Log(math.Tan(math.Pi/4 + lat*math.Pi/360))
+	}
+
+	height := mercatorY(b.NE.Lat) - mercatorY(b.SW.Lat)
+
+	if height == 0 {
+		return math.Inf(1)
+	}
+
+	return b.lonSpan() * math.Pi / 180 / height
+}
+
+// Clamp returns the point moved to the closest edge of the box, if it's outside of it.
+func (b *BBox) Clamp(p Point) Point {
+	p.Lat = math.Max(b.SW.Lat, math.Min(b.NE.Lat, p.Lat))
+
+	if b.ContainsPoint(Point{Lat: p.Lat, Lon: p.Lon}) {
+		return p
+	}
+
+	// The longitude is outside of the box, so move it to whichever edge is closer going around the
+	// globe.
+	toWest := math.Mod(b.SW.Lon-p.Lon+360, 360)
+	toEast := math.Mod(p.Lon-b.NE.Lon+360, 360)
+
+	if toWest < toEast {
+		p.Lon = b.SW.Lon
+	} else {
+		p.Lon = b.NE.Lon
+	}
+
+	return p
+}
+
+// IntersectsSegment returns whether the segment from a to b crosses an edge of the box. A box that
+// crosses the antimeridian is checked as the two boxes on either side of it.
+func (b *BBox) IntersectsSegment(a, c Point) bool {
+	if b.CrossesAntimeridian() {
+		west := &BBox{SW: b.SW, NE: Point{Lat: b.NE.Lat, Lon: 180}}
+		east := &BBox{SW: Point{Lat: b.SW.Lat, Lon: -180}, NE: b.NE}
+
+		return west.IntersectsSegment(a, c) || east.IntersectsSegment(a, c)
+	}
+
+	return ringIntersectsSegment(b.corners(), a, c)
+}
+
+// corners returns the corners of the box, counterclockwise from the south-west one.
+func (b *BBox) corners() []Point {
+	return []Point{
+		b.SW,
+		{Lat: b.SW.Lat, Lon: b.NE.Lon},
+		b.NE,
+		{Lat: b.NE.Lat, Lon: b.SW.Lon},
+	}
+}
+
+// Bounds returns the bounding box itself, so that it can be used as an Area.
+func (b *BBox) Bounds() *BBox {
+	return b
+}
+
+// newWrappedBBox creates a box from edges that may be outside of the [-180, 180] range, as is the
+// case when computing boxes that cross the antimeridian.
+func newWrappedBBox(west, south, east, north float64) *BBox {
+	if east-west >= 360 {
+		west, east = -180, 180
+	} else {
+		west = normalizeLon(west)
+		east = normalizeLon(east)
+	}
+
+	return &BBox{
+		SW: Point{Lat: south, Lon: west},
+		NE: Point{Lat: north, Lon: east},
+	}
+}
+
+// normalizeLon wraps the longitude to the [-180, 180] range.
+func normalizeLon(lon float64) float64 {
+	if lon >= -180 && lon <= 180 {
+		return lon
+	}
+
+	return math.Mod(math.Mod(lon+180, 360)+360, 360) - 180
+}
+
 func (b *BBox) ToGeoJSONStr() ([]byte, error) {
 	poly := geometry.Geometry{
 		GeoJSONType: geojson.Polygon,
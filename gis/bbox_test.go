@@ -0,0 +1,247 @@
+package gis
+
+import (
+	"math"
+	"testing"
+)
+
+// box returns the bounding box with the edges in the order that ParseBBox takes them in.
+func box(west, south, east, north float64) *BBox {
+	return &BBox{SW: Point{Lat: south, Lon: west}, NE: Point{Lat: north, Lon: east}}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9 || (math.IsInf(a, 1) && math.IsInf(b, 1))
+}
+
+func bboxEqual(a, b *BBox) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return approxEqual(a.SW.Lat, b.SW.Lat) && approxEqual(a.SW.Lon, b.SW.Lon) &&
+		approxEqual(a.NE.Lat, b.NE.Lat) && approxEqual(a.NE.Lon, b.NE.Lon)
+}
+
+func TestBBoxIntersection(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b, want *BBox
+	}{
+		{"overlapping", box(0, 0, 10, 10), box(5, 5, 15, 15), box(5, 5, 10, 10)},
+		{"nested", box(0, 0, 10, 10), box(2, 2, 3, 3), box(2, 2, 3, 3)},
+		{"the same", box(0, 0, 10, 10), box(0, 0, 10, 10), box(0, 0, 10, 10)},
+		{"touching", box(0, 0, 10, 10), box(10, 0, 20, 10), box(10, 0, 10, 10)},
+		{"apart in longitude", box(0, 0, 10, 10), box(20, 0, 30, 10), nil},
+		{"apart in latitude", box(0, 0, 10, 10), box(0, 20, 10, 30), nil},
+		{"the whole world", box(-180, -90, 180, 90), box(10, 10, 20, 20), box(10, 10, 20, 20)},
+		{"east of the antimeridian", box(170, -10, -170, 10), box(175, 0, 180, 5), box(175, 0, 180, 5)},
+		{"west of the antimeridian", box(170, -10, -170, 10), box(-175, 0, -160, 5), box(-175, 0, -170, 5)},
+		{"both crossing the antimeridian", box(170, -10, -170, 10), box(175, -5, -175, 5), box(175, -5, -175, 5)},
+		{"apart across the antimeridian", box(170, -10, -170, 10), box(0, 0, 10, 10), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.a.Intersection(test.b); !bboxEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+
+			// The intersection doesn't depend on the order of the boxes.
+			if got := test.b.Intersection(test.a); !bboxEqual(got, test.want) {
+				t.Errorf("got %v the other way around, want %v", got, test.want)
+			}
+
+			if got := test.a.IntersectsBBox(test.b); got != (test.want != nil) {
+				t.Errorf("IntersectsBBox got %t", got)
+			}
+		})
+	}
+}
+
+func TestBBoxUnion(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b, want *BBox
+	}{
+		{"apart", box(0, 0, 10, 10), box(20, 20, 30, 30), box(0, 0, 30, 30)},
+		{"nested", box(0, 0, 10, 10), box(2, 2, 3, 3), box(0, 0, 10, 10)},
+		{"overlapping", box(0, 0, 10, 10), box(5, -5, 15, 5), box(0, -5, 15, 10)},
+		{"shorter across the antimeridian", box(170, 0, 175, 5), box(-175, 0, -170, 5), box(170, 0, -170, 5)},
+		{"crossing the antimeridian", box(170, -10, -170, 10), box(160, 0, 165, 20), box(160, -10, -170, 20)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.a.Union(test.b); !bboxEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+
+			if got := test.b.Union(test.a); !bboxEqual(got, test.want) {
+				t.Errorf("got %v the other way around, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBBoxExpandDegrees(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       *BBox
+		degrees float64
+		want    *BBox
+	}{
+		{"grown", box(0, 0, 10, 10), 1, box(-1, -1, 11, 11)},
+		{"shrunk", box(0, 0, 10, 10), -1, box(1, 1, 9, 9)},
+		{"near the north pole", box(0, 85, 10, 89), 2, box(-2, 83, 12, 90)},
+		{"near the south pole", box(0, -89, 10, -85), 2, box(-2, -90, 12, -83)},
+		{"across the antimeridian", box(175, 0, 179, 5), 2, box(173, -2, -179, 7)},
+		{"crossing the antimeridian", box(170, 0, -170, 5), 5, box(165, -5, -165, 10)},
+		{"around the world", box(0, 0, 10, 10), 200, box(-180, -90, 180, 90)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.b.ExpandDegrees(test.degrees); !bboxEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBBoxExpandMeters(t *testing.T) {
+	// The number of degrees of latitude in a kilometre.
+	degrees := 1000 / EarthRadius * 180 / math.Pi
+
+	tests := []struct {
+		name string
+		b    *BBox
+		want *BBox
+	}{
+		{
+			name: "at the equator",
+			b:    box(0, 0, 0, 0),
+			want: box(
+				-degrees/math.Cos(degrees*math.Pi/180), -degrees,
+				degrees/math.Cos(degrees*math.Pi/180), degrees,
+			),
+		},
+		{
+			name: "with the latitude closest to a pole",
+			b:    box(0, -60, 1, 10),
+			want: box(
+				-degrees/math.Cos((60+degrees)*math.Pi/180), -60-degrees,
+				1+degrees/math.Cos((60+degrees)*math.Pi/180), 10+degrees,
+			),
+		},
+		{
+			name: "reaching the pole",
+			b:    box(0, 89.995, 10, 89.999),
+			want: box(-180, 89.995-degrees, 180, 90),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.b.ExpandMeters(1000); !bboxEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBBoxClamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		b     *BBox
+		point Point
+		want  Point
+	}{
+		{"inside", box(0, 0, 10, 10), Point{Lat: 5, Lon: 5}, Point{Lat: 5, Lon: 5}},
+		{"north", box(0, 0, 10, 10), Point{Lat: 20, Lon: 5}, Point{Lat: 10, Lon: 5}},
+		{"south-west", box(0, 0, 10, 10), Point{Lat: -20, Lon: -5}, Point{Lat: 0, Lon: 0}},
+		{"east", box(0, 0, 10, 10), Point{Lat: 5, Lon: 15}, Point{Lat: 5, Lon: 10}},
+		{"east going around the world", box(0, 0, 10, 10), Point{Lat: 5, Lon: -175}, Point{Lat: 5, Lon: 10}},
+		{"inside across the antimeridian", box(170, 0, -170, 10), Point{Lat: 5, Lon: 179}, Point{Lat: 5, Lon: 179}},
+		{"west of a box across the antimeridian", box(170, 0, -170, 10), Point{Lat: 5, Lon: 160}, Point{Lat: 5, Lon: 170}},
+		{"east of a box across the antimeridian", box(170, 0, -170, 10), Point{Lat: 5, Lon: -160}, Point{Lat: 5, Lon: -170}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.b.Clamp(test.point); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBBoxAspectRatio(t *testing.T) {
+	tests := []struct {
+		name string
+		b    *BBox
+		want float64
+		// How far the ratio can be from the one that's wanted, since most of them are approximate.
+		tolerance float64
+	}{
+		{"square at the equator", box(-1, -1, 1, 1), 1, 1e-3},
+		{"twice as wide", box(-2, -1, 2, 1), 2, 1e-3},
+		{"at 60 degrees", box(0, 59.5, 1, 60.5), 0.5, 1e-3},
+		{"across the antimeridian", box(170, -1, -170, 1), 10, 1e-2},
+		{"without a height", box(0, 5, 10, 5), math.Inf(1), 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.b.AspectRatio()
+
+			if !(math.IsInf(got, 1) && math.IsInf(test.want, 1)) && math.Abs(got-test.want) > test.tolerance {
+				t.Errorf("got %f, want %f", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewWrappedBBox(t *testing.T) {
+	tests := []struct {
+		name                     string
+		west, south, east, north float64
+		want                     *BBox
+	}{
+		{"in range", -10, 0, 10, 5, box(-10, 0, 10, 5)},
+		{"past the antimeridian to the east", 170, 0, 190, 5, box(170, 0, -170, 5)},
+		{"past the antimeridian to the west", -190, 0, -170, 5, box(170, 0, -170, 5)},
+		{"a full turn", -200, 0, 160, 5, box(-180, 0, 180, 5)},
+		{"more than a full turn", -300, 0, 300, 5, box(-180, 0, 180, 5)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := newWrappedBBox(test.west, test.south, test.east, test.north); !bboxEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeLon(t *testing.T) {
+	tests := []struct {
+		lon, want float64
+	}{
+		{0, 0},
+		{180, 180},
+		{-180, -180},
+		{190, -170},
+		{-190, 170},
+		{360, 0},
+		{-360, 0},
+		{545, -175},
+		{-545, 175},
+	}
+
+	for _, test := range tests {
+		if got := normalizeLon(test.lon); !approxEqual(got, test.want) {
+			t.Errorf("normalizeLon(%v) got %v, want %v", test.lon, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package gis
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/paulmach/osm"
+)
+
+// ReadChange decodes an OsmChange document from the reader.
+func ReadChange(r io.Reader) (*osm.Change, error) {
+	change := &osm.Change{}
+
+	if err := xml.NewDecoder(r).Decode(change); err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+// ReadChangeFile reads an OsmChange file (.osc, .osc.gz or .osc.bz2), like the minutely diffs
+// published by the OSM replication servers.
+func ReadChangeFile(filename string) (*osm.Change, error) {
+	f, name, err := openDecompressed(filename, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	if strings.ToLower(filepath.Ext(name)) != ".osc" {
+		return nil, fmt.Errorf("unsupported change file: %s", filename)
+	}
+
+	return ReadChange(f)
+}
+
+// ApplyChangeFile reads a change file and applies it on top of the loaded data.
+func (pbf *PBF) ApplyChangeFile(filename string) error {
+	change, err := ReadChangeFile(filename)
+
+	if err != nil {
+		return err
+	}
+
+	return pbf.ApplyChange(change)
+}
+
+// ApplyChange applies the creations, modifications and deletions of an OsmChange on top of the
+// loaded data. Since a moved node affects every way and relation that references it, all of the
+// ways and relations are rebuilt afterwards.
+func (pbf *PBF) ApplyChange(change *osm.Change) error {
+	if change == nil {
+		return errors.New("no change found")
+	}
+
+	ways := make([]*osm.Way, 0, len(pbf.ways))
+	wayIndex := make(map[osm.WayID]int)
+	relationIndex := make(map[osm.RelationID]int)
+
+	for i, way := range pbf.ways {
+		ways = append(ways, way.Way)
+		wayIndex[way.Way.ID] = i
+	}
+
+	for i, relation := range pbf.rawRelations {
+		relationIndex[relation.ID] = i
+	}
+
+	for _, o := range []*osm.OSM{change.Create, change.Modify} {
+		if o == nil {
+			continue
+		}
+
+		for _, node := range o.Nodes {
+			node.Visible = true
+			pbf.nodeMap[node.ID] = node
+		}
+
+		for _, way := range o.Ways {
+			way.Visible = true
+
+			if i, ok := wayIndex[way.ID]; ok {
+				ways[i] = way
+			} else {
+				wayIndex[way.ID] = len(ways)
+				ways = append(ways, way)
+			}
+		}
+
+		for _, relation := range o.Relations {
+			relation.Visible = true
+
+			if i, ok := relationIndex[relation.ID]; ok {
+				pbf.rawRelations[i] = relation
+			} else {
+				relationIndex[relation.ID] = len(pbf.rawRelations)
+				pbf.rawRelations = append(pbf.rawRelations, relation)
+			}
+		}
+	}
+
+	if change.Delete != nil {
+		for _, node := range change.Delete.Nodes {
+			delete(pbf.nodeMap, node.ID)
+		}
+
+		for _, way := range change.Delete.Ways {
+			if i, ok := wayIndex[way.ID]; ok {
+				ways[i] = nil
+			}
+		}
+
+		for _, relation := range change.Delete.Relations {
+			if i, ok := relationIndex[relation.ID]; ok {
+				pbf.rawRelations[i] = nil
+			}
+		}
+	}
+
+	relations := pbf.rawRelations
+
+	pbf.wayMap = make(map[osm.WayID]*RichWay)
+	pbf.ways = make([]*RichWay, 0, len(ways))
+	pbf.relations = make([]*RichWay, 0)
+	pbf.rawRelations = make([]*osm.Relation, 0, len(relations))
+	pbf.issues = make([]QualityIssue, 0)
+
+	for _, way := range ways {
+		if way != nil {
+			pbf.addWay(way)
+		}
+	}
+
+	for _, relation := range relations {
+		if relation != nil {
+			pbf.addRelation(relation)
+		}
+	}
+
+	pbf.computeBBox()
+
+	return nil
+}
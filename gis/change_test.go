@@ -0,0 +1,247 @@
+package gis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+// The base of the changes: a road, and a square that's the outer ring of a multipolygon.
+const changeBase = `<osm version="0.6">
+	<node id="1" lat="0" lon="0"/>
+	<node id="2" lat="0" lon="1"/>
+	<node id="3" lat="1" lon="1"/>
+	<node id="4" lat="1" lon="0"/>
+	<node id="5" lat="5" lon="5"/>
+	<node id="6" lat="5" lon="6"/>
+	<way id="10"><nd ref="1"/><nd ref="2"/><nd ref="3"/><nd ref="4"/><nd ref="1"/></way>
+	<way id="11"><nd ref="5"/><nd ref="6"/><tag k="highway" v="residential"/></way>
+	<relation id="20">
+		<member type="way" ref="10" role="outer"/>
+		<tag k="type" v="multipolygon"/>
+		<tag k="landuse" v="forest"/>
+	</relation>
+</osm>`
+
+func readChange(t *testing.T, document string) *osm.Change {
+	t.Helper()
+
+	change, err := ReadChange(strings.NewReader(document))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return change
+}
+
+func TestApplyChange(t *testing.T) {
+	pbf := loadXML(t, changeBase)
+	err := pbf.ApplyChange(readChange(t, `<osmChange version="0.6">
+		<create>
+			<node id="7" lat="6" lon="6"/>
+			<way id="12"><nd ref="6"/><nd ref="7"/><tag k="highway" v="footway"/></way>
+		</create>
+		<modify>
+			<node id="3" lat="2" lon="2"/>
+			<way id="11"><nd ref="5"/><nd ref="6"/><tag k="highway" v="primary"/></way>
+		</modify>
+		<delete>
+			<node id="2"/>
+			<way id="12"/>
+		</delete>
+	</osmChange>`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := pbf.nodeMap[7]; !ok {
+		t.Error("node 7 wasn't created")
+	}
+
+	if _, ok := pbf.nodeMap[2]; ok {
+		t.Error("node 2 wasn't deleted")
+	}
+
+	if _, ok := pbf.wayMap[12]; ok {
+		t.Error("way 12 was created, even though it's deleted in the same change")
+	}
+
+	if way := pbf.wayMap[11]; way == nil || way.Way.Tags.Find("highway") != "primary" {
+		t.Errorf("way 11 wasn't modified: %v", way)
+	}
+
+	// The square is rebuilt without the deleted node and with the moved one.
+	square := pbf.wayMap[10]
+	want := []Point{{Lat: 0, Lon: 0}, {Lat: 2, Lon: 2}, {Lat: 1, Lon: 0}, {Lat: 0, Lon: 0}}
+
+	if square == nil || len(square.Points) != 1 || len(square.Points[0]) != len(want) {
+		t.Fatalf("got the square %v, want the points %v", square, want)
+	}
+
+	for i, p := range want {
+		if square.Points[0][i] != p {
+			t.Errorf("got the points %v, want %v", square.Points[0], want)
+			break
+		}
+	}
+
+	relations := pbf.Relations()
+
+	if len(relations) != 1 {
+		t.Fatalf("got %d multipolygons, want 1", len(relations))
+	}
+
+	if !lineContains(relations[0].Points, Point{Lat: 2, Lon: 2}) {
+		t.Errorf("the multipolygon wasn't rebuilt with the moved node: %v", relations[0].Points)
+	}
+
+	if bbox := pbf.BBox(); !bboxEqual(bbox, box(0, 0, 6, 6)) {
+		t.Errorf("got the bounding box %v, want %v", bbox, box(0, 0, 6, 6))
+	}
+}
+
+func TestApplyChangeDeletesRelations(t *testing.T) {
+	pbf := loadXML(t, changeBase)
+	err := pbf.ApplyChange(readChange(t, `<osmChange version="0.6">
+		<delete><relation id="20"/></delete>
+	</osmChange>`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pbf.Relations()) != 0 || len(pbf.rawRelations) != 0 {
+		t.Errorf("got %d multipolygons and %d relations, want none", len(pbf.Relations()), len(pbf.rawRelations))
+	}
+
+	if len(pbf.Ways()) != 2 {
+		t.Errorf("got %d ways, want 2", len(pbf.Ways()))
+	}
+
+	if err := pbf.ApplyChange(nil); err == nil {
+		t.Error("got no error for a missing change")
+	}
+}
+
+// lineContains returns whether any of the rings has the point.
+func lineContains(rings [][]Point, p Point) bool {
+	for _, ring := range rings {
+		for _, point := range ring {
+			if point == p {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func TestLoadXMLVisibility(t *testing.T) {
+	pbf := loadXML(t, `<osm version="0.6">
+		<node id="1" lat="0" lon="0"/>
+		<node id="2" lat="0" lon="1"/>
+		<node id="3" lat="1" lon="1"/>
+		<way id="10"><nd ref="1"/><nd ref="2"/><nd ref="3"/><nd ref="1"/></way>
+		<relation id="20" visible="false">
+			<member type="way" ref="10" role="outer"/>
+			<tag k="type" v="multipolygon"/>
+		</relation>
+		<relation id="21" visible="true">
+			<member type="way" ref="10" role="outer"/>
+			<tag k="type" v="multipolygon"/>
+		</relation>
+		<relation id="22">
+			<member type="way" ref="10" role="outer"/>
+			<tag k="type" v="multipolygon"/>
+		</relation>
+	</osm>`)
+
+	if !pbf.wayMap[10].Way.Visible || !pbf.nodeMap[1].Visible {
+		t.Error("the way and the nodes without the visible attribute aren't visible")
+	}
+
+	// The relation that's explicitly hidden isn't built, even though plain extracts are visible.
+	ids := make([]osm.WayID, 0)
+
+	for _, relation := range pbf.Relations() {
+		ids = append(ids, relation.Way.ID)
+	}
+
+	if len(ids) != 2 || ids[0] != 21 || ids[1] != 22 {
+		t.Errorf("got the multipolygons %v, want 21 and 22", ids)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	document := `<osm version="0.6"><node id="1" lat="1" lon="2"><tag k="name" v="bz2"/></node>` +
+		`<node id="2" lat="1" lon="3"/><way id="10"><nd ref="1"/><nd ref="2"/><tag k="highway" v="path"/></way></osm>`
+
+	// bzip2 can only be decompressed in Go, so this is the document compressed with bzip2.
+	compressed, err := base64.StdEncoding.DecodeString("QlpoOTFBWSZTWeiytUgAACOZgFAB+Qc3792wIACSDSJ6T1Mj1A0AHqaCU1NKZHqMymmm0hjSTssiIeRFZd0XXvnGGFBjGcXB5MUa+DNympkzHynBWAnLfRV9KSWft3Ujr+N+Wuibtw0ySsY4Bgiy9Ymo8E4IpV9ATxK2YM4RC4REggdAn3WGVPxdyRThQkOiytUg")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		return path
+	}
+
+	gzipped := &bytes.Buffer{}
+	zw := gzip.NewWriter(gzipped)
+	zw.Write([]byte(document))
+	zw.Close()
+
+	for _, filename := range []string{
+		writeFile("extract.osm", []byte(document)),
+		writeFile("extract.osm.gz", gzipped.Bytes()),
+		writeFile("extract.osm.bz2", compressed),
+	} {
+		pbf := &PBF{}
+		pbf.Init()
+
+		if err := pbf.LoadFile(filename); err != nil {
+			t.Errorf("%s: %v", filepath.Base(filename), err)
+			continue
+		}
+
+		if len(pbf.nodeMap) != 2 || len(pbf.Ways()) != 1 || pbf.Ways()[0].Way.Tags.Find("highway") != "path" {
+			t.Errorf("%s: got %d nodes and the ways %v", filepath.Base(filename), len(pbf.nodeMap), pbf.Ways())
+		}
+	}
+
+	pbf := &PBF{}
+	pbf.Init()
+
+	if err := pbf.LoadFile(writeFile("extract.txt", []byte(document))); err == nil {
+		t.Error("got no error for a file with an unknown extension")
+	}
+
+	gzipped.Reset()
+	zw = gzip.NewWriter(gzipped)
+	zw.Write([]byte(`<osmChange version="0.6"><delete><way id="10"/></delete></osmChange>`))
+	zw.Close()
+
+	change, err := ReadChangeFile(writeFile("change.osc.gz", gzipped.Bytes()))
+
+	if err != nil {
+		t.Fatal(err)
+	} else if change.Delete == nil || len(change.Delete.Ways) != 1 {
+		t.Errorf("got the change %+v, want the deletion of way 10", change)
+	}
+}
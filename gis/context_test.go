@@ -0,0 +1,207 @@
+package gis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonas-p/go-shp"
+	"github.com/paulmach/osm"
+)
+
+// cancelOnProgress returns a context that's cancelled the first time that the progress of the stage
+// is reported, and the progress.
+func cancelOnProgress(stage string) (context.Context, *int, Progress) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reports := 0
+
+	return ctx, &reports, ProgressFuncs{Features: func(s string, _, _ int) {
+		if s == stage {
+			reports++
+			cancel()
+		}
+	}}
+}
+
+// cancelled returns a context that's already cancelled.
+func cancelled() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	return ctx
+}
+
+// writeShapefile writes a shapefile with n small squares in a row, and returns its filename.
+func writeShapefile(t *testing.T, n int) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "land.shp")
+	writer, err := shp.Create(filename, shp.POLYGON)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		x := float64(i) * 0.1
+		square := shp.Polygon(*shp.NewPolyLine([][]shp.Point{{
+			{X: x, Y: 0}, {X: x, Y: 0.05}, {X: x + 0.05, Y: 0.05}, {X: x + 0.05, Y: 0}, {X: x, Y: 0},
+		}}))
+		writer.Write(&square)
+	}
+
+	writer.Close()
+
+	return filename
+}
+
+func TestLoadContextCancelled(t *testing.T) {
+	data := &osm.OSM{}
+
+	for i := 1; i <= 3*progressInterval; i++ {
+		data.Nodes = append(data.Nodes, &osm.Node{ID: osm.NodeID(i), Lat: 1, Lon: 1, Visible: true})
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := WritePBF(buf, data); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, reports, progress := cancelOnProgress("objects")
+	pbf := &PBF{Progress: progress}
+	pbf.Init()
+
+	if err := pbf.LoadContext(ctx, bytes.NewReader(buf.Bytes())); !errors.Is(err, context.Canceled) {
+		t.Errorf("got the error %v, want %v", err, context.Canceled)
+	}
+
+	if *reports != 1 {
+		t.Errorf("the progress was reported %d times after the context was cancelled", *reports-1)
+	}
+
+	pbf = &PBF{}
+	pbf.Init()
+
+	if err := pbf.LoadXMLContext(cancelled(), strings.NewReader(`<osm><node id="1" lat="0" lon="0"/></osm>`)); !errors.Is(err, context.Canceled) {
+		t.Errorf("LoadXMLContext got the error %v, want %v", err, context.Canceled)
+	}
+
+	filename := filepath.Join(t.TempDir(), "extract.osm.pbf")
+
+	if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pbf.LoadFileContext(cancelled(), filename); !errors.Is(err, context.Canceled) {
+		t.Errorf("LoadFileContext got the error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestClipContextCancelled(t *testing.T) {
+	filename := writeShapefile(t, 250)
+
+	// The shapes are read from the file.
+	shapefile := &Shapefile{Filename: filename}
+
+	if err := shapefile.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, reports, progress := cancelOnProgress("land")
+	shapefile.Progress = progress
+
+	if polygons, err := shapefile.ClipContext(ctx, box(0, 0, 30, 1)); !errors.Is(err, context.Canceled) || polygons != nil {
+		t.Errorf("got %d polygons and the error %v, want %v", len(polygons), err, context.Canceled)
+	}
+
+	if *reports != 1 {
+		t.Errorf("the progress was reported %d times after the context was cancelled", *reports-1)
+	}
+
+	shapefile.Close()
+
+	// The shapes are iterated over.
+	shapefile = &Shapefile{Filename: filename}
+
+	if err := shapefile.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	iterated := 0
+	err := shapefile.IterContext(ctx, func(int, *shp.Polygon) error {
+		iterated++
+		cancel()
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) || iterated != 1 {
+		t.Errorf("iterated over %d shapes and got the error %v, want 1 and %v", iterated, err, context.Canceled)
+	}
+
+	shapefile.Close()
+
+	// The shapes were read into memory.
+	shapefile = &Shapefile{Filename: filename}
+
+	if err := shapefile.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := shapefile.ReadAllContext(cancelled()); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadAllContext got the error %v, want %v", err, context.Canceled)
+	}
+
+	shapefile.Close()
+	shapefile = &Shapefile{Filename: filename}
+
+	if err := shapefile.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := shapefile.ReadAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, _, progress = cancelOnProgress("land")
+	shapefile.Progress = progress
+
+	if _, err := shapefile.ClipContext(ctx, box(0, 0, 30, 1)); !errors.Is(err, context.Canceled) {
+		t.Errorf("got the error %v for the shapes in memory, want %v", err, context.Canceled)
+	}
+
+	shapefile.Progress = nil
+
+	if polygons, err := shapefile.Clip(box(0, 0, 30, 1)); err != nil || len(polygons) != 250 {
+		t.Errorf("got %d polygons and the error %v, want 250", len(polygons), err)
+	}
+}
+
+func TestDrawContextCancelled(t *testing.T) {
+	conf, ways := parallelWays(t)
+	ctx, reports, progress := cancelOnProgress("ways")
+	img := &Image{BBox: box(0, 0, 1, 1), Width: 60, Config: conf, Workers: 4, Progress: progress}
+
+	if err := img.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := img.DrawWaysContext(ctx, ways); !errors.Is(err, context.Canceled) {
+		t.Errorf("DrawWaysContext got the error %v, want %v", err, context.Canceled)
+	}
+
+	if *reports != 1 {
+		t.Errorf("the progress was reported %d times after the context was cancelled", *reports-1)
+	}
+
+	polygons := []*ShapePolygon{{Points: []Point{{Lat: 0, Lon: 0}, {Lat: 0, Lon: 1}, {Lat: 1, Lon: 1}}}}
+
+	if err := img.DrawShapePolygonsContext(cancelled(), polygons); !errors.Is(err, context.Canceled) {
+		t.Errorf("DrawShapePolygonsContext got the error %v, want %v", err, context.Canceled)
+	}
+}
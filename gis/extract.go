@@ -0,0 +1,133 @@
+package gis
+
+import (
+	"github.com/paulmach/osm"
+)
+
+// Extract returns the loaded data that falls inside the area. Every way with at least one node in
+// the area is kept in full, along with all of its nodes, so that the result is referentially
+// complete. Relations are kept if any of their members were kept. If completeRelations is set, all
+// of the members of the kept relations (and the nodes of their ways) are added as well.
+func (pbf *PBF) Extract(area Area, completeRelations bool) *osm.OSM {
+	insideIDs := make(map[osm.NodeID]bool)
+	nodeIDs := make(map[osm.NodeID]bool)
+	wayIDs := make(map[osm.WayID]bool)
+	relationIDs := make(map[osm.RelationID]bool)
+
+	for id, node := range pbf.nodeMap {
+		if area.ContainsPoint(Point{Lat: node.Lat, Lon: node.Lon}) {
+			insideIDs[id] = true
+			nodeIDs[id] = true
+		}
+	}
+
+	addWay := func(way *osm.Way) {
+		wayIDs[way.ID] = true
+
+		for _, wn := range way.Nodes {
+			nodeIDs[wn.ID] = true
+		}
+	}
+
+	for _, way := range pbf.ways {
+		for _, wn := range way.Way.Nodes {
+			if insideIDs[wn.ID] {
+				addWay(way.Way)
+				break
+			}
+		}
+	}
+
+	// Relations can be members of other relations, so keep going until no more relations are
+	// added.
+	for changed := true; changed; {
+		changed = false
+
+		for _, relation := range pbf.rawRelations {
+			if relationIDs[relation.ID] {
+				continue
+			}
+
+			for _, member := range relation.Members {
+				if (member.Type == osm.TypeNode && insideIDs[osm.NodeID(member.Ref)]) ||
+					(member.Type == osm.TypeWay && wayIDs[osm.WayID(member.Ref)]) ||
+					(member.Type == osm.TypeRelation && relationIDs[osm.RelationID(member.Ref)]) {
+					relationIDs[relation.ID] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	if completeRelations {
+		relationMap := make(map[osm.RelationID]*osm.Relation)
+
+		for _, relation := range pbf.rawRelations {
+			relationMap[relation.ID] = relation
+		}
+
+		var complete func(relation *osm.Relation)
+
+		complete = func(relation *osm.Relation) {
+			for _, member := range relation.Members {
+				switch member.Type {
+				case osm.TypeNode:
+					nodeIDs[osm.NodeID(member.Ref)] = true
+				case osm.TypeWay:
+					if way, ok := pbf.wayMap[osm.WayID(member.Ref)]; ok {
+						addWay(way.Way)
+					}
+				case osm.TypeRelation:
+					id := osm.RelationID(member.Ref)
+
+					if child, ok := relationMap[id]; ok && !relationIDs[id] {
+						relationIDs[id] = true
+						complete(child)
+					}
+				}
+			}
+		}
+
+		for _, relation := range pbf.rawRelations {
+			if relationIDs[relation.ID] {
+				complete(relation)
+			}
+		}
+	}
+
+	data := &osm.OSM{
+		Version:   "0.6",
+		Generator: pbfWritingProgram,
+	}
+
+	if bbox := area.Bounds(); bbox != nil {
+		data.Bounds = &osm.Bounds{
+			MinLat: bbox.SW.Lat,
+			MaxLat: bbox.NE.Lat,
+			MinLon: bbox.SW.Lon,
+			MaxLon: bbox.NE.Lon,
+		}
+	}
+
+	for id := range nodeIDs {
+		// Nodes that are referenced by a way, but that aren't in the loaded data are skipped.
+		if node, ok := pbf.nodeMap[id]; ok {
+			data.Nodes = append(data.Nodes, node)
+		}
+	}
+
+	for _, way := range pbf.ways {
+		if wayIDs[way.Way.ID] {
+			data.Ways = append(data.Ways, way.Way)
+		}
+	}
+
+	for _, relation := range pbf.rawRelations {
+		if relationIDs[relation.ID] {
+			data.Relations = append(data.Relations, relation)
+		}
+	}
+
+	return data
+}
@@ -0,0 +1,37 @@
+package gis
+
+import (
+	"image/color"
+	"sync"
+
+	"github.com/tdewolff/canvas"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+var fontFamily *canvas.FontFamily
+var loadFontFamily sync.Once
+
+// getFontFamily returns the font family that's used for all of the text on the map. The Go fonts
+// are embedded, so that rendering doesn't depend on the fonts of the system.
+func getFontFamily() *canvas.FontFamily {
+	loadFontFamily.Do(func() {
+		fontFamily = canvas.NewFontFamily("go")
+		fontFamily.MustLoadFont(goregular.TTF, 0, canvas.FontRegular)
+		fontFamily.MustLoadFont(gobold.TTF, 0, canvas.FontBold)
+	})
+
+	return fontFamily
+}
+
+// drawPageText draws a line of text in page coordinates, which are millimetres from the bottom left
+// corner, rather than in map coordinates. The size is in points.
+func (img *Image) drawPageText(x, y float64, text string, size float64, style canvas.FontStyle, textColor color.Color, align canvas.TextAlign) {
+	face := getFontFamily().Face(size, textColor, style)
+	line := canvas.NewTextLine(face, text, align)
+
+	img.context.Push()
+	img.context.ResetView()
+	img.context.DrawText(x, y, line)
+	img.context.Pop()
+}
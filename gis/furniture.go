@@ -0,0 +1,422 @@
+package gis
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+	"github.com/wisepythagoras/gis-utils/config"
+)
+
+// The z-index of the map furniture, which is drawn over the map but under the margins.
+const furnitureZIndex = marginZIndex - 1
+
+// The space between the furniture and the edges of the map, and between stacked items, in mm.
+const furniturePadding = 4.0
+
+const defaultAttribution = "© OpenStreetMap contributors"
+
+var furnitureBackground = color.RGBA{255, 255, 255, 220}
+
+// DrawFurniture draws the scale bar, the north arrow, the attribution and the legend, as they're
+// configured in the styles. It should be called after all of the features have been drawn, so that
+// the legend can list the styles that were used.
+func (img *Image) DrawFurniture() {
+	if img.Config == nil {
+		return
+	}
+
+	furniture := img.Config.GetFurniture()
+	img.cornerOffsets = make(map[string]float64)
+
+	if furniture.Legend != nil {
+		img.DrawLegend(furniture.Legend.Position, furniture.Legend.Title)
+	}
+
+	if furniture.NorthArrow != nil {
+		img.DrawNorthArrow(furniture.NorthArrow.Position)
+	}
+
+	if furniture.ScaleBar != nil {
+		img.DrawScaleBar(furniture.ScaleBar.Position, furniture.ScaleBar.Units)
+	}
+
+	if furniture.Attribution != nil {
+		img.DrawAttribution(furniture.Attribution.Position, furniture.Attribution.Text)
+	}
+}
+
+// place returns the bottom left corner of a box of the given size in a corner of the map. Boxes in
+// the same corner are stacked on top of each other (or below, in the top corners).
+func (img *Image) place(position, defaultPosition string, width, height float64) (float64, float64) {
+	if img.cornerOffsets == nil {
+		img.cornerOffsets = make(map[string]float64)
+	}
+
+	position = strings.ToLower(strings.TrimSpace(position))
+
+	switch position {
+	case "top-left", "top-right", "bottom-left", "bottom-right":
+	default:
+		position = defaultPosition
+	}
+
+	offset := img.cornerOffsets[position]
+	img.cornerOffsets[position] = offset + height + furniturePadding/2
+
+	x := img.Margin + furniturePadding
+	y := img.Margin + furniturePadding + offset
+
+	if strings.HasSuffix(position, "right") {
+		x = img.Width - img.Margin - furniturePadding - width
+	}
+
+	if strings.HasPrefix(position, "top") {
+		y = img.Height - img.Margin - furniturePadding - offset - height
+	}
+
+	return x, y
+}
+
+// drawPagePath draws a path in page coordinates, which are millimetres from the bottom left corner.
+func (img *Image) drawPagePath(x, y float64, path *canvas.Path, fill, stroke color.Color, strokeWidth float64) {
+	img.drawPagePathAt(furnitureZIndex, x, y, path, fill, stroke, strokeWidth)
+}
+
+func (img *Image) drawPagePathAt(zIndex int, x, y float64, path *canvas.Path, fill, stroke color.Color, strokeWidth float64) {
+	img.context.Push()
+	img.context.ResetView()
+	img.context.SetZIndex(zIndex)
+	img.context.SetFillColor(fill)
+	img.context.SetStrokeColor(stroke)
+	img.context.SetStrokeWidth(strokeWidth)
+	img.context.DrawPath(x, y, path)
+	img.context.Pop()
+}
+
+// drawFurnitureText draws text over the map, in page coordinates.
+func (img *Image) drawFurnitureText(x, y float64, text string, size float64, style canvas.FontStyle, align canvas.TextAlign) {
+	img.context.SetZIndex(furnitureZIndex)
+	img.drawPageText(x, y, text, size, style, canvas.Black, align)
+	img.context.SetZIndex(0)
+}
+
+// metersPerMM returns the number of metres on the ground that a millimetre of the page stands for,
+// at the middle of the map.
+func (img *Image) metersPerMM() float64 {
+	return img.ScaleDenominator() / 1000
+}
+
+// niceLength rounds the length down to 1, 2 or 5 times a power of ten.
+func niceLength(length float64) float64 {
+	if length <= 0 {
+		return 0
+	}
+
+	power := math.Pow(10, math.Floor(math.Log10(length)))
+
+	for _, m := range []float64{5, 2, 1} {
+		if m*power <= length {
+			return m * power
+		}
+	}
+
+	return power
+}
+
+// scaleBarSegment is one of the bars of a scale bar.
+type scaleBarSegment struct {
+	length float64
+	label  string
+}
+
+// scaleBarSegments returns the bars of the scale bar for the units, where each one is at most
+// maxLength millimetres long.
+func (img *Image) scaleBarSegments(units string, maxLength float64) []scaleBarSegment {
+	metersPerMM := img.metersPerMM()
+	maxMeters := maxLength * metersPerMM
+	segments := make([]scaleBarSegment, 0, 2)
+	units = strings.ToLower(strings.TrimSpace(units))
+
+	if units != "imperial" {
+		meters := niceLength(maxMeters)
+		label := fmt.Sprintf("%g m", meters)
+
+		if meters >= 1000 {
+			label = fmt.Sprintf("%g km", meters/1000)
+		}
+
+		segments = append(segments, scaleBarSegment{length: meters / metersPerMM, label: label})
+	}
+
+	if units == "imperial" || units == "both" {
+		const metersPerMile = 1609.344
+		const metersPerFoot = 0.3048
+
+		if maxMeters >= metersPerMile {
+			miles := niceLength(maxMeters / metersPerMile)
+			segments = append(segments, scaleBarSegment{
+				length: miles * metersPerMile / metersPerMM,
+				label:  fmt.Sprintf("%g mi", miles),
+			})
+		} else {
+			feet := niceLength(maxMeters / metersPerFoot)
+			segments = append(segments, scaleBarSegment{
+				length: feet * metersPerFoot / metersPerMM,
+				label:  fmt.Sprintf("%g ft", feet),
+			})
+		}
+	}
+
+	return segments
+}
+
+// DrawScaleBar draws a scale bar in metric units, imperial units or both. Its length is computed
+// at the middle of the map, since the scale of Web Mercator changes with the latitude.
+func (img *Image) DrawScaleBar(position, units string) {
+	const barHeight = 1.5
+	const rowHeight = 6.0
+	const textSize = 7.0
+
+	mapWidth := img.Width - 2*img.Margin
+	segments := img.scaleBarSegments(units, math.Min(40, mapWidth/4))
+
+	width := 0.0
+
+	for _, segment := range segments {
+		width = math.Max(width, segment.length)
+	}
+
+	// Leave room for the label of the end of the bar, which is centered over it.
+	padding := 1.0
+	boxWidth := width + 2*padding + 8
+	boxHeight := float64(len(segments))*rowHeight + padding
+	x, y := img.place(position, "bottom-left", boxWidth, boxHeight)
+
+	img.drawPagePath(x, y, canvas.Rectangle(boxWidth, boxHeight), furnitureBackground, canvas.Transparent, 0)
+
+	for i, segment := range segments {
+		barX := x + padding + 2
+		barY := y + padding + float64(len(segments)-1-i)*rowHeight
+
+		// The bar is split into four parts of alternating colors.
+		for part := 0; part < 4; part++ {
+			fill := canvas.Black
+
+			if part%2 == 1 {
+				fill = canvas.White
+			}
+
+			partWidth := segment.length / 4
+			img.drawPagePath(barX+float64(part)*partWidth, barY, canvas.Rectangle(partWidth, barHeight), fill, canvas.Black, 0.2)
+		}
+
+		img.drawFurnitureText(barX, barY+barHeight+0.8, "0", textSize, canvas.FontRegular, canvas.Center)
+		img.drawFurnitureText(barX+segment.length, barY+barHeight+0.8, segment.label, textSize, canvas.FontRegular, canvas.Center)
+	}
+}
+
+// DrawNorthArrow draws an arrow that points to the north at the center of the map. The north is up
+// in Web Mercator, but it can be at an angle in other projections.
+func (img *Image) DrawNorthArrow(position string) {
+	const arrowWidth = 6.0
+	const arrowHeight = 9.0
+	const boxWidth = arrowWidth + 4
+	const boxHeight = arrowHeight + 9
+
+	x, y := img.place(position, "top-right", boxWidth, boxHeight)
+	img.drawPagePath(x, y, canvas.Rectangle(boxWidth, boxHeight), furnitureBackground, canvas.Transparent, 0)
+
+	// The arrow is split down the middle, with one half filled and the other one outlined.
+	left := &canvas.Path{}
+	left.MoveTo(0, 0)
+	left.LineTo(arrowWidth/2, arrowHeight)
+	left.LineTo(arrowWidth/2, arrowHeight/4)
+	left.Close()
+
+	right := &canvas.Path{}
+	right.MoveTo(arrowWidth, 0)
+	right.LineTo(arrowWidth/2, arrowHeight)
+	right.LineTo(arrowWidth/2, arrowHeight/4)
+	right.Close()
+
+	rotation := canvas.Identity.RotateAbout(-img.northAngle(), arrowWidth/2, arrowHeight/2)
+	arrowX := x + (boxWidth-arrowWidth)/2
+	arrowY := y + 2
+	img.drawPagePath(arrowX, arrowY, left.Transform(rotation), canvas.Black, canvas.Black, 0.2)
+	img.drawPagePath(arrowX, arrowY, right.Transform(rotation), canvas.White, canvas.Black, 0.2)
+	img.drawFurnitureText(x+boxWidth/2, arrowY+arrowHeight+1.5, "N", 10, canvas.FontBold, canvas.Center)
+}
+
+// northAngle returns the clockwise angle in degrees between up on the page and the north, at the
+// center of the map.
+func (img *Image) northAngle() float64 {
+	center := img.BBox.Center()
+	x0, y0 := img.toPage(center)
+	x1, y1 := img.toPage(Point{Lat: math.Min(center.Lat+0.01, 90), Lon: center.Lon})
+
+	return math.Atan2(x1-x0, y1-y0) * 180 / math.Pi
+}
+
+// DrawAttribution draws the credits of the data in a box. OpenStreetMap is credited if there's no
+// text.
+func (img *Image) DrawAttribution(position, text string) {
+	const textSize = 6.0
+	const padding = 1.0
+
+	if len(strings.TrimSpace(text)) == 0 {
+		text = defaultAttribution
+	}
+
+	face := getFontFamily().Face(textSize, canvas.Black, canvas.FontRegular)
+	metrics := face.Metrics()
+	boxWidth := face.TextWidth(text) + 2*padding
+	boxHeight := metrics.Ascent + metrics.Descent + 2*padding
+	x, y := img.place(position, "bottom-right", boxWidth, boxHeight)
+
+	img.drawPagePath(x, y, canvas.Rectangle(boxWidth, boxHeight), furnitureBackground, canvas.Transparent, 0)
+	img.drawFurnitureText(x+padding, y+padding+metrics.Descent, text, textSize, canvas.FontRegular, canvas.Left)
+}
+
+// legendLabel returns the label of a style in the legend, which is its name, or the value of its
+// first query (e.g. "Primary" for highway=primary).
+func legendLabel(style *config.FeatureStyle) string {
+	if len(style.Name) > 0 {
+		return style.Name
+	}
+
+	if len(style.Queries) == 0 {
+		return ""
+	}
+
+	label := strings.ReplaceAll(style.Queries[0].Value, "_", " ")
+
+	if len(label) == 0 {
+		return ""
+	}
+
+	return strings.ToUpper(label[:1]) + label[1:]
+}
+
+// legendStyles returns the styles that were drawn on the map, once per label, with the ones on top
+// first.
+func (img *Image) legendStyles() ([]string, map[string]*config.FeatureStyle) {
+	styles := make(map[string]*config.FeatureStyle)
+	labels := make([]string, 0)
+
+	for _, style := range img.usedStyles {
+		label := legendLabel(style)
+
+		if _, ok := styles[label]; ok || len(label) == 0 {
+			continue
+		}
+
+		styles[label] = style
+		labels = append(labels, label)
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		a, b := styles[labels[i]], styles[labels[j]]
+		aZIndex, _ := img.layerZIndex(a.Layer, a.ZIndex)
+		bZIndex, _ := img.layerZIndex(b.Layer, b.ZIndex)
+
+		if aZIndex != bZIndex {
+			return aZIndex > bZIndex
+		}
+
+		return labels[i] < labels[j]
+	})
+
+	return labels, styles
+}
+
+// DrawLegend draws a legend of the styles that were used on the map. Nothing is drawn if no
+// features were drawn.
+func (img *Image) DrawLegend(position, title string) {
+	const textSize = 7.0
+	const titleSize = 8.0
+	const rowHeight = 5.0
+	const swatchWidth = 6.0
+	const swatchHeight = 3.5
+	const padding = 2.0
+
+	labels, styles := img.legendStyles()
+
+	if len(labels) == 0 {
+		return
+	}
+
+	face := getFontFamily().Face(textSize, canvas.Black, canvas.FontRegular)
+	titleFace := getFontFamily().Face(titleSize, canvas.Black, canvas.FontBold)
+	textWidth := 0.0
+
+	for _, label := range labels {
+		textWidth = math.Max(textWidth, face.TextWidth(label))
+	}
+
+	boxWidth := swatchWidth + textWidth + 3*padding
+	titleHeight := 0.0
+
+	if len(title) > 0 {
+		boxWidth = math.Max(boxWidth, titleFace.TextWidth(title)+2*padding)
+		titleHeight = rowHeight + 1
+	}
+
+	boxHeight := float64(len(labels))*rowHeight + titleHeight + 2*padding - (rowHeight - swatchHeight)
+	x, y := img.place(position, "top-left", boxWidth, boxHeight)
+
+	img.drawPagePath(x, y, canvas.Rectangle(boxWidth, boxHeight), furnitureBackground, color.RGBA{120, 120, 120, 255}, 0.2)
+
+	top := y + boxHeight - padding
+
+	if len(title) > 0 {
+		img.drawFurnitureText(x+padding, top-titleSize*0.3, title, titleSize, canvas.FontBold, canvas.Left)
+		top -= titleHeight
+	}
+
+	// The widths of the strokes are converted from map units to the page, so that the swatches look
+	// like the features.
+	mmPerUnit := img.context.View()[0][0]
+
+	for i, label := range labels {
+		style := styles[label]
+		rowY := top - float64(i)*rowHeight - swatchHeight
+
+		fill := color.RGBA{}
+		stroke := color.RGBA{}
+
+		if len(style.FillColor) > 0 {
+			if c, err := config.ParseColor(style.FillColor); err == nil {
+				fill = *c
+			}
+		}
+
+		if len(style.StrokeColor) > 0 {
+			if c, err := config.ParseColor(style.StrokeColor); err == nil {
+				stroke = *c
+			}
+		}
+
+		strokeWidth := math.Max(0.2, math.Min(2, img.strokeWidth(style)*mmPerUnit))
+
+		if fill.A > 0 {
+			img.drawPagePath(x+padding, rowY, canvas.Rectangle(swatchWidth, swatchHeight), fill, stroke, math.Min(strokeWidth, 0.5))
+		} else {
+			line := canvas.Line(swatchWidth, 0)
+
+			if width := style.CasingWidthAtZoom(img.ZoomLevel()); width > 0 {
+				if c, err := config.ParseColor(style.Casing.Color); err == nil {
+					casingWidth := math.Max(strokeWidth+0.4, math.Min(3, img.styleLength(style, width)*mmPerUnit))
+					img.drawPagePath(x+padding, rowY+swatchHeight/2, line, canvas.Transparent, *c, casingWidth)
+				}
+			}
+
+			img.drawPagePath(x+padding, rowY+swatchHeight/2, line, canvas.Transparent, stroke, strokeWidth)
+		}
+
+		img.drawFurnitureText(x+2*padding+swatchWidth, rowY+0.5, label, textSize, canvas.FontRegular, canvas.Left)
+	}
+}
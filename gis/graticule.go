@@ -0,0 +1,281 @@
+package gis
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+
+	"github.com/tdewolff/canvas"
+	"github.com/wisepythagoras/gis-utils/config"
+	"github.com/wroge/wgs84"
+)
+
+// The z-index of the graticule and the grid, which are drawn over the features, but under the
+// furniture.
+const gridZIndex = furnitureZIndex - 1
+
+// The number of points that every line of a grid is drawn with, since the lines can be curved in
+// the projection of the map.
+const gridLineSamples = 32
+
+var defaultGridColor = color.RGBA{60, 60, 60, 160}
+
+// gridLine is one of the lines of a graticule or a grid.
+type gridLine struct {
+	points []Point
+	label  string
+	// Lines that run from south to north are labelled at the bottom of the map, and the rest of
+	// them on the left.
+	northward bool
+}
+
+// DrawGrids draws the graticule and the UTM grid, if they're configured in the styles.
+func (img *Image) DrawGrids() {
+	if img.Config == nil {
+		return
+	}
+
+	if graticule := img.Config.GetGraticule(); graticule != nil {
+		img.DrawGraticule(graticule)
+	}
+
+	if grid := img.Config.GetGrid(); grid != nil {
+		img.DrawUTMGrid(grid)
+	}
+}
+
+// DrawGraticule draws lines of latitude and longitude at the interval of the style.
+func (img *Image) DrawGraticule(style *config.GraticuleStyle) {
+	bbox := img.BBox
+	interval := style.Interval
+
+	if interval <= 0 {
+		interval = niceLength(math.Max(bbox.lonSpan(), bbox.NE.Lat-bbox.SW.Lat) / 5)
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	lines := make([]gridLine, 0)
+	west := bbox.SW.Lon
+	east := west + bbox.lonSpan()
+
+	for lon := math.Ceil(west/interval) * interval; lon <= east; lon += interval {
+		lines = append(lines, gridLine{
+			points:    sampleLine(Point{Lat: bbox.SW.Lat, Lon: lon}, Point{Lat: bbox.NE.Lat, Lon: lon}, gridLineSamples),
+			label:     formatDegrees(normalizeLon(lon), "E", "W"),
+			northward: true,
+		})
+	}
+
+	for lat := math.Ceil(bbox.SW.Lat/interval) * interval; lat <= bbox.NE.Lat; lat += interval {
+		lines = append(lines, gridLine{
+			points: sampleLine(Point{Lat: lat, Lon: west}, Point{Lat: lat, Lon: east}, gridLineSamples),
+			label:  formatDegrees(lat, "N", "S"),
+		})
+	}
+
+	stroke, width := gridStroke(style.StrokeColor, style.StrokeWidth)
+	img.drawGridLines(lines, stroke, width, style.HideLabels, false)
+}
+
+// DrawUTMGrid draws the lines of a UTM grid at the interval of the style. The grid is drawn in the
+// zone of the center of the map, unless the style sets one.
+func (img *Image) DrawUTMGrid(style *config.GridStyle) {
+	center := img.BBox.Center()
+	zone := style.Zone
+
+	if zone <= 0 || zone > 60 {
+		zone = int(math.Floor((center.Lon+180)/6)) + 1
+	}
+
+	northern := center.Lat >= 0
+	toUTM := wgs84.LonLat().To(wgs84.UTM(float64(zone), northern))
+	fromUTM := wgs84.UTM(float64(zone), northern).To(wgs84.LonLat())
+
+	// The edges of the map are curved in UTM coordinates, so the extent of the grid is found from
+	// points along all of them.
+	minE, minN := math.Inf(1), math.Inf(1)
+	maxE, maxN := math.Inf(-1), math.Inf(-1)
+	sw, ne := img.BBox.SW, img.BBox.NE
+	edges := [][2]Point{
+		{sw, {Lat: sw.Lat, Lon: ne.Lon}},
+		{{Lat: sw.Lat, Lon: ne.Lon}, ne},
+		{ne, {Lat: ne.Lat, Lon: sw.Lon}},
+		{{Lat: ne.Lat, Lon: sw.Lon}, sw},
+	}
+
+	for _, edge := range edges {
+		for _, p := range sampleLine(edge[0], edge[1], gridLineSamples) {
+			e, n, _ := toUTM(p.Lon, p.Lat, 0)
+			minE, maxE = math.Min(minE, e), math.Max(maxE, e)
+			minN, maxN = math.Min(minN, n), math.Max(maxN, n)
+		}
+	}
+
+	interval := style.Interval
+
+	if interval <= 0 {
+		interval = math.Max(100, niceLength(math.Max(maxE-minE, maxN-minN)/6))
+	}
+
+	// The lines of the grid are straight in UTM, so they're sampled there, rather than between their
+	// ends in latitude and longitude.
+	utmLine := func(e0, n0, e1, n1 float64) []Point {
+		points := make([]Point, 0, gridLineSamples)
+
+		for i := 0; i < gridLineSamples; i++ {
+			t := float64(i) / float64(gridLineSamples-1)
+			lon, lat, _ := fromUTM(e0+(e1-e0)*t, n0+(n1-n0)*t, 0)
+			points = append(points, Point{Lat: lat, Lon: lon})
+		}
+
+		return points
+	}
+
+	lines := make([]gridLine, 0)
+
+	for e := math.Ceil(minE/interval) * interval; e <= maxE; e += interval {
+		lines = append(lines, gridLine{
+			points:    utmLine(e, minN, e, maxN),
+			label:     formatGridDistance(e, "E"),
+			northward: true,
+		})
+	}
+
+	for n := math.Ceil(minN/interval) * interval; n <= maxN; n += interval {
+		lines = append(lines, gridLine{
+			points: utmLine(minE, n, maxE, n),
+			label:  formatGridDistance(n, "N"),
+		})
+	}
+
+	stroke, width := gridStroke(style.StrokeColor, style.StrokeWidth)
+	// The labels go on the other edges than the ones of the graticule, so that both can be drawn.
+	img.drawGridLines(lines, stroke, width, style.HideLabels, true)
+}
+
+// drawGridLines draws the lines in page coordinates, so that their width is in millimetres, and
+// labels them where they cross the bottom and left edges of the map, or the top and right ones.
+func (img *Image) drawGridLines(lines []gridLine, stroke color.Color, width float64, hideLabels, farEdges bool) {
+	left, bottom := img.Margin, img.Margin
+	right, top := img.Width-img.Margin, img.Height-img.Margin
+
+	for _, line := range lines {
+		path := &canvas.Path{}
+		points := make([]canvas.Point, 0, len(line.points))
+
+		for i, p := range line.points {
+			x, y := img.toPage(p)
+			points = append(points, canvas.Point{X: x, Y: y})
+
+			if i == 0 {
+				path.MoveTo(x, y)
+			} else {
+				path.LineTo(x, y)
+			}
+		}
+
+		img.drawPagePathAt(gridZIndex, 0, 0, path, canvas.Transparent, stroke, width)
+
+		if hideLabels {
+			continue
+		}
+
+		switch {
+		case line.northward && !farEdges:
+			if p, ok := lineCrossing(points, bottom, false); ok && p.X >= left && p.X <= right {
+				img.drawFurnitureText(p.X+0.8, bottom+1.2, line.label, 6, canvas.FontRegular, canvas.Left)
+			}
+		case line.northward:
+			if p, ok := lineCrossing(points, top, false); ok && p.X >= left && p.X <= right {
+				img.drawFurnitureText(p.X+0.8, top-3.2, line.label, 6, canvas.FontRegular, canvas.Left)
+			}
+		case !farEdges:
+			if p, ok := lineCrossing(points, left, true); ok && p.Y >= bottom && p.Y <= top {
+				img.drawFurnitureText(left+1, p.Y+0.8, line.label, 6, canvas.FontRegular, canvas.Left)
+			}
+		default:
+			if p, ok := lineCrossing(points, right, true); ok && p.Y >= bottom && p.Y <= top {
+				img.drawFurnitureText(right-1, p.Y+0.8, line.label, 6, canvas.FontRegular, canvas.Right)
+			}
+		}
+	}
+}
+
+// lineCrossing returns the first point where the line crosses the horizontal line at the value, or
+// the vertical one if vertical is true.
+func lineCrossing(points []canvas.Point, value float64, vertical bool) (canvas.Point, bool) {
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		av, bv := a.Y, b.Y
+
+		if vertical {
+			av, bv = a.X, b.X
+		}
+
+		if av == bv || (av-value)*(bv-value) > 0 {
+			continue
+		}
+
+		t := (value - av) / (bv - av)
+
+		return canvas.Point{X: a.X + (b.X-a.X)*t, Y: a.Y + (b.Y-a.Y)*t}, true
+	}
+
+	return canvas.Point{}, false
+}
+
+// sampleLine returns the number of points evenly spaced between a and b, both included.
+func sampleLine(a, b Point, samples int) []Point {
+	points := make([]Point, 0, samples)
+
+	for i := 0; i < samples; i++ {
+		t := float64(i) / float64(samples-1)
+		points = append(points, Point{
+			Lat: a.Lat + (b.Lat-a.Lat)*t,
+			Lon: a.Lon + (b.Lon-a.Lon)*t,
+		})
+	}
+
+	return points
+}
+
+func gridStroke(colorStr string, width float64) (color.Color, float64) {
+	var stroke color.Color = defaultGridColor
+
+	if len(colorStr) > 0 {
+		if c, err := config.ParseColor(colorStr); err == nil {
+			stroke = *c
+		}
+	}
+
+	if width <= 0 {
+		width = 0.2
+	}
+
+	return stroke, width
+}
+
+// formatDegrees formats a latitude or longitude with its hemisphere, e.g. 23.5°E.
+func formatDegrees(value float64, positive, negative string) string {
+	hemisphere := positive
+
+	if value < 0 {
+		hemisphere = negative
+	} else if value == 0 {
+		hemisphere = ""
+	}
+
+	// Rounding hides the errors that adding up the interval leaves.
+	rounded := math.Round(math.Abs(value)*1e6) / 1e6
+
+	return strconv.FormatFloat(rounded, 'f', -1, 64) + "°" + hemisphere
+}
+
+// formatGridDistance formats an easting or a northing in kilometres, e.g. 451km E.
+func formatGridDistance(value float64, axis string) string {
+	return fmt.Sprintf("%skm %s", strconv.FormatFloat(math.Round(value)/1000, 'f', -1, 64), axis)
+}
@@ -2,21 +2,55 @@ package gis
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"image/color"
+	"log/slog"
+	"math"
 
+	"github.com/samber/lo"
 	"github.com/tdewolff/canvas"
 	"github.com/tdewolff/canvas/renderers"
 	"github.com/wisepythagoras/gis-utils/config"
-	"github.com/wroge/wgs84"
 )
 
+// The z-index of the frame that covers the margins, which needs to be above everything in the map.
+const marginZIndex = 1 << 20
+
+// Image renders map features onto a canvas. All of the dimensions are in millimetres.
 type Image struct {
-	BBox      *BBox
-	Width     float64
-	Config    *config.Config
+	BBox *BBox
+	// The width of the output, including the margins.
+	Width float64
+	// The height of the output, including the margins. If it's 0, it's computed from the aspect
+	// ratio of the bounding box. Otherwise, the bounding box is grown to fill the whole height or
+	// width, so that the scale is the same in both directions.
+	Height float64
+	// The blank space around the map.
+	Margin float64
+	// The resolution of the raster outputs. If it's 0, one pixel per millimetre is used.
+	DPI float64
+	// The projection that the map is drawn in. If it's nil, Web Mercator is used.
+	Projection *Projection
+	// The zoom level that the zoom ranges of the layers are compared to. If it's nil, it's computed
+	// from the scale of the map.
+	Zoom   *float64
+	Config *config.Config
+	// The number of goroutines that the features are prepared on. If it's 0, there's one for every
+	// CPU.
+	Workers int
+	// Progress is told how many of the features have been drawn, if it's set.
+	Progress  Progress
 	mapCanvas *canvas.Canvas
 	context   *canvas.Context
+	// The styles that were drawn, for the legend, in the order that they were first drawn in.
+	usedStyles []*config.FeatureStyle
+	// Whether each style is in usedStyles, so that it's only added once.
+	usedStyleSet map[*config.FeatureStyle]bool
+	// How much of each corner of the map is taken up by furniture.
+	cornerOffsets map[string]float64
+	// The images of the image patterns, by their filenames.
+	patternTiles map[string]patternTile
 }
 
 func (img *Image) Init() error {
@@ -24,31 +58,80 @@ func (img *Image) Init() error {
 		return errors.New("no bounding box found")
 	}
 
-	// Here we convert the WGS84 projection to Webmercator, because WGS84 looks a little weird when
-	// drawn on the map.
-	convert := wgs84.LonLat().To(wgs84.WebMercator())
-	xmin, ymin, _ := convert(img.BBox.SW.Lon, img.BBox.SW.Lat, 0)
-	xmax, ymax, _ := convert(img.BBox.NE.Lon, img.BBox.NE.Lat, 0)
+	mapWidth := img.Width - 2*img.Margin
+
+	if mapWidth <= 0 {
+		return errors.New("the margins don't leave any space for the map")
+	}
+
+	if img.Projection == nil {
+		img.Projection = DefaultProjection()
+	}
+
+	// The map is drawn in projected coordinates, since plain latitudes and longitudes look a little
+	// weird when drawn on the map.
+	xmin, ymin, xmax, ymax := img.Projection.Extent(img.BBox)
+
+	var mapHeight float64
+
+	if img.Height > 0 {
+		mapHeight = img.Height - 2*img.Margin
 
-	height := img.Width * (ymax - ymin) / (xmax - xmin)
-	mapCanvas := canvas.New(img.Width, height)
+		if mapHeight <= 0 {
+			return errors.New("the margins don't leave any space for the map")
+		}
+
+		// Grow the extent in the direction that's too short for the page, so that the requested
+		// area is fully visible and centered.
+		if (xmax-xmin)/(ymax-ymin) < mapWidth/mapHeight {
+			grow := (ymax-ymin)*mapWidth/mapHeight - (xmax - xmin)
+			xmin -= grow / 2
+			xmax += grow / 2
+		} else {
+			grow := (xmax-xmin)*mapHeight/mapWidth - (ymax - ymin)
+			ymin -= grow / 2
+			ymax += grow / 2
+		}
+
+		img.BBox = img.Projection.BBox(xmin, ymin, xmax, ymax)
+	} else {
+		mapHeight = mapWidth * (ymax - ymin) / (xmax - xmin)
+		img.Height = mapHeight + 2*img.Margin
+	}
+
+	mapCanvas := canvas.New(img.Width, img.Height)
 	context := canvas.NewContext(mapCanvas)
 
 	fillColor := &color.RGBA{222, 236, 240, 255}
 
+	// Colours that can't be parsed keep their defaults, and they're reported by Config.Validate.
 	if img.Config != nil {
-		fillColor, _ = img.Config.GetFillColor()
+		if c, err := img.Config.GetFillColor(); err == nil {
+			fillColor = c
+		}
 	}
 
 	// The background color is set here. This should load from a configuration file.
 	context.SetFillColor(fillColor)
-	context.DrawPath(0.0, 0.0, canvas.Rectangle(img.Width, height))
+	context.DrawPath(img.Margin, img.Margin, canvas.Rectangle(mapWidth, mapHeight))
+
+	// Since the canvas can't clip, anything that's drawn past the edges of the map is hidden with a
+	// frame over the margins.
+	if img.Margin > 0 {
+		frame := canvas.Rectangle(img.Width, img.Height)
+		frame = frame.Append(canvas.Rectangle(mapWidth, mapHeight).Translate(img.Margin, img.Margin).Reverse())
+
+		context.SetZIndex(marginZIndex)
+		context.SetFillColor(canvas.White)
+		context.DrawPath(0, 0, frame)
+		context.SetZIndex(0)
+	}
 
 	// Set the coordinate scaling, so that we can just start adding points from our shapefiles and
-	// protobuf files with the Webmercator projection.
-	xscale := img.Width / (xmax - xmin)
-	yscale := height / (ymax - ymin)
-	context.SetView(canvas.Identity.Translate(0.0, 0.0).Scale(xscale, yscale).Translate(-xmin, -ymin))
+	// protobuf files once they're projected.
+	xscale := mapWidth / (xmax - xmin)
+	yscale := mapHeight / (ymax - ymin)
+	context.SetView(canvas.Identity.Translate(img.Margin, img.Margin).Scale(xscale, yscale).Translate(-xmin, -ymin))
 
 	img.context = context
 	img.mapCanvas = mapCanvas
@@ -56,18 +139,84 @@ func (img *Image) Init() error {
 	return nil
 }
 
-// DrawShapePolygons draws polygons found in the land shapefile.
+// project converts a point to the projected coordinates that the map is drawn in.
+func (img *Image) project(p Point) (float64, float64) {
+	return img.Projection.Project(p)
+}
+
+// toPage converts a point to page coordinates, in millimetres from the bottom left corner.
+func (img *Image) toPage(p Point) (float64, float64) {
+	x, y := img.project(p)
+	pagePoint := img.context.View().Dot(canvas.Point{X: x, Y: y})
+
+	return pagePoint.X, pagePoint.Y
+}
+
+// Resolution returns the resolution of the raster outputs.
+func (img *Image) Resolution() canvas.Resolution {
+	if img.DPI <= 0 {
+		return canvas.DPMM(1.0)
+	}
+
+	return canvas.DPI(img.DPI)
+}
+
+// ScaleDenominator returns the N of the 1:N scale of the map, measured along the middle parallel of
+// the bounding box.
+func (img *Image) ScaleDenominator() float64 {
+	return img.BBox.WidthMeters() * 1000 / (img.Width - 2*img.Margin)
+}
+
+// DrawShapePolygons draws polygons found in the land shapefile, in the land layer if the styles
+// have one.
 func (img *Image) DrawShapePolygons(polygons []*ShapePolygon) {
-	convert := wgs84.LonLat().To(wgs84.WebMercator())
+	img.DrawShapePolygonsContext(context.Background(), polygons)
+}
+
+// DrawShapePolygonsContext is DrawShapePolygons, which stops with the error of the context when
+// it's cancelled. The polygons that were drawn by then stay on the map.
+func (img *Image) DrawShapePolygonsContext(ctx context.Context, polygons []*ShapePolygon) error {
+	zIndex, visible := img.layerZIndex(LandLayer, 0)
+
+	if !visible {
+		return nil
+	}
+
+	strokeWidth := 2.0
+	strokeColor := &color.RGBA{205, 205, 205, 255}
+	fillColor := &color.RGBA{255, 255, 255, 255}
 
-	for _, polygon := range polygons {
+	if img.Config != nil {
+		strokeWidth, _ = img.Config.GetLandStrokeWidth()
+
+		if c, err := img.Config.GetLandStrokeColor(); err == nil {
+			strokeColor = c
+		}
+
+		if c, err := img.Config.GetLandFillColor(); err == nil {
+			fillColor = c
+		}
+	}
+
+	// The color of the polygon is going to be painted here. This, also, should come from a styles
+	// or configuration file.s
+	opacity := img.layerOpacity(LandLayer)
+
+	img.context.SetZIndex(zIndex)
+	img.context.SetStrokeColor(scaleColor(*strokeColor, opacity))
+	img.context.SetFillColor(scaleColor(*fillColor, opacity))
+	img.context.SetStrokeWidth(strokeWidth)
+
+	paths := make([]*canvas.Path, len(polygons))
+
+	return img.parallel(ctx, "land", len(polygons), func(_, i int) {
 		path := &canvas.Path{}
 
-		for i, point := range polygon.Points {
+		for j, point := range polygons[i].Points {
 			// Change the projection before creating any shapes on the image.
-			X, Y, _ := convert(point.Lon, point.Lat, 0)
+			X, Y := img.project(point)
 
-			if i == 0 {
+			if j == 0 {
 				path.MoveTo(X, Y)
 			} else {
 				path.LineTo(X, Y)
@@ -75,80 +224,152 @@ func (img *Image) DrawShapePolygons(polygons []*ShapePolygon) {
 		}
 
 		path.Close()
+		paths[i] = path
+	}, func(i int) {
+		img.context.DrawPath(0, 0, paths[i])
+		paths[i] = nil
+	})
+}
 
-		strokeWidth := 2.0
-		strokeColor := &color.RGBA{205, 205, 205, 255}
-		fillColor := &color.RGBA{255, 255, 255, 255}
+// DrawWays draws the ways, or the multipolygon relations, that have a style. They're drawn in the
+// layers of their styles, so the order that they're drawn in doesn't matter.
+func (img *Image) DrawWays(ways []*RichWay) {
+	img.DrawWaysContext(context.Background(), ways)
+}
 
-		if img.Config != nil {
-			strokeWidth, _ = img.Config.GetLandStrokeWidth()
-			strokeColor, _ = img.Config.GetLandStrokeColor()
-			fillColor, _ = img.Config.GetLandFillColor()
-		}
+// DrawWaysContext is DrawWays, which stops with the error of the context when it's cancelled. The
+// ways that were drawn by then stay on the map.
+func (img *Image) DrawWaysContext(ctx context.Context, ways []*RichWay) error {
+	if img.Config == nil {
+		return nil
+	}
 
-		// The color of the polygon is going to be painted here. This, also, should come from a styles
-		// or configuration file.s
-		img.context.SetStrokeColor(strokeColor)
-		img.context.SetFillColor(fillColor)
-		img.context.SetStrokeWidth(strokeWidth)
-		img.context.DrawPath(0, 0, path)
+	// The paths and the styles are prepared on the workers, and drawn in the order of the ways.
+	type preparedWay struct {
+		path    *canvas.Path
+		styles  []*config.FeatureStyle
+		matches []debugMatch
 	}
-}
 
-func (img *Image) DrawWays(ways []*RichWay) {
-	for _, way := range ways {
-		var style *config.FeatureStyle
+	prepared := make([]preparedWay, len(ways))
+	tagMaps := make([]map[string]string, img.workers())
+	logger := img.Config.Log()
 
-		if img.Config != nil {
-			style = img.getStyleFromTags(way)
+	return img.parallel(ctx, "ways", len(ways), func(worker, i int) {
+		if tagMaps[worker] == nil {
+			tagMaps[worker] = make(map[string]string)
 		}
 
-		if style == nil {
-			continue
+		styles, matches := img.getStylesFromTags(ways[i], tagMaps[worker])
+		prepared[i] = preparedWay{styles: styles, matches: matches}
+
+		if len(styles) > 0 {
+			prepared[i].path = img.wayPath(ways[i])
 		}
+	}, func(i int) {
+		way := prepared[i]
+		prepared[i] = preparedWay{}
 
-		path := &canvas.Path{}
+		img.logMatches(logger, ways[i], way.matches)
+
+		for _, style := range way.styles {
+			img.drawStyledPath(way.path, style)
+			img.drawLabel(ways[i], style)
+		}
+	})
+}
 
-		img.context.SetFillColor(color.Transparent)
-		img.context.SetStrokeColor(color.Transparent)
+// wayPath returns the path of the rings of the way.
+func (img *Image) wayPath(way *RichWay) *canvas.Path {
+	path := &canvas.Path{}
 
-		for _, ring := range way.Points {
-			for i, point := range ring {
-				if i == 0 {
-					path.MoveTo(point.X, point.Y)
-				} else {
-					path.LineTo(point.X, point.Y)
-				}
+	for _, ring := range way.Points {
+		for i, point := range ring {
+			x, y := img.project(point)
+
+			if i == 0 {
+				path.MoveTo(x, y)
+			} else {
+				path.LineTo(x, y)
 			}
 		}
+	}
 
-		strokeWidth := 0.0
-		strokeColor := &color.RGBA{0, 0, 0, 0}
-		fillColor := &color.RGBA{0, 0, 0, 0}
+	return path
+}
 
-		if style.StrokeWidth > 0 {
-			strokeWidth = style.StrokeWidth
-		}
+// useStyle adds the style to the ones in the legend, unless it's already been drawn.
+func (img *Image) useStyle(style *config.FeatureStyle) {
+	if img.usedStyleSet == nil {
+		img.usedStyleSet = make(map[*config.FeatureStyle]bool)
+	}
 
-		if style.StrokeColor != "" {
-			strokeColor, _ = config.ParseColor(style.StrokeColor)
-		}
+	if !img.usedStyleSet[style] {
+		img.usedStyleSet[style] = true
+		img.usedStyles = append(img.usedStyles, style)
+	}
+}
 
-		if style.FillColor != "" {
-			fillColor, _ = config.ParseColor(style.FillColor)
-		}
+// drawStyledPath draws the path of a way with one of its styles.
+func (img *Image) drawStyledPath(path *canvas.Path, style *config.FeatureStyle) {
+	zIndex, visible := img.layerZIndex(style.Layer, style.ZIndex)
 
-		if style.Dashed {
-			img.context.SetDashes(0.0, style.StrokeWidth, style.StrokeWidth)
-		}
+	if !visible {
+		return
+	}
+
+	img.useStyle(style)
+
+	strokeWidth := img.strokeWidth(style)
+	strokeColor := &color.RGBA{0, 0, 0, 0}
+	fillColor := &color.RGBA{0, 0, 0, 0}
 
-		img.context.SetStrokeWidth(strokeWidth)
-		img.context.SetStrokeColor(*strokeColor)
-		img.context.SetFillColor(*fillColor)
-		img.context.SetZIndex(style.ZIndex)
+	if c, err := config.ParseColor(style.StrokeColor); err == nil {
+		strokeColor = c
+	}
+
+	if c, err := config.ParseColor(style.FillColor); err == nil {
+		fillColor = c
+	}
+
+	layerOpacity := img.Config.GetOpacity() * img.layerOpacity(style.Layer)
+	fillOpacity := layerOpacity * optionalOpacity(style.FillOpacity)
+	strokeOpacity := layerOpacity * optionalOpacity(style.StrokeOpacity)
+
+	img.drawCasing(style, path, strokeOpacity)
+	img.setLineStyle(style, true)
+	img.context.SetStrokeWidth(strokeWidth)
+	img.context.SetStrokeColor(scaleColor(*strokeColor, strokeOpacity))
+	img.context.SetFillColor(scaleColor(*fillColor, fillOpacity))
+	img.context.SetZIndex(zIndex)
+
+	if style.FillPattern == nil {
 		img.context.DrawPath(0, 0, path)
 		img.context.ResetStyle()
+		return
+	}
+
+	// The pattern goes between the fill and the outline, so the path is drawn in two steps.
+	img.context.SetStrokeColor(color.Transparent)
+	img.context.DrawPath(0, 0, path)
+
+	if err := img.drawFillPattern(path, style.FillPattern, zIndex, fillOpacity); err != nil {
+		img.Config.Log().Warn("unable to draw the fill pattern", "error", err)
+	}
+
+	img.context.SetFillColor(color.Transparent)
+	img.context.SetStrokeColor(scaleColor(*strokeColor, strokeOpacity))
+	img.context.DrawPath(0, 0, path)
+	img.context.ResetStyle()
+}
+
+// optionalOpacity returns the opacity, or 1 if it's not set.
+func optionalOpacity(opacity *float64) float64 {
+	if opacity == nil {
+		return 1
 	}
+
+	return math.Max(0, math.Min(1, *opacity))
 }
 
 func (img *Image) PNG(filename string, resolution canvas.Resolution) error {
@@ -159,6 +380,48 @@ func (img *Image) SVG(filename string) error {
 	return img.mapCanvas.WriteFile(filename, renderers.SVG())
 }
 
+func (img *Image) PDF(filename string) error {
+	return img.mapCanvas.WriteFile(filename, renderers.PDF())
+}
+
+func (img *Image) JPEG(filename string, quality int) error {
+	return img.WriteFile(filename, FormatJPEG, quality)
+}
+
+// WebP writes the image as a lossy WebP. Even at the quality of 100 it's lossy, so WebPLossless
+// needs to be used for a lossless one.
+func (img *Image) WebP(filename string, quality int) error {
+	return img.WriteFile(filename, FormatWebP, quality)
+}
+
+// WebPLossless writes the image as a lossless WebP.
+func (img *Image) WebPLossless(filename string) error {
+	return img.WriteFile(filename, FormatWebPLossless, 0)
+}
+
+// WriteFile writes the image in the given format. The quality (1-100) is only used by the lossy
+// formats, DefaultQuality is used if it's 0, and higher ones are clamped to 100.
+func (img *Image) WriteFile(filename string, format ImageFormat, quality int) error {
+	writer, err := img.writer(format, quality)
+
+	if err != nil {
+		return err
+	}
+
+	return img.mapCanvas.WriteFile(filename, writer)
+}
+
+// Bytes returns the encoded image in the given format, the same way as WriteFile.
+func (img *Image) Bytes(format ImageFormat, quality int) ([]byte, error) {
+	writer, err := img.writer(format, quality)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return img.getImageBytes(writer)
+}
+
 func (img *Image) getImageBytes(writer canvas.Writer) ([]byte, error) {
 	var b bytes.Buffer
 
@@ -174,53 +437,97 @@ func (img *Image) SVGBytes() ([]byte, error) {
 }
 
 func (img *Image) PNGBytes() ([]byte, error) {
-	return img.getImageBytes(renderers.PNG())
+	return img.getImageBytes(renderers.PNG(img.Resolution()))
 }
 
 func (img *Image) TIFFBytes() ([]byte, error) {
-	return img.getImageBytes(renderers.TIFF())
+	return img.getImageBytes(renderers.TIFF(img.Resolution()))
+}
+
+func (img *Image) PDFBytes() ([]byte, error) {
+	return img.getImageBytes(renderers.PDF())
+}
+
+func (img *Image) JPEGBytes(quality int) ([]byte, error) {
+	return img.Bytes(FormatJPEG, quality)
+}
+
+func (img *Image) WebPBytes(quality int) ([]byte, error) {
+	return img.Bytes(FormatWebP, quality)
 }
 
-func (img *Image) getStyleFromTags(way *RichWay) (style *config.FeatureStyle) {
-	tagMap := make(map[string]string)
+func (img *Image) WebPLosslessBytes() ([]byte, error) {
+	return img.Bytes(FormatWebPLossless, 0)
+}
+
+// debugMatch is a style that a way matched, and whether the way is drawn with it, for -debug-styles.
+type debugMatch struct {
+	match config.StyleMatch
+	drawn bool
+}
+
+// getStylesFromTags returns the styles that the way is drawn with, which are resolved the same way
+// whatever the order of its tags is, along with all of the matches if the styles are debugged. The
+// tag map is reused for every way, so that it isn't allocated every time.
+func (img *Image) getStylesFromTags(way *RichWay, tagMap map[string]string) ([]*config.FeatureStyle, []debugMatch) {
+	clear(tagMap)
 
 	for _, tag := range way.Way.Tags {
 		tagMap[tag.Key] = tag.Value
 	}
 
-	// First we look through the list of way ids (if there are any) in the styles. If a style is
-	// found, then we can check if it should be excluded.
-	style, _ = img.Config.QueryId(int64(way.Way.ID))
+	// Styles that aren't used at the zoom level of the map don't compete with the ones that are.
+	zoom := img.ZoomLevel()
+	matches := lo.Filter(img.Config.Match(tagMap, int64(way.Way.ID)), func(match config.StyleMatch, _ int) bool {
+		return match.Style.UsedAtZoom(zoom)
+	})
+	selected := img.Config.SelectStyles(matches)
+	styles := make([]*config.FeatureStyle, 0, len(selected))
 
-	if style != nil && style.ShouldExclude(tagMap, way.Way.ID) {
-		style = nil
-		return
-	} else if style != nil {
-		// If it shouldn't be excluded, then return it.
-		return
+	for _, match := range selected {
+		styles = append(styles, match.Style)
 	}
 
-	// Otherwise, if no style was found from the way id, then we should loop through all the tags
-	// (attributes) and look for any style based on that.
-	for _, tag := range way.Way.Tags {
-		if tag.Key == "website" || tag.Key == "name" {
-			continue
-		}
+	if !img.Config.Debug {
+		return styles, nil
+	}
 
-		// Query the configuration for any styles that apply to the given attribute.
-		tempStyle, _ := img.Config.Query(tag.Key, tag.Value)
+	// The styles that cascade are drawn as part of the style that they're merged into.
+	drawn := make(map[*config.FeatureStyle]bool)
 
-		if tempStyle != nil {
-			if tempStyle.ShouldExclude(tagMap, way.Way.ID) {
-				continue
-			}
+	for _, match := range selected {
+		drawn[match.Style] = true
 
-			style = tempStyle
-			break
+		for _, merged := range match.Merged {
+			drawn[merged.Style] = true
 		}
 	}
 
-	return
+	debugMatches := make([]debugMatch, len(matches))
+
+	for i, match := range matches {
+		debugMatches[i] = debugMatch{match: match, drawn: drawn[match.Style]}
+	}
+
+	return styles, debugMatches
+}
+
+// logMatches logs every style that the way matched, why, and whether it's drawn with it or it lost
+// to another style.
+func (img *Image) logMatches(logger *slog.Logger, way *RichWay, matches []debugMatch) {
+	for _, debug := range matches {
+		match := debug.match
+		logger.Debug(
+			"style match",
+			"way", way.Way.ID,
+			"style", match.Index+1,
+			"name", match.Style.Name,
+			"reason", match.Reason,
+			"priority", match.Style.Priority,
+			"specificity", match.Specificity,
+			"drawn", debug.drawn,
+		)
+	}
 }
 
 // func geoJSON(lat, lon float64) {
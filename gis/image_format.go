@@ -0,0 +1,106 @@
+package gis
+
+import (
+	"fmt"
+	"image/jpeg"
+	"path/filepath"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers"
+)
+
+// ImageFormat is one of the formats that an Image can be written in.
+type ImageFormat string
+
+const (
+	FormatPNG          ImageFormat = "png"
+	FormatJPEG         ImageFormat = "jpeg"
+	FormatWebP         ImageFormat = "webp"
+	FormatWebPLossless ImageFormat = "webp-lossless"
+	FormatTIFF         ImageFormat = "tiff"
+	FormatSVG          ImageFormat = "svg"
+	FormatPDF          ImageFormat = "pdf"
+)
+
+// The quality of the lossy formats when none is given, from 1 to 100.
+const DefaultQuality = 90
+
+// ParseImageFormat returns the format with the given name. File extensions, like "jpg" or "tif",
+// are accepted too.
+func ParseImageFormat(name string) (ImageFormat, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), ".") {
+	case "png":
+		return FormatPNG, nil
+	case "jpg", "jpeg":
+		return FormatJPEG, nil
+	case "webp":
+		return FormatWebP, nil
+	case "webp-lossless":
+		return FormatWebPLossless, nil
+	case "tif", "tiff":
+		return FormatTIFF, nil
+	case "svg":
+		return FormatSVG, nil
+	case "pdf":
+		return FormatPDF, nil
+	}
+
+	return "", fmt.Errorf("unknown image format: %s", name)
+}
+
+// ImageFormatFromFilename returns the format that the extension of the file stands for.
+func ImageFormatFromFilename(filename string) (ImageFormat, error) {
+	return ParseImageFormat(filepath.Ext(filename))
+}
+
+// Available returns why images can't be written in the format by this build, if they can't, so that
+// the commands can tell before they draw anything.
+func (format ImageFormat) Available() error {
+	if format == FormatWebP || format == FormatWebPLossless {
+		return errWebPUnavailable
+	}
+
+	return nil
+}
+
+// Extension returns the file extension of the format, without the dot.
+func (format ImageFormat) Extension() string {
+	switch format {
+	case FormatJPEG:
+		return "jpg"
+	case FormatWebPLossless:
+		return "webp"
+	}
+
+	return string(format)
+}
+
+// writer returns the canvas writer of the format. The quality is only used by the lossy formats,
+// the default one is used if it's 0, and it's clamped to 100.
+func (img *Image) writer(format ImageFormat, quality int) (canvas.Writer, error) {
+	if quality <= 0 {
+		quality = DefaultQuality
+	}
+
+	quality = min(quality, 100)
+
+	switch format {
+	case FormatPNG:
+		return renderers.PNG(img.Resolution()), nil
+	case FormatJPEG:
+		return renderers.JPEG(img.Resolution(), &jpeg.Options{Quality: quality}), nil
+	case FormatWebP:
+		return webpWriter(img.Resolution(), quality, false)
+	case FormatWebPLossless:
+		return webpWriter(img.Resolution(), quality, true)
+	case FormatTIFF:
+		return renderers.TIFF(img.Resolution()), nil
+	case FormatSVG:
+		return renderers.SVG(), nil
+	case FormatPDF:
+		return renderers.PDF(), nil
+	}
+
+	return nil, fmt.Errorf("unknown image format: %s", format)
+}
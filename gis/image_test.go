@@ -0,0 +1,179 @@
+package gis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wisepythagoras/gis-utils/config"
+)
+
+// The styles that the benchmarks draw the extract with, unless GIS_UTILS_BENCH_STYLES is set.
+const benchmarkStyles = `
+layers:
+  - name: landuse
+  - name: roads
+styles:
+  - name: Water
+    queries: [{attribute: natural, value: water}, {attribute: waterway, value: riverbank}]
+    fill_color: "#aad3df"
+    layer: landuse
+  - name: Woodland
+    queries: [{attribute: landuse, value: forest}, {attribute: natural, value: wood}]
+    fill_color: "#add19e"
+    layer: landuse
+  - name: Buildings
+    queries: [{attribute: building, value: "*"}]
+    fill_color: "#d9d0c9"
+    stroke_color: "#c4b6ab"
+    stroke_width: 0.2
+    layer: landuse
+  - name: Major roads
+    queries: [{attribute: highway, value: motorway}, {attribute: highway, value: trunk}, {attribute: highway, value: primary}]
+    stroke_color: "#fcd6a4"
+    width_stops: [[10, 1], [16, 8]]
+    casing: {width: 1, color: "#c0a070"}
+    layer: roads
+    z_index: 3
+  - name: Minor roads
+    queries: [{attribute: highway, value: secondary}, {attribute: highway, value: tertiary}, {attribute: highway, value: residential}]
+    stroke_color: "#ffffff"
+    width_stops: [[12, 0.5], [16, 5]]
+    casing: {width: 0.5, color: "#bbbbbb"}
+    layer: roads
+    z_index: 2
+  - name: Paths
+    queries: [{attribute: highway, value: footway}, {attribute: highway, value: path}, {attribute: highway, value: cycleway}]
+    stroke_color: "#fa8072"
+    stroke_width: 0.5
+    dash_array: [2, 1]
+    layer: roads
+  - name: Other roads
+    queries: [{attribute: highway, value: "*"}]
+    stroke_color: "#eeeeee"
+    stroke_width: 0.5
+    layer: roads
+    priority: -1
+`
+
+// loadBenchmarkExtract loads the extract that the benchmarks draw, which is GIS_UTILS_BENCH_EXTRACT
+// or testdata/extract.osm.pbf, along with the styles. The benchmarks are skipped without it, since
+// real extracts are too large to keep in the repository.
+func loadBenchmarkExtract(b *testing.B) (*PBF, *config.Config) {
+	b.Helper()
+
+	filename := os.Getenv("GIS_UTILS_BENCH_EXTRACT")
+
+	if len(filename) == 0 {
+		filename = "testdata/extract.osm.pbf"
+	}
+
+	if _, err := os.Stat(filename); err != nil {
+		b.Skipf("no extract to benchmark with: %s", err)
+	}
+
+	pbf := &PBF{}
+	pbf.Init()
+
+	if err := pbf.LoadFile(filename); err != nil {
+		b.Fatal(err)
+	}
+
+	conf := &config.Config{UseMap: true}
+	var err error
+
+	if styles := os.Getenv("GIS_UTILS_BENCH_STYLES"); len(styles) > 0 {
+		err = conf.ParseFile(styles)
+	} else {
+		err = conf.Parse([]byte(benchmarkStyles))
+	}
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return pbf, conf
+}
+
+func BenchmarkGetStylesFromTags(b *testing.B) {
+	pbf, conf := loadBenchmarkExtract(b)
+	img := &Image{BBox: pbf.BBox(), Width: 400, Margin: 5, Config: conf}
+
+	if err := img.Init(); err != nil {
+		b.Fatal(err)
+	}
+
+	ways := append(pbf.Ways(), pbf.Relations()...)
+	tagMap := make(map[string]string)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, way := range ways {
+			img.getStylesFromTags(way, tagMap)
+		}
+	}
+
+	b.ReportMetric(float64(len(ways)), "ways/op")
+}
+
+func BenchmarkDrawWays(b *testing.B) {
+	pbf, conf := loadBenchmarkExtract(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		img := &Image{BBox: pbf.BBox(), Width: 400, Margin: 5, Config: conf}
+
+		if err := img.Init(); err != nil {
+			b.Fatal(err)
+		}
+
+		b.StartTimer()
+		img.DrawWays(pbf.Relations())
+		img.DrawWays(pbf.Ways())
+	}
+
+	b.ReportMetric(float64(len(pbf.Ways())+len(pbf.Relations())), "ways/op")
+}
+
+func TestWebP(t *testing.T) {
+	if err := FormatWebP.Available(); err != nil {
+		t.Skip(err)
+	}
+
+	img := &Image{BBox: box(0, 0, 1, 1), Width: 20, Config: &config.Config{}}
+
+	if err := img.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	tests := []struct {
+		filename string
+		write    func(string) error
+		chunk    string
+	}{
+		{"quality.webp", func(filename string) error { return img.WebP(filename, 100) }, "VP8 "},
+		{"clamped.webp", func(filename string) error { return img.WebP(filename, 1000) }, "VP8 "},
+		{"lossless.webp", img.WebPLossless, "VP8L"},
+	}
+
+	for _, test := range tests {
+		filename := filepath.Join(dir, test.filename)
+
+		if err := test.write(filename); err != nil {
+			t.Fatal(err)
+		}
+
+		// The first chunk of the file tells lossy and lossless images apart.
+		data, err := os.ReadFile(filename)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(data) < 16 || string(data[12:16]) != test.chunk {
+			t.Errorf("%s: got the chunk %q, want %q", test.filename, data[12:min(16, len(data))], test.chunk)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package gis
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/tdewolff/canvas"
+	"github.com/wisepythagoras/gis-utils/config"
+)
+
+// The z-index of the labels, which are drawn over all of the features, but under the index grid of
+// atlases and the frame.
+const labelZIndex = marginZIndex - 2
+
+// The default size of labels, in points.
+const defaultTextSize = 8
+
+// drawLabel writes the value of the text tag of the style on the way, in the middle of its first
+// ring. Labels aren't drawn if the layer of the style isn't.
+func (img *Image) drawLabel(way *RichWay, style *config.FeatureStyle) {
+	if len(style.Text) == 0 || len(way.Points) == 0 || len(way.Points[0]) == 0 {
+		return
+	}
+
+	text := way.Way.Tags.Find(style.Text)
+
+	if len(text) == 0 {
+		return
+	} else if _, visible := img.layerZIndex(style.Layer, style.ZIndex); !visible {
+		return
+	}
+
+	textColor := color.RGBA{0, 0, 0, 255}
+
+	if c, err := config.ParseColor(style.TextColor); err == nil {
+		textColor = *c
+	}
+
+	size := style.TextSize
+
+	if size <= 0 {
+		size = defaultTextSize
+	}
+
+	x, y := img.labelPosition(way.Points[0])
+
+	// The text is centered vertically on the point, rather than sitting on it.
+	y -= size * 25.4 / 72 * 0.35
+
+	img.context.SetZIndex(labelZIndex)
+	img.drawPageText(x, y, text, size, canvas.FontRegular, textColor, canvas.Center)
+	img.context.SetZIndex(0)
+}
+
+// labelPosition returns the point that a ring is labelled at, in page coordinates: the center of
+// the bounding box of areas, and the point that's halfway along lines.
+func (img *Image) labelPosition(ring []Point) (float64, float64) {
+	xs := make([]float64, len(ring))
+	ys := make([]float64, len(ring))
+
+	for i, point := range ring {
+		xs[i], ys[i] = img.toPage(point)
+	}
+
+	last := len(ring) - 1
+
+	if len(ring) > 3 && ring[0] == ring[last] {
+		minX, maxX, minY, maxY := xs[0], xs[0], ys[0], ys[0]
+
+		for i := range xs {
+			minX, maxX = math.Min(minX, xs[i]), math.Max(maxX, xs[i])
+			minY, maxY = math.Min(minY, ys[i]), math.Max(maxY, ys[i])
+		}
+
+		return (minX + maxX) / 2, (minY + maxY) / 2
+	}
+
+	length := 0.0
+
+	for i := 1; i < len(ring); i++ {
+		length += math.Hypot(xs[i]-xs[i-1], ys[i]-ys[i-1])
+	}
+
+	remaining := length / 2
+
+	for i := 1; i < len(ring); i++ {
+		segment := math.Hypot(xs[i]-xs[i-1], ys[i]-ys[i-1])
+
+		if segment > 0 && remaining <= segment {
+			t := remaining / segment
+			return xs[i-1] + (xs[i]-xs[i-1])*t, ys[i-1] + (ys[i]-ys[i-1])*t
+		}
+
+		remaining -= segment
+	}
+
+	return xs[0], ys[0]
+}
@@ -0,0 +1,69 @@
+package gis
+
+import (
+	"math"
+
+	"github.com/wisepythagoras/gis-utils/config"
+)
+
+// The range of z-indexes that every layer of the styles takes up. The canvas draws everything in
+// the order of the z-indexes, so each layer is drawn over the ones before it, whichever order its
+// features are drawn in. The z-indexes of the styles need to be within half of it.
+const layerZIndexStep = 2 * (config.MaxZIndex + 1)
+
+// The name of the layer that the land polygons of the shapefile are drawn in, if there is one.
+const LandLayer = "land"
+
+// ZoomLevel returns the zoom level of the map, which is Zoom if it's set, or otherwise the one of a
+// slippy map with the same scale on a 96 DPI screen.
+func (img *Image) ZoomLevel() float64 {
+	if img.Zoom != nil {
+		return *img.Zoom
+	}
+
+	widthPx := (img.Width - 2*img.Margin) / 25.4 * 96
+	worldWidthPx := widthPx * 360 / img.BBox.lonSpan()
+
+	return math.Log2(worldWidthPx / TileSize)
+}
+
+// layerZIndex returns the z-index that a feature with the z-index is drawn at in the layer, and
+// whether the layer is drawn at the zoom level of the map. Features that aren't in any of the
+// layers keep their z-index, which is below all of the layers. The z-index is clamped to the range
+// of a layer, so that the feature isn't drawn with the ones of another layer, or over the labels
+// and the margins.
+func (img *Image) layerZIndex(name string, zIndex int) (int, bool) {
+	zIndex = max(-config.MaxZIndex, min(config.MaxZIndex, zIndex))
+
+	if img.Config == nil {
+		return zIndex, true
+	}
+
+	layer, i := img.Config.GetLayer(name)
+
+	if layer == nil {
+		return zIndex, true
+	}
+
+	zoom := img.ZoomLevel()
+
+	if layer.Hidden || zoom < layer.MinZoom || (layer.MaxZoom > 0 && zoom >= layer.MaxZoom) {
+		return 0, false
+	}
+
+	return (i+1)*layerZIndexStep + zIndex, true
+}
+
+// layerOpacity returns the opacity of the layer, which is 1 for features that aren't in any of the
+// layers.
+func (img *Image) layerOpacity(name string) float64 {
+	if img.Config == nil {
+		return 1
+	}
+
+	if layer, _ := img.Config.GetLayer(name); layer != nil {
+		return optionalOpacity(layer.Opacity)
+	}
+
+	return 1
+}
@@ -0,0 +1,54 @@
+package gis
+
+import (
+	"testing"
+
+	"github.com/wisepythagoras/gis-utils/config"
+)
+
+func TestLayerZIndex(t *testing.T) {
+	conf := &config.Config{}
+	err := conf.Parse([]byte(`
+layers:
+  - name: roads
+  - name: labels
+    min_zoom: 14
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zoom := 15.0
+	img := &Image{Config: conf, Zoom: &zoom}
+
+	tests := []struct {
+		layer  string
+		zIndex int
+		want   int
+	}{
+		{"roads", 3, layerZIndexStep + 3},
+		{"labels", -3, 2*layerZIndexStep - 3},
+		// The z-indexes are clamped, so that they're never drawn with the next layer.
+		{"roads", 3000, layerZIndexStep + config.MaxZIndex},
+		{"labels", -5000, 2*layerZIndexStep - config.MaxZIndex},
+		{"", 3, 3},
+		{"", 5000, config.MaxZIndex},
+		// A layer that isn't defined is drawn under all of them.
+		{"road", 3000, config.MaxZIndex},
+	}
+
+	for _, test := range tests {
+		got, visible := img.layerZIndex(test.layer, test.zIndex)
+
+		if got != test.want || !visible {
+			t.Errorf("%q at %d: got %d (visible: %v), want %d", test.layer, test.zIndex, got, visible, test.want)
+		}
+	}
+
+	zoom = 12
+
+	if _, visible := img.layerZIndex("labels", 0); visible {
+		t.Error("the labels are visible below their minimum zoom level")
+	}
+}
@@ -0,0 +1,122 @@
+package gis
+
+import (
+	"math"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+	"github.com/wisepythagoras/gis-utils/config"
+)
+
+// lineCapper returns the capper of the line cap, or the default butt cap if the name is unknown.
+func lineCapper(name string) canvas.Capper {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "round":
+		return canvas.RoundCap
+	case "square":
+		return canvas.SquareCap
+	}
+
+	return canvas.ButtCap
+}
+
+// lineJoiner returns the joiner of the line join, or the default miter join if the name is unknown.
+func lineJoiner(name string, miterLimit float64) canvas.Joiner {
+	if miterLimit <= 0 {
+		miterLimit = 4
+	}
+
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "round":
+		return canvas.RoundJoin
+	case "bevel":
+		return canvas.BevelJoin
+	case "miter-clip":
+		return canvas.MiterJoiner{GapJoiner: nil, Limit: miterLimit}
+	case "arcs":
+		return canvas.ArcsJoiner{GapJoiner: canvas.BevelJoin, Limit: miterLimit}
+	}
+
+	return canvas.MiterJoiner{GapJoiner: canvas.BevelJoin, Limit: miterLimit}
+}
+
+// strokeWidth returns the width of the stroke of the style in map units, from its width stops if it
+// has them.
+func (img *Image) strokeWidth(style *config.FeatureStyle) float64 {
+	if len(style.WidthStops) > 0 {
+		return img.styleLength(style, style.WidthAtZoom(img.ZoomLevel()))
+	}
+
+	return math.Max(0, style.StrokeWidth)
+}
+
+// styleLength converts a length of the style, like a dash, to map units. The lengths of styles with
+// width stops are in 96 DPI pixels, and the rest of them are already in map units.
+func (img *Image) styleLength(style *config.FeatureStyle, length float64) float64 {
+	if len(style.WidthStops) == 0 {
+		return length
+	}
+
+	mmPerUnit := img.context.View()[0][0]
+
+	return length * 25.4 / 96 / mmPerUnit
+}
+
+// setLineStyle sets the caps, the joins and the dashes of the style on the context.
+func (img *Image) setLineStyle(style *config.FeatureStyle, dashed bool) {
+	img.context.SetStrokeCapper(lineCapper(style.LineCap))
+	img.context.SetStrokeJoiner(lineJoiner(style.LineJoin, style.MiterLimit))
+
+	if !dashed {
+		return
+	}
+
+	offset := img.styleLength(style, style.DashOffset)
+
+	if len(style.DashArray) > 0 {
+		dashes := make([]float64, len(style.DashArray))
+
+		for i, dash := range style.DashArray {
+			dashes[i] = img.styleLength(style, dash)
+		}
+
+		img.context.SetDashes(offset, dashes...)
+	} else if style.Dashed {
+		strokeWidth := img.strokeWidth(style)
+		img.context.SetDashes(offset, strokeWidth, strokeWidth)
+	}
+}
+
+// drawCasing draws the casing of the style under the path.
+func (img *Image) drawCasing(style *config.FeatureStyle, path *canvas.Path, opacity float64) {
+	casing := style.Casing
+	width := style.CasingWidthAtZoom(img.ZoomLevel())
+
+	if casing == nil || width <= 0 || len(casing.Color) == 0 {
+		return
+	}
+
+	casingColor, err := config.ParseColor(casing.Color)
+
+	if err != nil {
+		return
+	}
+
+	zIndex := style.ZIndex - 1
+
+	if casing.ZIndex != nil {
+		zIndex = *casing.ZIndex
+	}
+
+	// The casing is in the same layer as the line.
+	zIndex, _ = img.layerZIndex(style.Layer, zIndex)
+
+	// Casings are solid, even under dashed lines.
+	img.setLineStyle(style, false)
+	img.context.SetFillColor(canvas.Transparent)
+	img.context.SetStrokeWidth(img.styleLength(style, width))
+	img.context.SetStrokeColor(scaleColor(*casingColor, opacity))
+	img.context.SetZIndex(zIndex)
+	img.context.DrawPath(0, 0, path)
+	img.context.ResetStyle()
+}
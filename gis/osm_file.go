@@ -0,0 +1,96 @@
+package gis
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadFile opens an OSM data file and picks the decoder from its extension. Supported files are
+// .osm.pbf (or .pbf), .osm, and .osm.bz2 or .osm.gz.
+func (pbf *PBF) LoadFile(filename string) error {
+	return pbf.LoadFileContext(context.Background(), filename)
+}
+
+// LoadFileContext is LoadFile, which stops with the error of the context when it's cancelled. The
+// progress is told how much of the file has been read out of its size.
+func (pbf *PBF) LoadFileContext(ctx context.Context, filename string) error {
+	progress := lockProgress(pbf.Progress)
+	f, name, err := openDecompressed(filename, progress)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pbf":
+		return pbf.loadPBF(ctx, f, progress)
+	case ".osm", ".xml":
+		return pbf.loadXML(ctx, f, progress)
+	default:
+		return fmt.Errorf("unsupported OSM file: %s", filename)
+	}
+}
+
+// decompressedFile closes both the decompressing reader (if there is one) and the file itself.
+type decompressedFile struct {
+	io.Reader
+	file *os.File
+}
+
+func (f *decompressedFile) Close() error {
+	if closer, ok := f.Reader.(io.Closer); ok {
+		closer.Close()
+	}
+
+	return f.file.Close()
+}
+
+// openDecompressed opens a file that may be compressed with gzip or bzip2. The name of the file
+// without the compression extension is returned, so that the caller can figure out the format of
+// the contents. The progress, if there is one, is told how much of the file has been read.
+func openDecompressed(filename string, progress Progress) (io.ReadCloser, string, error) {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	var size int64
+
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	raw := withProgress(file, progress, size)
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+
+	switch ext {
+	case ".gz":
+		reader, err := gzip.NewReader(raw)
+
+		if err != nil {
+			file.Close()
+			return nil, "", err
+		}
+
+		return &decompressedFile{Reader: reader, file: file}, name, nil
+	case ".bz2":
+		return &decompressedFile{Reader: bzip2.NewReader(raw), file: file}, name, nil
+	default:
+		if raw == io.Reader(file) {
+			return file, filename, nil
+		}
+
+		return &decompressedFile{Reader: raw, file: file}, filename, nil
+	}
+}
@@ -0,0 +1,110 @@
+package gis
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/paulmach/osm"
+)
+
+// xmlScanner reads the nodes, ways and relations of an OSM XML document, the way the scanner of
+// osmxml does. Plain XML extracts don't have the visible attribute, so the elements without it are
+// visible, the same way the PBF decoder treats files without history information. Elements with
+// visible="false", like the deleted versions in history files, stay hidden.
+type xmlScanner struct {
+	ctx     context.Context
+	decoder *xml.Decoder
+	next    osm.Object
+	err     error
+}
+
+var _ osm.Scanner = &xmlScanner{}
+
+func newXMLScanner(ctx context.Context, r io.Reader) *xmlScanner {
+	return &xmlScanner{ctx: ctx, decoder: xml.NewDecoder(r)}
+}
+
+// Scan advances to the next node, way or relation, and returns false at the end of the document, or
+// when there's an error.
+func (s *xmlScanner) Scan() bool {
+	for s.err == nil {
+		if s.err = s.ctx.Err(); s.err != nil {
+			break
+		}
+
+		token, err := s.decoder.Token()
+
+		if err != nil {
+			s.err = err
+			break
+		}
+
+		start, ok := token.(xml.StartElement)
+
+		if !ok {
+			continue
+		}
+
+		visible := !hasAttr(start, "visible")
+
+		switch strings.ToLower(start.Name.Local) {
+		case "node":
+			node := &osm.Node{}
+			s.err = s.decoder.DecodeElement(node, &start)
+			node.Visible = node.Visible || visible
+			s.next = node
+		case "way":
+			way := &osm.Way{}
+			s.err = s.decoder.DecodeElement(way, &start)
+			way.Visible = way.Visible || visible
+			s.next = way
+		case "relation":
+			relation := &osm.Relation{}
+			s.err = s.decoder.DecodeElement(relation, &start)
+			relation.Visible = relation.Visible || visible
+			s.next = relation
+		default:
+			continue
+		}
+
+		return s.err == nil
+	}
+
+	return false
+}
+
+// Object returns the element that Scan read.
+func (s *xmlScanner) Object() osm.Object {
+	return s.next
+}
+
+// Err returns the error that stopped the scan, which is nil at the end of the document.
+func (s *xmlScanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+
+	return s.err
+}
+
+// Close stops the scan. The reader isn't closed.
+func (s *xmlScanner) Close() error {
+	if s.err == nil {
+		s.err = osm.ErrScannerClosed
+	}
+
+	return nil
+}
+
+// hasAttr returns whether the element has the attribute.
+func hasAttr(start xml.StartElement, name string) bool {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,40 @@
+package gis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The portrait width and height of the common paper sizes, in millimetres.
+var PaperSizes = map[string][2]float64{
+	"a0":      {841, 1189},
+	"a1":      {594, 841},
+	"a2":      {420, 594},
+	"a3":      {297, 420},
+	"a4":      {210, 297},
+	"a5":      {148, 210},
+	"letter":  {215.9, 279.4},
+	"legal":   {215.9, 355.6},
+	"tabloid": {279.4, 431.8},
+}
+
+// PaperSize returns the width and height of the named paper size (e.g. "A4" or "Letter") in
+// millimetres.
+func PaperSize(name string, landscape bool) (float64, float64, error) {
+	size, ok := PaperSizes[strings.ToLower(strings.TrimSpace(name))]
+
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown paper size: %s", name)
+	}
+
+	if landscape {
+		return size[1], size[0], nil
+	}
+
+	return size[0], size[1], nil
+}
+
+// PixelsToMM converts a number of pixels at the resolution to millimetres.
+func PixelsToMM(pixels, dpi float64) float64 {
+	return pixels / dpi * 25.4
+}
@@ -0,0 +1,69 @@
+package gis
+
+import (
+	"context"
+	"runtime"
+)
+
+// The number of features that a worker prepares at a time.
+const parallelChunkSize = 256
+
+// workers returns the number of goroutines that features are prepared on.
+func (img *Image) workers() int {
+	if img.Workers > 0 {
+		return img.Workers
+	}
+
+	return runtime.NumCPU()
+}
+
+// parallel calls prepare for every index from 0 to n on the workers, and draw for every index in
+// order on the calling goroutine, as soon as it's been prepared. The canvas draws the paths with
+// the same z-index in the order that they were drawn in, so the output is the same however many
+// workers there are. Prepare gets the number of the worker, from 0, for anything that the workers
+// can't share. It stops with the error of the context when it's cancelled.
+func (img *Image) parallel(ctx context.Context, stage string, n int, prepare func(worker, i int), draw func(i int)) error {
+	chunks := (n + parallelChunkSize - 1) / parallelChunkSize
+	done := make([]chan struct{}, chunks)
+	queue := make(chan int, chunks)
+
+	for chunk := range done {
+		done[chunk] = make(chan struct{})
+		queue <- chunk
+	}
+
+	close(queue)
+
+	for worker := 0; worker < min(img.workers(), chunks); worker++ {
+		go func(worker int) {
+			for chunk := range queue {
+				// The rest of the chunks are skipped once the context is cancelled.
+				for i := chunk * parallelChunkSize; i < min(n, (chunk+1)*parallelChunkSize) && ctx.Err() == nil; i++ {
+					prepare(worker, i)
+				}
+
+				close(done[chunk])
+			}
+		}(worker)
+	}
+
+	for chunk := range done {
+		<-done[chunk]
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		end := min(n, (chunk+1)*parallelChunkSize)
+
+		for i := chunk * parallelChunkSize; i < end; i++ {
+			draw(i)
+		}
+
+		if img.Progress != nil {
+			img.Progress.FeaturesProcessed(stage, end, n)
+		}
+	}
+
+	return nil
+}
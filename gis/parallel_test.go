@@ -0,0 +1,115 @@
+package gis
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/paulmach/osm"
+	"github.com/wisepythagoras/gis-utils/config"
+)
+
+// parallelWays returns enough overlapping ways for many chunks, which are drawn with styles that
+// have the same z-index, so that the output depends on the order that they're drawn in.
+func parallelWays(t *testing.T) (*config.Config, []*RichWay) {
+	t.Helper()
+
+	conf := &config.Config{UseMap: true}
+	err := conf.Parse([]byte(`
+styles:
+  - queries: [{attribute: highway, value: primary}]
+    stroke_color: "#e07030"
+    stroke_width: 2
+  - queries: [{attribute: highway, value: secondary}]
+    stroke_color: "#3070e0"
+    stroke_width: 3
+    casing: {width: 1, color: "#000000"}
+  - queries: [{attribute: landuse, value: forest}]
+    fill_color: "rgba(80, 160, 80, 0.5)"
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	values := []osm.Tag{{Key: "highway", Value: "primary"}, {Key: "highway", Value: "secondary"}, {Key: "landuse", Value: "forest"}}
+	ways := make([]*RichWay, 5*parallelChunkSize+17)
+
+	for i := range ways {
+		tag := values[r.Intn(len(values))]
+		points := make([]Point, 0, 4)
+
+		for j := 0; j < 3; j++ {
+			points = append(points, Point{Lat: r.Float64(), Lon: r.Float64()})
+		}
+
+		if tag.Key == "landuse" {
+			points = append(points, points[0])
+		}
+
+		ways[i] = &RichWay{
+			Way:    &osm.Way{ID: osm.WayID(i + 1), Tags: osm.Tags{tag}},
+			Points: [][]Point{points},
+		}
+	}
+
+	return conf, ways
+}
+
+func drawParallel(t *testing.T, conf *config.Config, ways []*RichWay, workers int, progress Progress) []byte {
+	t.Helper()
+
+	img := &Image{BBox: box(0, 0, 1, 1), Width: 60, Config: conf, Workers: workers, Progress: progress}
+
+	if err := img.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	img.DrawWays(ways)
+	data, err := img.PNGBytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestParallelDrawingIsDeterministic(t *testing.T) {
+	conf, ways := parallelWays(t)
+	want := drawParallel(t, conf, ways, 1, nil)
+
+	for _, workers := range []int{2, 8} {
+		if got := drawParallel(t, conf, ways, workers, nil); !bytes.Equal(got, want) {
+			t.Errorf("the map drawn on %d workers is different from the one drawn on 1", workers)
+		}
+	}
+}
+
+func TestParallelProgress(t *testing.T) {
+	conf, ways := parallelWays(t)
+	done := make([]int, 0)
+	progress := ProgressFuncs{Features: func(stage string, n, total int) {
+		if stage != "ways" || total != len(ways) {
+			t.Errorf("got the stage %q with the total %d, want ways with %d", stage, total, len(ways))
+		}
+
+		done = append(done, n)
+	}}
+
+	drawParallel(t, conf, ways, 8, progress)
+
+	// The progress is reported after every chunk is drawn, in order.
+	chunks := (len(ways) + parallelChunkSize - 1) / parallelChunkSize
+
+	if len(done) != chunks {
+		t.Fatalf("got %d progress reports, want one for each of the %d chunks", len(done), chunks)
+	}
+
+	for i, n := range done {
+		if want := min(len(ways), (i+1)*parallelChunkSize); n != want {
+			t.Errorf("report %d: got %d features, want %d", i, n, want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package gis
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var tileRe = regexp.MustCompile(`^(\d+)/(\d+)/(\d+)$`)
+
+// Gazetteer maps place names to their bounding boxes. Names are case insensitive.
+type Gazetteer map[string]*BBox
+
+// Lookup returns the bounding box of the named place.
+func (g Gazetteer) Lookup(name string) (*BBox, bool) {
+	bbox, ok := g[strings.ToLower(strings.TrimSpace(name))]
+	return bbox, ok
+}
+
+// ParseGazetteer reads a gazetteer in CSV format, where each record is a place name followed by
+// its bounding box: name,minLon,minLat,maxLon,maxLat. Lines that start with # are ignored.
+func ParseGazetteer(r io.Reader) (Gazetteer, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 5
+	reader.TrimLeadingSpace = true
+
+	gazetteer := make(Gazetteer)
+
+	for {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		bbox, err := parseCoordsBBox(record[1:])
+
+		if err != nil {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("invalid bounding box for %q on line %d: %w", record[0], line, err)
+		}
+
+		gazetteer[strings.ToLower(strings.TrimSpace(record[0]))] = bbox
+	}
+
+	return gazetteer, nil
+}
+
+// ReadGazetteerFile reads a gazetteer from a CSV file.
+func ReadGazetteerFile(filename string) (Gazetteer, error) {
+	f, err := os.Open(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return ParseGazetteer(f)
+}
+
+// ParseBBox parses a bounding box from any of the following:
+//   - minLon,minLat,maxLon,maxLat
+//   - lat,lon,radius (with the radius in metres, or with a "km" suffix)
+//   - a tile, as z/x/y
+//   - a .poly or GeoJSON file, whose bounds are used
+//   - a place name from the gazetteer (which can be nil)
+func ParseBBox(bboxStr string, gazetteer Gazetteer) (*BBox, error) {
+	bboxStr = strings.TrimSpace(bboxStr)
+
+	if len(bboxStr) == 0 {
+		return nil, errors.New("no bounding box found")
+	}
+
+	if bbox, ok := gazetteer.Lookup(bboxStr); ok {
+		return bbox, nil
+	}
+
+	if matches := tileRe.FindStringSubmatch(bboxStr); matches != nil {
+		return parseTileBBox(matches[1:])
+	}
+
+	parts := strings.Split(bboxStr, ",")
+
+	if len(parts) == 4 {
+		return parseCoordsBBox(parts)
+	} else if len(parts) == 3 {
+		return parseRadiusBBox(parts)
+	}
+
+	if _, err := os.Stat(bboxStr); err == nil {
+		poly, err := ReadAreaFile(bboxStr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return poly.Bounds(), nil
+	}
+
+	return nil, fmt.Errorf("unrecognized bounding box: %s", bboxStr)
+}
+
+func parseFloats(parts []string) ([]float64, error) {
+	values := make([]float64, len(parts))
+
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = value
+	}
+
+	return values, nil
+}
+
+// parseCoordsBBox parses minLon,minLat,maxLon,maxLat. When both the longitudes and the latitudes are
+// reversed, the corners are swapped, which keeps the NE-first order that clip-shapefile used to take
+// working. When only the latitudes are reversed, they're swapped on their own, and otherwise a minLon
+// that's greater than maxLon is a box that crosses the antimeridian.
+func parseCoordsBBox(parts []string) (*BBox, error) {
+	coords, err := parseFloats(parts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bbox := &BBox{
+		SW: Point{Lon: coords[0], Lat: coords[1]},
+		NE: Point{Lon: coords[2], Lat: coords[3]},
+	}
+
+	if bbox.SW.Lat > bbox.NE.Lat && bbox.SW.Lon > bbox.NE.Lon {
+		bbox.SW, bbox.NE = bbox.NE, bbox.SW
+	} else if bbox.SW.Lat > bbox.NE.Lat {
+		bbox.SW.Lat, bbox.NE.Lat = bbox.NE.Lat, bbox.SW.Lat
+	}
+
+	if err := validatePoint(bbox.SW); err != nil {
+		return nil, err
+	}
+
+	if err := validatePoint(bbox.NE); err != nil {
+		return nil, err
+	}
+
+	return bbox, nil
+}
+
+// parseRadiusBBox parses lat,lon,radius into the box that surrounds the circle.
+func parseRadiusBBox(parts []string) (*BBox, error) {
+	radiusStr := strings.ToLower(strings.TrimSpace(parts[2]))
+	multiplier := 1.0
+
+	if strings.HasSuffix(radiusStr, "km") {
+		radiusStr = strings.TrimSuffix(radiusStr, "km")
+		multiplier = 1000
+	} else {
+		radiusStr = strings.TrimSuffix(radiusStr, "m")
+	}
+
+	values, err := parseFloats([]string{parts[0], parts[1], radiusStr})
+
+	if err != nil {
+		return nil, err
+	}
+
+	center := Point{Lat: values[0], Lon: values[1]}
+
+	if err := validatePoint(center); err != nil {
+		return nil, err
+	}
+
+	if values[2] <= 0 {
+		return nil, errors.New("the radius must be positive")
+	}
+
+	bbox := &BBox{SW: center, NE: center}
+
+	return bbox.ExpandMeters(values[2] * multiplier), nil
+}
+
+func parseTileBBox(parts []string) (*BBox, error) {
+	values := make([]uint32, 3)
+
+	for i, part := range parts {
+		value, err := strconv.ParseUint(part, 10, 32)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = uint32(value)
+	}
+
+	z, x, y := values[0], values[1], values[2]
+
+	if z > 30 || x >= 1<<z || y >= 1<<z {
+		return nil, fmt.Errorf("invalid tile: %d/%d/%d", z, x, y)
+	}
+
+	return GetTileBBox(x, y, z), nil
+}
+
+func validatePoint(p Point) error {
+	if p.Lat < -90 || p.Lat > 90 {
+		return fmt.Errorf("latitude out of range: %f", p.Lat)
+	}
+
+	if p.Lon < -180 || p.Lon > 180 {
+		return fmt.Errorf("longitude out of range: %f", p.Lon)
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package gis
+
+import "testing"
+
+func TestParseBBox(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  *BBox
+	}{
+		{"in order", "10,49,11,50", box(10, 49, 11, 50)},
+		{"north-east first", "11,50,10,49", box(10, 49, 11, 50)},
+		{"reversed latitudes", "10,50,11,49", box(10, 49, 11, 50)},
+		{"across the antimeridian", "170,-10,-170,10", box(170, -10, -170, 10)},
+		{"tile", "1/1/0", box(0, 0, 180, 85.0511287798066)},
+		{"out of range", "10,49,11,91", nil},
+		{"not a number", "10,49,11,a", nil},
+		{"unrecognized", "somewhere", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseBBox(test.input, nil)
+
+			if test.want == nil {
+				if err == nil {
+					t.Errorf("got %v, want an error", got)
+				}
+			} else if err != nil {
+				t.Errorf("got the error %v", err)
+			} else if !bboxEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package gis
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/rasterizer"
+	"github.com/wisepythagoras/gis-utils/config"
+	"golang.org/x/image/vector"
+)
+
+// The resolution that PNG and JPEG pattern images are tiled at, which is the one of a screen.
+const patternImageDPMM = 96 / 25.4
+
+// patternImage is an endless image of a fill pattern. Every pixel is computed from its position on
+// the page, so that the patterns of neighbouring areas line up.
+type patternImage struct {
+	pattern *config.FillPattern
+	color   color.RGBA
+	dpmm    float64
+	// The position of the bottom left pixel of the image on the page, and the height of the image.
+	x0, y0, height int
+	// The image that's tiled, for image patterns, and its resolution.
+	tile     image.Image
+	tileDPMM float64
+	opacity  float64
+}
+
+func (p *patternImage) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (p *patternImage) Bounds() image.Rectangle {
+	return image.Rect(-1e9, -1e9, 1e9, 1e9)
+}
+
+func (p *patternImage) At(x, y int) color.Color {
+	// The center of the pixel on the page, in millimetres from the bottom left corner.
+	px := (float64(p.x0+x) + 0.5) / p.dpmm
+	py := (float64(p.y0+p.height-1-y) + 0.5) / p.dpmm
+	spacing := math.Max(p.pattern.Spacing, 0.1)
+	size := math.Max(p.pattern.Size, 0.05)
+	coverage := 0.0
+
+	switch strings.ToLower(p.pattern.Type) {
+	case "cross-hatch":
+		coverage = math.Max(
+			hatchCoverage(px, py, p.pattern.Angle, spacing, size, p.dpmm),
+			hatchCoverage(px, py, p.pattern.Angle+90, spacing, size, p.dpmm),
+		)
+	case "dots":
+		dx := px - spacing*math.Round(px/spacing)
+		dy := py - spacing*math.Round(py/spacing)
+		coverage = (size/2-math.Hypot(dx, dy))*p.dpmm + 0.5
+	case "image":
+		if p.tile == nil {
+			return color.RGBA{}
+		}
+
+		bounds := p.tile.Bounds()
+		tx := positiveMod(int(math.Floor(px*p.tileDPMM)), bounds.Dx())
+		ty := positiveMod(int(math.Floor(-py*p.tileDPMM)), bounds.Dy())
+
+		return scaleColor(color.RGBAModel.Convert(p.tile.At(bounds.Min.X+tx, bounds.Min.Y+ty)).(color.RGBA), p.opacity)
+	default:
+		coverage = hatchCoverage(px, py, p.pattern.Angle, spacing, size, p.dpmm)
+	}
+
+	return scaleColor(p.color, math.Max(0, math.Min(1, coverage)))
+}
+
+// hatchCoverage returns how much of the pixel is covered by the parallel lines of a hatch.
+func hatchCoverage(x, y, angle, spacing, width, dpmm float64) float64 {
+	rad := angle * math.Pi / 180
+	distance := -x*math.Sin(rad) + y*math.Cos(rad)
+	distance = math.Abs(distance - spacing*math.Round(distance/spacing))
+
+	return math.Max(0, math.Min(1, (width/2-distance)*dpmm+0.5))
+}
+
+func positiveMod(a, b int) int {
+	return ((a % b) + b) % b
+}
+
+// scaleColor multiplies all of the channels of the premultiplied color, which changes its opacity.
+func scaleColor(c color.RGBA, opacity float64) color.RGBA {
+	if opacity >= 1 {
+		return c
+	}
+
+	return color.RGBA{
+		R: uint8(float64(c.R) * opacity),
+		G: uint8(float64(c.G) * opacity),
+		B: uint8(float64(c.B) * opacity),
+		A: uint8(float64(c.A) * opacity),
+	}
+}
+
+// loadPatternTile reads the image of an image pattern, which is cached for the rest of the
+// features. SVG files are rasterized at the resolution of the output.
+func (img *Image) loadPatternTile(filename string) (image.Image, float64, error) {
+	if len(filename) == 0 {
+		return nil, 0, errors.New("the image pattern has no image")
+	}
+
+	if img.Config != nil {
+		filename = img.Config.ResolvePath(filename)
+	}
+
+	if tile, ok := img.patternTiles[filename]; ok {
+		return tile.image, tile.dpmm, nil
+	}
+
+	f, err := os.Open(filename)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer f.Close()
+
+	var tile image.Image
+	dpmm := patternImageDPMM
+
+	if strings.ToLower(filepath.Ext(filename)) == ".svg" {
+		svg, err := canvas.ParseSVG(f)
+
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", filename, err)
+		}
+
+		dpmm = img.Resolution().DPMM()
+		tile = rasterizer.Draw(svg, img.Resolution(), canvas.DefaultColorSpace)
+	} else if tile, _, err = image.Decode(f); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	if tile.Bounds().Empty() {
+		return nil, 0, fmt.Errorf("%s: the image is empty", filename)
+	}
+
+	if img.patternTiles == nil {
+		img.patternTiles = make(map[string]patternTile)
+	}
+
+	img.patternTiles[filename] = patternTile{image: tile, dpmm: dpmm}
+
+	return tile, dpmm, nil
+}
+
+type patternTile struct {
+	image image.Image
+	dpmm  float64
+}
+
+// drawFillPattern fills the path, which is in map coordinates, with the pattern. The canvas can't
+// clip, so the pattern is rasterized inside of the path and drawn as an image, which works the same
+// way in all of the output formats.
+func (img *Image) drawFillPattern(path *canvas.Path, pattern *config.FillPattern, zIndex int, opacity float64) error {
+	resolution := img.Resolution()
+	dpmm := resolution.DPMM()
+	pagePath := path.Transform(img.context.View())
+	bounds := pagePath.FastBounds()
+
+	// Only the part of the area that's on the map needs to be drawn.
+	x0 := math.Floor(math.Max(bounds.X, img.Margin) * dpmm)
+	y0 := math.Floor(math.Max(bounds.Y, img.Margin) * dpmm)
+	x1 := math.Ceil(math.Min(bounds.X+bounds.W, img.Width-img.Margin) * dpmm)
+	y1 := math.Ceil(math.Min(bounds.Y+bounds.H, img.Height-img.Margin) * dpmm)
+	width, height := int(x1-x0), int(y1-y0)
+
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+
+	src := &patternImage{
+		pattern: pattern,
+		color:   scaleColor(color.RGBA{0, 0, 0, 255}, opacity),
+		dpmm:    dpmm,
+		x0:      int(x0),
+		y0:      int(y0),
+		height:  height,
+		opacity: opacity,
+	}
+
+	if len(pattern.Color) > 0 {
+		c, err := config.ParseColor(pattern.Color)
+
+		if err != nil {
+			return err
+		}
+
+		src.color = scaleColor(*c, opacity)
+	}
+
+	if strings.ToLower(pattern.Type) == "image" {
+		tile, tileDPMM, err := img.loadPatternTile(pattern.Image)
+
+		if err != nil {
+			return err
+		}
+
+		src.tile = tile
+		src.tileDPMM = tileDPMM
+	}
+
+	ras := vector.NewRasterizer(width, height)
+	pagePath.Translate(-x0/dpmm, -y0/dpmm).ToRasterizer(ras, resolution)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	ras.Draw(dst, dst.Bounds(), src, image.Point{})
+
+	img.context.Push()
+	img.context.ResetView()
+	img.context.SetZIndex(zIndex)
+	img.context.DrawImage(x0/dpmm, y0/dpmm, dst, resolution)
+	img.context.Pop()
+
+	return nil
+}
@@ -2,44 +2,90 @@ package gis
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"math"
 
 	"github.com/paulmach/osm"
 	"github.com/paulmach/osm/osmpbf"
 	"github.com/samber/lo"
-	"github.com/wroge/wgs84"
+	"github.com/wisepythagoras/gis-utils/config"
 )
 
 // https://wiki.openstreetmap.org/wiki/Relation:multipolygon
 
 type PBF struct {
-	nodeMap   map[osm.NodeID]*osm.Node
-	ways      []*RichWay
-	relations []*RichWay
-	bbox      *BBox
-	Verbose   bool
+	nodeMap      map[osm.NodeID]*osm.Node
+	wayMap       map[osm.WayID]*RichWay
+	ways         []*RichWay
+	relations    []*RichWay
+	rawRelations []*osm.Relation
+	bbox         *BBox
+	// The problems that were found while the ways and the relations were built.
+	issues  []QualityIssue
+	Verbose bool
+	// Logger is where the ways and relations that are built, and the summary of what was loaded, are
+	// logged. Without one, Verbose writes the debug records to stderr.
+	Logger *slog.Logger
+	log    *slog.Logger
+	// Progress is told how much of the file has been read and how many objects have been loaded,
+	// if it's set.
+	Progress Progress
 }
 
 func (pbf *PBF) Init() {
 	pbf.nodeMap = make(map[osm.NodeID]*osm.Node)
+	pbf.wayMap = make(map[osm.WayID]*RichWay)
 	pbf.ways = make([]*RichWay, 0)
 	pbf.relations = make([]*RichWay, 0)
+	pbf.rawRelations = make([]*osm.Relation, 0)
+	pbf.issues = make([]QualityIssue, 0)
 }
 
 func (pbf *PBF) Load(f io.Reader) error {
-	minLat := math.Inf(1)
-	minLon := math.Inf(1)
-	maxLat := math.Inf(-1)
-	maxLon := math.Inf(-1)
+	return pbf.LoadContext(context.Background(), f)
+}
+
+// LoadContext is Load, which stops with the error of the context when it's cancelled.
+func (pbf *PBF) LoadContext(ctx context.Context, f io.Reader) error {
+	progress := lockProgress(pbf.Progress)
+	return pbf.loadPBF(ctx, withProgress(f, progress, 0), progress)
+}
 
-	scanner := osmpbf.New(context.Background(), f, 8)
+func (pbf *PBF) loadPBF(ctx context.Context, f io.Reader, progress Progress) error {
+	scanner := osmpbf.New(ctx, f, 8)
 	scanner.FilterNode = func(n *osm.Node) bool { return true }
 
 	defer scanner.Close()
 
+	return pbf.scan(ctx, scanner, progress)
+}
+
+// LoadXML reads an OSM XML document (.osm) from the reader. Compressed files need to be wrapped
+// in the appropriate reader first, or opened through LoadFile.
+func (pbf *PBF) LoadXML(f io.Reader) error {
+	return pbf.LoadXMLContext(context.Background(), f)
+}
+
+// LoadXMLContext is LoadXML, which stops with the error of the context when it's cancelled.
+func (pbf *PBF) LoadXMLContext(ctx context.Context, f io.Reader) error {
+	progress := lockProgress(pbf.Progress)
+	return pbf.loadXML(ctx, withProgress(f, progress, 0), progress)
+}
+
+func (pbf *PBF) loadXML(ctx context.Context, f io.Reader, progress Progress) error {
+	scanner := newXMLScanner(ctx, f)
+
+	defer scanner.Close()
+
+	return pbf.scan(ctx, scanner, progress)
+}
+
+// scan consumes all of the objects of the scanner.
+func (pbf *PBF) scan(ctx context.Context, scanner osm.Scanner, progress Progress) error {
+	objects := 0
+
 	for scanner.Scan() {
 		o := scanner.Object()
 		t := o.ObjectID().Type()
@@ -48,184 +94,281 @@ func (pbf *PBF) Load(f io.Reader) error {
 			// Add all of the nodes to the node map so that it's easily referenced.
 			node := o.(*osm.Node)
 			pbf.nodeMap[node.ID] = node
+		} else if t == "way" {
+			pbf.addWay(o.(*osm.Way))
+		} else if t == "relation" {
+			pbf.addRelation(o.(*osm.Relation))
+		}
 
-			// Compute the bounding box from the nodes in the PBF file.
-			if node.Lat < minLat {
-				minLat = node.Lat
-			} else if node.Lat > maxLat {
-				maxLat = node.Lat
+		if objects++; objects%progressInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			} else if progress != nil {
+				progress.FeaturesProcessed("objects", objects, 0)
 			}
+		}
+	}
 
-			if node.Lon < minLon {
-				minLon = node.Lon
-			} else if node.Lon > maxLon {
-				maxLon = node.Lon
-			}
-		} else if t == "way" {
-			way := o.(*osm.Way)
-			nodeIDs := make([]osm.NodeID, 0)
-			points := make([]Point, 0)
+	if err := ctx.Err(); err != nil {
+		return err
+	} else if err := scanner.Err(); err != nil {
+		return err
+	}
 
-			if pbf.Verbose {
-				j, _ := json.Marshal(way)
-				fmt.Println(string(j))
-			}
+	if progress != nil {
+		progress.FeaturesProcessed("objects", objects, objects)
+	}
 
-			for _, wn := range way.Nodes {
-				nodeIDs = append(nodeIDs, wn.ID)
+	pbf.computeBBox()
+	pbf.logger().Info("loaded the OSM data",
+		"objects", objects,
+		"nodes", len(pbf.nodeMap),
+		"ways", len(pbf.ways),
+		"relations", len(pbf.rawRelations),
+		"multipolygons", len(pbf.relations),
+		"issues", len(pbf.issues),
+	)
 
-				if point := pbf.pointFromNodeID(wn.ID); point != nil {
-					points = append(points, *point)
-				}
-			}
+	return nil
+}
 
-			newWay := &RichWay{
-				Way:     way,
-				NodeIDs: nodeIDs,
-				Points:  [][]Point{points},
-			}
+// logger returns the logger that the loading is logged to.
+func (pbf *PBF) logger() *slog.Logger {
+	if pbf.log == nil {
+		pbf.log = config.LoggerOrDefault(pbf.Logger, pbf.Verbose)
+	}
 
-			pbf.ways = append(pbf.ways, newWay)
-		} else if t == "relation" {
-			// TODO: I only support polygon relations. Should other types be supported?
-			relation := o.(*osm.Relation)
-			nodeIDs := make([]osm.NodeID, 0)
-
-			if relation.Polygon() && relation.Visible {
-				if pbf.Verbose {
-					j, _ := json.Marshal(relation)
-					fmt.Println(string(j))
-				}
+	return pbf.log
+}
 
-				nodes := make([]osm.WayNode, 0)
-				rings := make([][]Point, 0)
-				outerRings := make([][]Point, 0)
-				outer := make([]Point, 0)
+// computeBBox computes the bounding box from all of the nodes that were loaded.
+func (pbf *PBF) computeBBox() {
+	minLat := math.Inf(1)
+	minLon := math.Inf(1)
+	maxLat := math.Inf(-1)
+	maxLon := math.Inf(-1)
 
-				sortedMembers, wayMap := pbf.sortRelationMembers(relation.Members)
+	for _, node := range pbf.nodeMap {
+		minLat = math.Min(minLat, node.Lat)
+		maxLat = math.Max(maxLat, node.Lat)
+		minLon = math.Min(minLon, node.Lon)
+		maxLon = math.Max(maxLon, node.Lon)
+	}
 
-				if pbf.Verbose {
-					fmt.Println(o.ObjectID().Ref(), o.ObjectID().Type(), o.ObjectID().String())
-					j, _ := json.Marshal(sortedMembers)
-					fmt.Println(" ->", len(sortedMembers), len(relation.Members), string(j))
-					j, _ = json.Marshal(relation.Members)
-					fmt.Println("   ", string(j))
-				}
+	pbf.bbox = &BBox{
+		SW: Point{Lat: minLat, Lon: minLon},
+		NE: Point{Lat: maxLat, Lon: maxLon},
+	}
+}
 
-				for _, member := range sortedMembers {
-					points := make([]Point, 0)
+func (pbf *PBF) addWay(way *osm.Way) {
+	newWay := pbf.buildWay(way)
+	pbf.wayMap[way.ID] = newWay
+	pbf.ways = append(pbf.ways, newWay)
+}
 
-					if way, found := wayMap[member.ElementID().WayID()]; found {
-						if pbf.Verbose {
-							j, _ := json.Marshal(way)
-							fmt.Println("  ->", string(j))
-						}
+func (pbf *PBF) addRelation(relation *osm.Relation) {
+	pbf.rawRelations = append(pbf.rawRelations, relation)
 
-						nodeIDs = append(nodeIDs, way.NodeIDs...)
+	if newWay := pbf.buildRelation(relation); newWay != nil {
+		pbf.relations = append(pbf.relations, newWay)
+	}
+}
 
-						for _, nodeID := range way.NodeIDs {
-							nodes, points = pbf.updateNodesAndPoints(nodeID, nodes, points)
-						}
-					}
+func (pbf *PBF) buildWay(way *osm.Way) *RichWay {
+	nodeIDs := make([]osm.NodeID, 0)
+	points := make([]Point, 0)
+	missingNodes := make([]osm.NodeID, 0)
 
-					if member.Role == "outer" {
-						outer = append(outer, points...)
-					} else {
-						rings = append(rings, points)
-					}
-				}
+	for _, wn := range way.Nodes {
+		nodeIDs = append(nodeIDs, wn.ID)
 
-				// Leaving this here for reference. It's the old and dumb way of placing relations as polygons.
-				// for _, member := range relation.Members {
-				// 	points := make([]Point, 0)
-
-				// 	if member.Type == "node" {
-				// 		nodeID := member.ElementID().NodeID()
-				// 		nodeIDs = append(nodeIDs, nodeID)
-				// 		nodes, points = pbf.updateNodesAndPoints(nodeID, nodes, points)
-
-				// 		if pbf.Verbose {
-				// 			fmt.Println("  ->", nodeID, member.Lat, member.Lon)
-				// 		}
-				// 	} else if member.Type == "way" {
-				// 		way, found := lo.Find(pbf.ways, func(way *RichWay) bool {
-				// 			return way.Way.ID == member.ElementID().WayID()
-				// 		})
-
-				// 		if found {
-				// 			if pbf.Verbose {
-				// 				j, _ := json.Marshal(way)
-				// 				fmt.Println("  ->", string(j))
-				// 			}
-
-				// 			nodeIDs = append(nodeIDs, way.NodeIDs...)
-
-				// 			for _, nodeID := range way.NodeIDs {
-				// 				nodes, points = pbf.updateNodesAndPoints(nodeID, nodes, points)
-				// 			}
-				// 		}
-				// 	}
-
-				// 	if member.Role == "outer" {
-				// 		outer = append(outer, points...)
-				// 	} else {
-				// 		rings = append(rings, points)
-				// 	}
-				// }
-
-				if len(outer) > 0 {
-					temp := make([]Point, 0)
-
-					for _, p := range outer {
-						temp = append(temp, p)
-
-						if len(temp) > 2 {
-							first := temp[0]
-							last := temp[len(temp)-1]
-
-							if first.Lat == last.Lat && first.Lon == last.Lon {
-								outerRings = append(outerRings, temp)
-								temp = make([]Point, 0)
-							}
-						}
-					}
-				}
+		if point := pbf.pointFromNodeID(wn.ID); point != nil {
+			points = append(points, *point)
+		} else {
+			missingNodes = append(missingNodes, wn.ID)
+		}
+	}
 
-				way := &osm.Way{
-					ID:      osm.WayID(relation.ID),
-					Visible: true,
-					Nodes:   nodes,
-					Tags:    relation.Tags,
-				}
+	if len(missingNodes) > 0 {
+		var location *Point
 
-				newWay := &RichWay{
-					Way:     way,
-					NodeIDs: nodeIDs,
-					Points:  append(outerRings, rings...),
-				}
+		if len(points) > 0 {
+			location = &points[0]
+		}
 
-				if pbf.Verbose {
-					j, _ := json.Marshal(newWay)
-					fmt.Println(" ->", string(j))
-				}
+		pbf.addIssue(QualityIssue{
+			Kind:     IssueMissingNodes,
+			Type:     osm.TypeWay,
+			ID:       int64(way.ID),
+			NodeIDs:  missingNodes,
+			Location: location,
+			Message:  fmt.Sprintf("%d of its %d nodes aren't in the data", len(missingNodes), len(way.Nodes)),
+		})
+		pbf.logger().Debug("way with missing nodes",
+			"way", way.ID,
+			"nodes", len(way.Nodes),
+			"missing_nodes", missingNodes,
+		)
+	} else {
+		pbf.logger().Debug("way", "way", way.ID, "nodes", len(way.Nodes))
+	}
+
+	return &RichWay{
+		Way:     way,
+		NodeIDs: nodeIDs,
+		Points:  [][]Point{points},
+	}
+}
+
+// buildRelation converts a multipolygon relation into a RichWay. Nil is returned for any other
+// kind of relation.
+func (pbf *PBF) buildRelation(relation *osm.Relation) *RichWay {
+	// TODO: I only support polygon relations. Should other types be supported?
+	if !relation.Polygon() || !relation.Visible {
+		return nil
+	}
+
+	nodeIDs := make([]osm.NodeID, 0)
+	nodes := make([]osm.WayNode, 0)
+	rings := make([][]Point, 0)
+	outerRings := make([][]Point, 0)
+	outer := make([]Point, 0)
 
-				pbf.relations = append(pbf.relations, newWay)
+	sortedMembers, wayMap := pbf.sortRelationMembers(relation.Members)
+	missingWays := make([]osm.WayID, 0)
+
+	// Boundaries have node members, like their labels, and both kinds can have relation members,
+	// which don't have a way id.
+	for _, member := range relation.Members {
+		if member.Type != osm.TypeWay {
+			continue
+		}
+
+		if _, found := pbf.wayMap[member.ElementID().WayID()]; !found {
+			missingWays = append(missingWays, member.ElementID().WayID())
+		}
+	}
+
+	for _, member := range sortedMembers {
+		if member.Type != osm.TypeWay {
+			continue
+		}
+
+		points := make([]Point, 0)
+
+		if way, found := wayMap[member.ElementID().WayID()]; found {
+			nodeIDs = append(nodeIDs, way.NodeIDs...)
+
+			for _, nodeID := range way.NodeIDs {
+				nodes, points = pbf.updateNodesAndPoints(nodeID, nodes, points)
 			}
 		}
+
+		if member.Role == "outer" {
+			outer = append(outer, points...)
+		} else {
+			rings = append(rings, points)
+		}
 	}
 
-	err := scanner.Err()
+	// Leaving this here for reference. It's the old and dumb way of placing relations as polygons.
+	// for _, member := range relation.Members {
+	// 	points := make([]Point, 0)
+
+	// 	if member.Type == "node" {
+	// 		nodeID := member.ElementID().NodeID()
+	// 		nodeIDs = append(nodeIDs, nodeID)
+	// 		nodes, points = pbf.updateNodesAndPoints(nodeID, nodes, points)
+
+	// 		if pbf.Verbose {
+	// 			fmt.Println("  ->", nodeID, member.Lat, member.Lon)
+	// 		}
+	// 	} else if member.Type == "way" {
+	// 		way, found := lo.Find(pbf.ways, func(way *RichWay) bool {
+	// 			return way.Way.ID == member.ElementID().WayID()
+	// 		})
+
+	// 		if found {
+	// 			if pbf.Verbose {
+	// 				j, _ := json.Marshal(way)
+	// 				fmt.Println("  ->", string(j))
+	// 			}
+
+	// 			nodeIDs = append(nodeIDs, way.NodeIDs...)
+
+	// 			for _, nodeID := range way.NodeIDs {
+	// 				nodes, points = pbf.updateNodesAndPoints(nodeID, nodes, points)
+	// 			}
+	// 		}
+	// 	}
+
+	// 	if member.Role == "outer" {
+	// 		outer = append(outer, points...)
+	// 	} else {
+	// 		rings = append(rings, points)
+	// 	}
+	// }
+
+	if len(outer) > 0 {
+		temp := make([]Point, 0)
+
+		for _, p := range outer {
+			temp = append(temp, p)
+
+			if len(temp) > 2 {
+				first := temp[0]
+				last := temp[len(temp)-1]
+
+				if first.Lat == last.Lat && first.Lon == last.Lon {
+					outerRings = append(outerRings, temp)
+					temp = make([]Point, 0)
+				}
+			}
+		}
+
+		// Whatever is left after the last ring that closed isn't drawn.
+		if len(temp) > 0 {
+			message := fmt.Sprintf("the outer ring doesn't close, so %d of its nodes are left out", len(temp))
 
-	if err != nil {
-		return err
+			if len(missingWays) > 0 {
+				message = fmt.Sprintf("%s (the member ways %v aren't in the data)", message, missingWays)
+			}
+
+			pbf.addIssue(QualityIssue{
+				Kind:     IssueUnclosedMultipolygon,
+				Type:     osm.TypeRelation,
+				ID:       int64(relation.ID),
+				Location: &temp[len(temp)-1],
+				Message:  message,
+			})
+		}
 	}
 
-	pbf.bbox = &BBox{
-		SW: Point{Lat: minLat, Lon: minLon},
-		NE: Point{Lat: maxLat, Lon: maxLon},
+	way := &osm.Way{
+		ID:      osm.WayID(relation.ID),
+		Visible: true,
+		Nodes:   nodes,
+		Tags:    relation.Tags,
 	}
 
-	return nil
+	newWay := &RichWay{
+		Way:     way,
+		NodeIDs: nodeIDs,
+		Points:  append(outerRings, rings...),
+	}
+
+	pbf.logger().Debug("relation",
+		"relation", relation.ID,
+		"members", len(relation.Members),
+		"sorted_members", len(sortedMembers),
+		"missing_ways", missingWays,
+		"outer_rings", len(outerRings),
+		"inner_rings", len(rings),
+		"nodes", len(nodeIDs),
+	)
+
+	return newWay
 }
 
 func (pbf *PBF) wayNodeFromNodeID(nodeID osm.NodeID) *osm.WayNode {
@@ -242,13 +385,9 @@ func (pbf *PBF) wayNodeFromNodeID(nodeID osm.NodeID) *osm.WayNode {
 
 func (pbf *PBF) pointFromNodeID(nodeID osm.NodeID) *Point {
 	if node, ok := pbf.nodeMap[nodeID]; ok {
-		x, y, _ := wgs84.LonLat().To(wgs84.WebMercator())(node.Lon, node.Lat, 0)
-
 		return &Point{
 			Lat: node.Lat,
 			Lon: node.Lon,
-			X:   x,
-			Y:   y,
 		}
 	}
 
@@ -284,11 +423,7 @@ func (pbf *PBF) findWay(wayMap map[osm.WayID]*RichWay, r osm.Member) (*RichWay,
 	found := false
 
 	if way, found = wayMap[r.ElementID().WayID()]; !found {
-		way, found = lo.Find(pbf.ways, func(way *RichWay) bool {
-			return way.Way.ID == r.ElementID().WayID()
-		})
-
-		if !found {
+		if way, found = pbf.wayMap[r.ElementID().WayID()]; !found {
 			return nil, wayMap
 		}
 
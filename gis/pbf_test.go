@@ -0,0 +1,49 @@
+package gis
+
+import (
+	"strings"
+	"testing"
+)
+
+// loadXML loads the OSM XML document for a test.
+func loadXML(t *testing.T, document string) *PBF {
+	t.Helper()
+
+	pbf := &PBF{}
+	pbf.Init()
+
+	if err := pbf.LoadXML(strings.NewReader(document)); err != nil {
+		t.Fatal(err)
+	}
+
+	return pbf
+}
+
+func TestLoadBoundaryWithNodeAndRelationMembers(t *testing.T) {
+	pbf := loadXML(t, `<osm version="0.6">
+		<node id="1" lat="0" lon="0"/>
+		<node id="2" lat="0" lon="1"/>
+		<node id="3" lat="1" lon="1"/>
+		<node id="4" lat="0.5" lon="0.5"/>
+		<way id="10"><nd ref="1"/><nd ref="2"/><nd ref="3"/><nd ref="1"/></way>
+		<relation id="20">
+			<member type="way" ref="10" role="outer"/>
+			<member type="node" ref="4" role="label"/>
+			<member type="relation" ref="21" role="subarea"/>
+			<tag k="type" v="boundary"/>
+			<tag k="boundary" v="administrative"/>
+		</relation>
+	</osm>`)
+
+	if len(pbf.Relations()) != 1 {
+		t.Fatalf("got %d relations, want 1", len(pbf.Relations()))
+	}
+
+	if rings := pbf.Relations()[0].Points; len(rings) != 1 || len(rings[0]) != 4 {
+		t.Errorf("got the rings %v, want the outer ring of way 10", rings)
+	}
+
+	if report := pbf.QualityReport(); len(report.Issues) != 0 {
+		t.Errorf("got the issues %v, want none", report.Issues)
+	}
+}
@@ -0,0 +1,355 @@
+package gis
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/paulmach/osm"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The maximum number of entities that are stored in a single primitive block. The spec recommends
+// 8000, which keeps the blocks well below the 16MB limit.
+const pbfBlockSize = 8000
+
+// https://wiki.openstreetmap.org/wiki/PBF_Format
+const (
+	pbfGranularity     = 100
+	pbfDateGranularity = 1000
+	pbfWritingProgram  = "gis-utils"
+)
+
+// WritePBF writes the nodes, ways and relations of the OSM data as an .osm.pbf file. The elements
+// are written in the standard order (nodes, ways, relations) and sorted by id. If the data has
+// bounds, they are stored as the bounding box in the header.
+func WritePBF(w io.Writer, data *osm.OSM) error {
+	if data == nil {
+		return errors.New("no OSM data found")
+	}
+
+	if err := writePBFBlob(w, "OSMHeader", encodePBFHeader(data.Bounds)); err != nil {
+		return err
+	}
+
+	nodes := append(osm.Nodes{}, data.Nodes...)
+	ways := append(osm.Ways{}, data.Ways...)
+	relations := append(osm.Relations{}, data.Relations...)
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	sort.Slice(ways, func(i, j int) bool { return ways[i].ID < ways[j].ID })
+	sort.Slice(relations, func(i, j int) bool { return relations[i].ID < relations[j].ID })
+
+	for i := 0; i < len(nodes); i += pbfBlockSize {
+		block := &pbfBlock{}
+		group := block.encodeDenseNodes(nodes[i:min(i+pbfBlockSize, len(nodes))])
+
+		if err := writePBFBlob(w, "OSMData", block.encode(group)); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < len(ways); i += pbfBlockSize {
+		block := &pbfBlock{}
+		group := []byte{}
+
+		for _, way := range ways[i:min(i+pbfBlockSize, len(ways))] {
+			group = protowire.AppendTag(group, 3, protowire.BytesType)
+			group = protowire.AppendBytes(group, block.encodeWay(way))
+		}
+
+		if err := writePBFBlob(w, "OSMData", block.encode(group)); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < len(relations); i += pbfBlockSize {
+		block := &pbfBlock{}
+		group := []byte{}
+
+		for _, relation := range relations[i:min(i+pbfBlockSize, len(relations))] {
+			group = protowire.AppendTag(group, 4, protowire.BytesType)
+			group = protowire.AppendBytes(group, block.encodeRelation(relation))
+		}
+
+		if err := writePBFBlob(w, "OSMData", block.encode(group)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writePBFBlob compresses the block and writes it, preceded by its blob header.
+func writePBFBlob(w io.Writer, blobType string, data []byte) error {
+	var compressed bytes.Buffer
+
+	zw := zlib.NewWriter(&compressed)
+
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	blob := protowire.AppendTag(nil, 2, protowire.VarintType)
+	blob = protowire.AppendVarint(blob, uint64(len(data)))
+	blob = protowire.AppendTag(blob, 3, protowire.BytesType)
+	blob = protowire.AppendBytes(blob, compressed.Bytes())
+
+	header := protowire.AppendTag(nil, 1, protowire.BytesType)
+	header = protowire.AppendString(header, blobType)
+	header = protowire.AppendTag(header, 3, protowire.VarintType)
+	header = protowire.AppendVarint(header, uint64(len(blob)))
+
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(header)))
+
+	for _, b := range [][]byte{size, header, blob} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodePBFHeader(bounds *osm.Bounds) []byte {
+	header := []byte{}
+
+	if bounds != nil {
+		bbox := []byte{}
+
+		for i, coord := range []float64{bounds.MinLon, bounds.MaxLon, bounds.MaxLat, bounds.MinLat} {
+			bbox = protowire.AppendTag(bbox, protowire.Number(i+1), protowire.VarintType)
+			bbox = protowire.AppendVarint(bbox, protowire.EncodeZigZag(int64(math.Round(coord*1e9))))
+		}
+
+		header = protowire.AppendTag(header, 1, protowire.BytesType)
+		header = protowire.AppendBytes(header, bbox)
+	}
+
+	for _, feature := range []string{"OsmSchema-V0.6", "DenseNodes"} {
+		header = protowire.AppendTag(header, 4, protowire.BytesType)
+		header = protowire.AppendString(header, feature)
+	}
+
+	header = protowire.AppendTag(header, 16, protowire.BytesType)
+	header = protowire.AppendString(header, pbfWritingProgram)
+
+	return header
+}
+
+// pbfBlock keeps the string table of a primitive block while its elements are being encoded.
+type pbfBlock struct {
+	strings []string
+	index   map[string]uint64
+}
+
+func (b *pbfBlock) stringID(s string) uint64 {
+	if b.index == nil {
+		// The first entry of the string table is always empty, since 0 is used as a delimiter in
+		// the keys and values of dense nodes.
+		b.strings = []string{""}
+		b.index = map[string]uint64{"": 0}
+	}
+
+	if id, ok := b.index[s]; ok {
+		return id
+	}
+
+	id := uint64(len(b.strings))
+	b.strings = append(b.strings, s)
+	b.index[s] = id
+
+	return id
+}
+
+// encode wraps the encoded primitive group into a primitive block, along with the string table.
+func (b *pbfBlock) encode(group []byte) []byte {
+	b.stringID("")
+
+	table := []byte{}
+
+	for _, s := range b.strings {
+		table = protowire.AppendTag(table, 1, protowire.BytesType)
+		table = protowire.AppendString(table, s)
+	}
+
+	block := protowire.AppendTag(nil, 1, protowire.BytesType)
+	block = protowire.AppendBytes(block, table)
+	block = protowire.AppendTag(block, 2, protowire.BytesType)
+	block = protowire.AppendBytes(block, group)
+	block = protowire.AppendTag(block, 17, protowire.VarintType)
+	block = protowire.AppendVarint(block, pbfGranularity)
+	block = protowire.AppendTag(block, 18, protowire.VarintType)
+	block = protowire.AppendVarint(block, pbfDateGranularity)
+
+	return block
+}
+
+func (b *pbfBlock) encodeDenseNodes(nodes osm.Nodes) []byte {
+	var ids, lats, lons, keysVals []uint64
+	var versions, timestamps, changesets, uids, users []uint64
+	var lastID, lastLat, lastLon, lastTimestamp, lastChangeset, lastUID, lastUser int64
+
+	for _, node := range nodes {
+		lat := int64(math.Round(node.Lat * 1e9 / pbfGranularity))
+		lon := int64(math.Round(node.Lon * 1e9 / pbfGranularity))
+		timestamp := pbfTimestamp(node.Timestamp)
+		user := int64(b.stringID(node.User))
+
+		ids = append(ids, protowire.EncodeZigZag(int64(node.ID)-lastID))
+		lats = append(lats, protowire.EncodeZigZag(lat-lastLat))
+		lons = append(lons, protowire.EncodeZigZag(lon-lastLon))
+		versions = append(versions, uint64(node.Version))
+		timestamps = append(timestamps, protowire.EncodeZigZag(timestamp-lastTimestamp))
+		changesets = append(changesets, protowire.EncodeZigZag(int64(node.ChangesetID)-lastChangeset))
+		uids = append(uids, protowire.EncodeZigZag(int64(node.UserID)-lastUID))
+		users = append(users, protowire.EncodeZigZag(user-lastUser))
+
+		lastID, lastLat, lastLon = int64(node.ID), lat, lon
+		lastTimestamp, lastChangeset = timestamp, int64(node.ChangesetID)
+		lastUID, lastUser = int64(node.UserID), user
+
+		for _, tag := range node.Tags {
+			keysVals = append(keysVals, b.stringID(tag.Key), b.stringID(tag.Value))
+		}
+
+		keysVals = append(keysVals, 0)
+	}
+
+	info := appendPacked(nil, 1, versions)
+	info = appendPacked(info, 2, timestamps)
+	info = appendPacked(info, 3, changesets)
+	info = appendPacked(info, 4, uids)
+	info = appendPacked(info, 5, users)
+
+	dense := appendPacked(nil, 1, ids)
+	dense = protowire.AppendTag(dense, 5, protowire.BytesType)
+	dense = protowire.AppendBytes(dense, info)
+	dense = appendPacked(dense, 8, lats)
+	dense = appendPacked(dense, 9, lons)
+	dense = appendPacked(dense, 10, keysVals)
+
+	group := protowire.AppendTag(nil, 2, protowire.BytesType)
+
+	return protowire.AppendBytes(group, dense)
+}
+
+func (b *pbfBlock) encodeWay(way *osm.Way) []byte {
+	refs := make([]uint64, 0, len(way.Nodes))
+	lastRef := int64(0)
+
+	for _, wn := range way.Nodes {
+		refs = append(refs, protowire.EncodeZigZag(int64(wn.ID)-lastRef))
+		lastRef = int64(wn.ID)
+	}
+
+	data := protowire.AppendTag(nil, 1, protowire.VarintType)
+	data = protowire.AppendVarint(data, uint64(way.ID))
+	data = b.appendTags(data, way.Tags)
+	data = protowire.AppendTag(data, 4, protowire.BytesType)
+	data = protowire.AppendBytes(data, b.encodeInfo(way.Version, way.Timestamp, way.ChangesetID, way.UserID, way.User))
+	data = appendPacked(data, 8, refs)
+
+	return data
+}
+
+func (b *pbfBlock) encodeRelation(relation *osm.Relation) []byte {
+	roles := make([]uint64, 0, len(relation.Members))
+	memIDs := make([]uint64, 0, len(relation.Members))
+	types := make([]uint64, 0, len(relation.Members))
+	lastRef := int64(0)
+
+	for _, member := range relation.Members {
+		memberType := uint64(0)
+
+		if member.Type == osm.TypeWay {
+			memberType = 1
+		} else if member.Type == osm.TypeRelation {
+			memberType = 2
+		}
+
+		roles = append(roles, b.stringID(member.Role))
+		memIDs = append(memIDs, protowire.EncodeZigZag(member.Ref-lastRef))
+		types = append(types, memberType)
+		lastRef = member.Ref
+	}
+
+	info := b.encodeInfo(relation.Version, relation.Timestamp, relation.ChangesetID, relation.UserID, relation.User)
+
+	data := protowire.AppendTag(nil, 1, protowire.VarintType)
+	data = protowire.AppendVarint(data, uint64(relation.ID))
+	data = b.appendTags(data, relation.Tags)
+	data = protowire.AppendTag(data, 4, protowire.BytesType)
+	data = protowire.AppendBytes(data, info)
+	data = appendPacked(data, 8, roles)
+	data = appendPacked(data, 9, memIDs)
+	data = appendPacked(data, 10, types)
+
+	return data
+}
+
+func (b *pbfBlock) encodeInfo(version int, timestamp time.Time, changeset osm.ChangesetID, uid osm.UserID, user string) []byte {
+	info := protowire.AppendTag(nil, 1, protowire.VarintType)
+	info = protowire.AppendVarint(info, uint64(version))
+	info = protowire.AppendTag(info, 2, protowire.VarintType)
+	info = protowire.AppendVarint(info, uint64(pbfTimestamp(timestamp)))
+	info = protowire.AppendTag(info, 3, protowire.VarintType)
+	info = protowire.AppendVarint(info, uint64(changeset))
+	info = protowire.AppendTag(info, 4, protowire.VarintType)
+	info = protowire.AppendVarint(info, uint64(uid))
+	info = protowire.AppendTag(info, 5, protowire.VarintType)
+	info = protowire.AppendVarint(info, b.stringID(user))
+
+	return info
+}
+
+func (b *pbfBlock) appendTags(data []byte, tags osm.Tags) []byte {
+	keys := make([]uint64, 0, len(tags))
+	vals := make([]uint64, 0, len(tags))
+
+	for _, tag := range tags {
+		keys = append(keys, b.stringID(tag.Key))
+		vals = append(vals, b.stringID(tag.Value))
+	}
+
+	data = appendPacked(data, 2, keys)
+
+	return appendPacked(data, 3, vals)
+}
+
+// appendPacked appends a packed repeated field of varints. Empty fields are omitted.
+func appendPacked(data []byte, num protowire.Number, values []uint64) []byte {
+	if len(values) == 0 {
+		return data
+	}
+
+	packed := []byte{}
+
+	for _, v := range values {
+		packed = protowire.AppendVarint(packed, v)
+	}
+
+	data = protowire.AppendTag(data, num, protowire.BytesType)
+
+	return protowire.AppendBytes(data, packed)
+}
+
+// pbfTimestamp converts the time to the date granularity of the blocks. Missing timestamps are
+// stored as 0.
+func pbfTimestamp(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixMilli() / pbfDateGranularity
+}
@@ -0,0 +1,124 @@
+package gis
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+)
+
+func TestWritePBFRoundTrip(t *testing.T) {
+	pbf := loadXML(t, `<osm version="0.6">
+		<node id="1" lat="0.5" lon="0.5"><tag k="amenity" v="cafe"/><tag k="name" v="Café"/></node>
+		<node id="2" lat="0.5" lon="2"/>
+		<node id="3" lat="5" lon="5"/>
+		<node id="4" lat="6" lon="5"/>
+		<node id="5" lat="7" lon="7"/>
+		<way id="10"><nd ref="1"/><nd ref="2"/><tag k="highway" v="residential"/></way>
+		<way id="11"><nd ref="3"/><nd ref="4"/><tag k="highway" v="path"/></way>
+		<relation id="20">
+			<member type="way" ref="10" role="from"/>
+			<member type="way" ref="11" role="to"/>
+			<member type="node" ref="5" role="via"/>
+			<tag k="type" v="route"/>
+		</relation>
+	</osm>`)
+
+	data := pbf.Extract(box(0, 0, 1, 1), true)
+	buf := &bytes.Buffer{}
+
+	if err := WritePBF(buf, data); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := osmpbf.New(context.Background(), bytes.NewReader(buf.Bytes()), 1)
+	header, err := scanner.Header()
+	scanner.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantBounds := &osm.Bounds{MinLat: 0, MaxLat: 1, MinLon: 0, MaxLon: 1}
+
+	if b := header.Bounds; b == nil || !approxEqual(b.MinLat, 0) || !approxEqual(b.MaxLat, 1) ||
+		!approxEqual(b.MinLon, 0) || !approxEqual(b.MaxLon, 1) {
+		t.Errorf("got the header bounds %v, want %v", header.Bounds, wantBounds)
+	}
+
+	read := &PBF{}
+	read.Init()
+
+	if err := read.Load(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	// Node 2 is outside of the area, but way 10 is kept in full, and the relation brings in the
+	// rest of its members.
+	for id, want := range pbf.nodeMap {
+		got, ok := read.nodeMap[id]
+
+		if !ok {
+			t.Errorf("node %d is missing", id)
+			continue
+		}
+
+		if !approxEqual(got.Lat, want.Lat) || !approxEqual(got.Lon, want.Lon) {
+			t.Errorf("node %d: got %v,%v, want %v,%v", id, got.Lat, got.Lon, want.Lat, want.Lon)
+		}
+
+		if got.Tags.Find("name") != want.Tags.Find("name") || len(got.Tags) != len(want.Tags) {
+			t.Errorf("node %d: got the tags %v, want %v", id, got.Tags, want.Tags)
+		}
+	}
+
+	for _, id := range []osm.WayID{10, 11} {
+		way, ok := read.wayMap[id]
+
+		if !ok {
+			t.Errorf("way %d is missing", id)
+		} else if len(way.Way.Nodes) != 2 || way.Way.Tags.Find("highway") == "" {
+			t.Errorf("way %d: got the nodes %v and the tags %v", id, way.Way.Nodes, way.Way.Tags)
+		}
+	}
+
+	if len(read.rawRelations) != 1 {
+		t.Fatalf("got %d relations, want 1", len(read.rawRelations))
+	}
+
+	relation := read.rawRelations[0]
+
+	if relation.Tags.Find("type") != "route" || len(relation.Members) != 3 {
+		t.Errorf("got the relation %d with the tags %v and the members %v", relation.ID, relation.Tags, relation.Members)
+	}
+
+	for _, member := range relation.Members {
+		if member.Type == osm.TypeWay && read.wayMap[osm.WayID(member.Ref)] == nil ||
+			member.Type == osm.TypeNode && read.nodeMap[osm.NodeID(member.Ref)] == nil {
+			t.Errorf("the member %s %d of the relation is missing", member.Type, member.Ref)
+		}
+	}
+}
+
+func TestExtractWithoutCompleteRelations(t *testing.T) {
+	pbf := loadXML(t, `<osm version="0.6">
+		<node id="1" lat="0.5" lon="0.5"/>
+		<node id="2" lat="5" lon="5"/>
+		<relation id="20">
+			<member type="node" ref="1" role=""/>
+			<member type="node" ref="2" role=""/>
+		</relation>
+	</osm>`)
+
+	data := pbf.Extract(box(0, 0, 1, 1), false)
+
+	if len(data.Nodes) != 1 || data.Nodes[0].ID != 1 {
+		t.Errorf("got the nodes %v, want only node 1", data.Nodes)
+	}
+
+	if len(data.Relations) != 1 {
+		t.Errorf("got %d relations, want 1", len(data.Relations))
+	}
+}
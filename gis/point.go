@@ -2,9 +2,8 @@ package gis
 
 type RawPoint []float64
 
+// Point is a location in WGS84. It's projected when it's drawn, in the projection of the image.
 type Point struct {
-	Lat float64
-	Lon float64
-	X   float64
-	Y   float64
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
 }
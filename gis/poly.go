@@ -0,0 +1,137 @@
+package gis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ParsePoly reads an Osmosis polygon filter file (.poly), like the ones Geofabrik publishes with
+// its extracts. Sections whose name starts with "!" are holes, and each of them belongs to the
+// outer ring that contains it.
+// See: https://wiki.openstreetmap.org/wiki/Osmosis/Polygon_Filter_File_Format
+func ParsePoly(r io.Reader) (*Polygon, error) {
+	scanner := bufio.NewScanner(r)
+	poly := &Polygon{}
+	holes := make([][]Point, 0)
+	lineNum := 0
+
+	nextLine := func() (string, bool) {
+		for scanner.Scan() {
+			lineNum++
+			line := strings.TrimSpace(scanner.Text())
+
+			if len(line) > 0 {
+				return line, true
+			}
+		}
+
+		return "", false
+	}
+
+	name, ok := nextLine()
+
+	if !ok {
+		return nil, errors.New("empty polygon file")
+	}
+
+	poly.Name = name
+
+	for {
+		section, ok := nextLine()
+
+		if !ok {
+			return nil, errors.New("unexpected end of polygon file")
+		}
+
+		if section == "END" {
+			break
+		}
+
+		ring := make([]Point, 0)
+
+		for {
+			line, ok := nextLine()
+
+			if !ok {
+				return nil, fmt.Errorf("unexpected end of section %q", section)
+			}
+
+			if line == "END" {
+				break
+			}
+
+			fields := strings.Fields(line)
+
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("invalid coordinates on line %d", lineNum)
+			}
+
+			lon, err := strconv.ParseFloat(fields[0], 64)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid longitude on line %d: %w", lineNum, err)
+			}
+
+			lat, err := strconv.ParseFloat(fields[1], 64)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid latitude on line %d: %w", lineNum, err)
+			}
+
+			ring = append(ring, Point{Lat: lat, Lon: lon})
+		}
+
+		if strings.HasPrefix(section, "!") {
+			holes = append(holes, ring)
+		} else {
+			poly.Parts = append(poly.Parts, PolygonPart{Outer: ring})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(poly.Parts) == 0 {
+		return nil, errors.New("no outer ring found in the polygon file")
+	}
+
+	// The holes can come before the rings that they're in, so they're only placed at the end. The
+	// smallest outer ring that contains a hole is the one that it's cut out of.
+	for _, hole := range holes {
+		var owner *PolygonPart
+
+		for i := range poly.Parts {
+			part := &poly.Parts[i]
+
+			if len(hole) > 0 && ringContainsPoint(part.Outer, hole[0]) &&
+				(owner == nil || ringArea(part.Outer) < ringArea(owner.Outer)) {
+				owner = part
+			}
+		}
+
+		if owner != nil {
+			owner.Inner = append(owner.Inner, hole)
+		}
+	}
+
+	return poly, nil
+}
+
+// ReadPolyFile reads a polygon from an Osmosis .poly file.
+func ReadPolyFile(filename string) (*Polygon, error) {
+	f, err := os.Open(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return ParsePoly(f)
+}
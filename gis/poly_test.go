@@ -0,0 +1,95 @@
+package gis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePoly(t *testing.T) {
+	poly, err := ParsePoly(strings.NewReader(`islands
+!lake
+   3.0   3.0
+   7.0   3.0
+   7.0   7.0
+   3.0   7.0
+END
+main
+   0.0   0.0
+  10.0   0.0
+  10.0  10.0
+   0.0  10.0
+END
+
+second
+  20.0  20.0
+  21.0  20.0
+  21.0  21.0
+END
+!pond
+  20.2  20.1
+  20.4  20.1
+  20.4  20.3
+END
+END
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if poly.Name != "islands" {
+		t.Errorf("got the name %q, want %q", poly.Name, "islands")
+	}
+
+	if len(poly.Parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(poly.Parts))
+	}
+
+	// Each hole belongs to the ring that it's in, whether it comes before or after it.
+	for i, want := range []int{1, 1} {
+		if got := len(poly.Parts[i].Inner); got != want {
+			t.Errorf("part %d: got %d holes, want %d", i, got, want)
+		}
+	}
+
+	if len(poly.Parts[0].Outer) != 4 || poly.Parts[0].Outer[1] != (Point{Lat: 0, Lon: 10}) {
+		t.Errorf("got the outer ring %v", poly.Parts[0].Outer)
+	}
+
+	tests := []struct {
+		point Point
+		want  bool
+	}{
+		{Point{Lat: 1, Lon: 1}, true},
+		{Point{Lat: 5, Lon: 5}, false},
+		{Point{Lat: 20.8, Lon: 20.9}, true},
+		{Point{Lat: 20.15, Lon: 20.35}, false},
+		{Point{Lat: 15, Lon: 15}, false},
+	}
+
+	for _, test := range tests {
+		if got := poly.ContainsPoint(test.point); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.point, got, test.want)
+		}
+	}
+}
+
+func TestParsePolyErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+	}{
+		{"empty", ""},
+		{"no END", "area\n1\n0 0\n1 0\n1 1\nEND\n"},
+		{"unfinished section", "area\n1\n0 0\n1 0\n"},
+		{"only holes", "area\n!1\n0 0\n1 0\n1 1\nEND\nEND\n"},
+		{"bad coordinates", "area\n1\n0 zero\nEND\nEND\n"},
+		{"one coordinate", "area\n1\n0\nEND\nEND\n"},
+	}
+
+	for _, test := range tests {
+		if _, err := ParsePoly(strings.NewReader(test.document)); err == nil {
+			t.Errorf("%s: got no error", test.name)
+		}
+	}
+}
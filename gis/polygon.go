@@ -0,0 +1,250 @@
+package gis
+
+import (
+	"errors"
+	"math"
+	"os"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Polygon is an area made up of one or more parts, each of which may have holes. A point is
+// inside the polygon when it's inside the outer ring of any of the parts and outside the holes of
+// that part, so an island inside the hole of another part is still inside the polygon.
+type Polygon struct {
+	Name  string
+	Parts []PolygonPart
+}
+
+// PolygonPart is an outer ring of a polygon along with its holes.
+type PolygonPart struct {
+	Outer []Point
+	Inner [][]Point
+}
+
+// ContainsPoint returns whether the point falls inside the polygon.
+func (poly *Polygon) ContainsPoint(p Point) bool {
+	for _, part := range poly.Parts {
+		if part.containsPoint(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IntersectsBBox returns whether the polygon overlaps the bounding box. That's the case when a
+// corner of the box is inside the polygon, a vertex of the polygon is inside the box, or an edge of
+// the polygon crosses an edge of the box.
+func (poly *Polygon) IntersectsBBox(b *BBox) bool {
+	corners := b.corners()
+
+	for _, corner := range corners {
+		if poly.ContainsPoint(corner) {
+			return true
+		}
+	}
+
+	for _, ring := range poly.rings() {
+		for i, p := range ring {
+			if b.ContainsPoint(p) {
+				return true
+			}
+
+			next := ring[(i+1)%len(ring)]
+
+			for j, corner := range corners {
+				if segmentsIntersect(p, next, corner, corners[(j+1)%len(corners)]) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// IntersectsSegment returns whether the segment from a to b crosses an edge of any of the rings of
+// the polygon.
+func (poly *Polygon) IntersectsSegment(a, b Point) bool {
+	for _, ring := range poly.rings() {
+		if ringIntersectsSegment(ring, a, b) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Bounds returns the bounding box of the outer rings of the polygon.
+func (poly *Polygon) Bounds() *BBox {
+	bbox := &BBox{
+		SW: Point{Lat: math.Inf(1), Lon: math.Inf(1)},
+		NE: Point{Lat: math.Inf(-1), Lon: math.Inf(-1)},
+	}
+
+	for _, part := range poly.Parts {
+		for _, p := range part.Outer {
+			bbox.SW.Lat = math.Min(bbox.SW.Lat, p.Lat)
+			bbox.SW.Lon = math.Min(bbox.SW.Lon, p.Lon)
+			bbox.NE.Lat = math.Max(bbox.NE.Lat, p.Lat)
+			bbox.NE.Lon = math.Max(bbox.NE.Lon, p.Lon)
+		}
+	}
+
+	return bbox
+}
+
+// rings returns the outer rings and the holes of all of the parts.
+func (poly *Polygon) rings() [][]Point {
+	rings := make([][]Point, 0, len(poly.Parts))
+
+	for _, part := range poly.Parts {
+		rings = append(rings, part.Outer)
+		rings = append(rings, part.Inner...)
+	}
+
+	return rings
+}
+
+// containsPoint returns whether the point is inside the outer ring of the part and outside its holes.
+func (part *PolygonPart) containsPoint(p Point) bool {
+	if !ringContainsPoint(part.Outer, p) {
+		return false
+	}
+
+	for _, ring := range part.Inner {
+		if ringContainsPoint(ring, p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ringContainsPoint uses the even-odd (ray casting) rule to find whether the point is inside the
+// ring. The ring doesn't need to be explicitly closed.
+func ringContainsPoint(ring []Point, p Point) bool {
+	inside := false
+
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a := ring[i]
+		b := ring[j]
+
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lon < (b.Lon-a.Lon)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// ringIntersectsSegment returns whether the segment from a to b crosses an edge of the ring. The ring
+// doesn't need to be explicitly closed.
+func ringIntersectsSegment(ring []Point, a, b Point) bool {
+	for i, p := range ring {
+		if segmentsIntersect(p, ring[(i+1)%len(ring)], a, b) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ringArea returns the area of the ring in square degrees, with the shoelace formula.
+func ringArea(ring []Point) float64 {
+	area := 0.0
+
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		area += ring[j].Lon*ring[i].Lat - ring[i].Lon*ring[j].Lat
+	}
+
+	return math.Abs(area) / 2
+}
+
+// orientation returns whether r is to the left of the line from p to q (positive), to the right of
+// it (negative) or on it (0).
+func orientation(p, q, r Point) float64 {
+	return (q.Lon-p.Lon)*(r.Lat-p.Lat) - (q.Lat-p.Lat)*(r.Lon-p.Lon)
+}
+
+// segmentsIntersect returns whether the segments ab and cd cross each other.
+func segmentsIntersect(a, b, c, d Point) bool {
+	d1 := orientation(c, d, a)
+	d2 := orientation(c, d, b)
+	d3 := orientation(a, b, c)
+	d4 := orientation(a, b, d)
+
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+// ParseGeoJSONPolygon reads a polygon from a GeoJSON document. The document can be a bare
+// geometry, a feature or a feature collection, and all of the Polygon and MultiPolygon geometries
+// in it are combined into a single polygon.
+func ParseGeoJSONPolygon(data []byte) (*Polygon, error) {
+	geometries := make([]orb.Geometry, 0)
+
+	if fc, err := geojson.UnmarshalFeatureCollection(data); err == nil && len(fc.Features) > 0 {
+		for _, f := range fc.Features {
+			geometries = append(geometries, f.Geometry)
+		}
+	} else if f, err := geojson.UnmarshalFeature(data); err == nil && f.Geometry != nil {
+		geometries = append(geometries, f.Geometry)
+	} else if g, err := geojson.UnmarshalGeometry(data); err == nil && g.Geometry() != nil {
+		geometries = append(geometries, g.Geometry())
+	}
+
+	poly := &Polygon{}
+
+	for _, geometry := range geometries {
+		switch g := geometry.(type) {
+		case orb.Polygon:
+			poly.addOrbPolygon(g)
+		case orb.MultiPolygon:
+			for _, p := range g {
+				poly.addOrbPolygon(p)
+			}
+		}
+	}
+
+	if len(poly.Parts) == 0 {
+		return nil, errors.New("no polygon found in the GeoJSON")
+	}
+
+	return poly, nil
+}
+
+// ReadGeoJSONPolygonFile reads a polygon from a GeoJSON file.
+func ReadGeoJSONPolygonFile(filename string) (*Polygon, error) {
+	data, err := os.ReadFile(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseGeoJSONPolygon(data)
+}
+
+func (poly *Polygon) addOrbPolygon(p orb.Polygon) {
+	part := PolygonPart{}
+
+	for i, r := range p {
+		ring := make([]Point, 0, len(r))
+
+		for _, point := range r {
+			ring = append(ring, Point{Lat: point.Lat(), Lon: point.Lon()})
+		}
+
+		if i == 0 {
+			part.Outer = ring
+		} else {
+			part.Inner = append(part.Inner, ring)
+		}
+	}
+
+	if len(part.Outer) > 0 {
+		poly.Parts = append(poly.Parts, part)
+	}
+}
@@ -0,0 +1,69 @@
+package gis
+
+import "testing"
+
+func TestPolygonContainsPoint(t *testing.T) {
+	// A square with a hole in the middle, and an island inside of the hole.
+	poly, err := ParseGeoJSONPolygon([]byte(`{
+		"type": "MultiPolygon",
+		"coordinates": [
+			[
+				[[0, 0], [10, 0], [10, 10], [0, 10], [0, 0]],
+				[[3, 3], [7, 3], [7, 7], [3, 7], [3, 3]]
+			],
+			[
+				[[4, 4], [6, 4], [6, 6], [4, 6], [4, 4]]
+			]
+		]
+	}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		point Point
+		want  bool
+	}{
+		{"inside the outer ring", Point{Lat: 1, Lon: 1}, true},
+		{"inside the hole", Point{Lat: 3.5, Lon: 3.5}, false},
+		{"on the island in the hole", Point{Lat: 5, Lon: 5}, true},
+		{"outside", Point{Lat: 11, Lon: 5}, false},
+	}
+
+	for _, test := range tests {
+		if got := poly.ContainsPoint(test.point); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	if got := poly.Bounds(); !bboxEqual(got, box(0, 0, 10, 10)) {
+		t.Errorf("got the bounds %v, want %v", got, box(0, 0, 10, 10))
+	}
+}
+
+func TestPolygonIntersectsBBox(t *testing.T) {
+	poly := &Polygon{Parts: []PolygonPart{{
+		Outer: []Point{{Lat: 0, Lon: 0}, {Lat: 0, Lon: 10}, {Lat: 10, Lon: 10}, {Lat: 10, Lon: 0}},
+		Inner: [][]Point{{{Lat: 2, Lon: 2}, {Lat: 2, Lon: 8}, {Lat: 8, Lon: 8}, {Lat: 8, Lon: 2}}},
+	}}}
+
+	tests := []struct {
+		name string
+		bbox *BBox
+		want bool
+	}{
+		{"inside", box(0.5, 0.5, 1, 1), true},
+		{"around the polygon", box(-1, -1, 11, 11), true},
+		{"crossing an edge", box(-1, 4, 1, 5), true},
+		{"inside the hole", box(4, 4, 5, 5), false},
+		{"outside", box(20, 20, 21, 21), false},
+	}
+
+	for _, test := range tests {
+		if got := poly.IntersectsBBox(test.bbox); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package gis
+
+import (
+	"io"
+	"sync"
+)
+
+// How often, in objects, loading reports its progress and checks whether it was cancelled.
+const progressInterval = 10000
+
+// Progress is told how far long operations, like loading, clipping and drawing, have got. Its
+// methods can be called from other goroutines, but never at the same time.
+type Progress interface {
+	// BytesRead is called as a file is read. The total is the size of the file, or 0 if it isn't
+	// known, and compressed files count the compressed bytes.
+	BytesRead(read, total int64)
+	// FeaturesProcessed is called as the features of a stage, e.g. "land" or "ways", are processed.
+	// The total is 0 if it isn't known.
+	FeaturesProcessed(stage string, done, total int)
+}
+
+// ProgressFuncs is a Progress that calls whichever of its functions are set.
+type ProgressFuncs struct {
+	Bytes    func(read, total int64)
+	Features func(stage string, done, total int)
+}
+
+func (p ProgressFuncs) BytesRead(read, total int64) {
+	if p.Bytes != nil {
+		p.Bytes(read, total)
+	}
+}
+
+func (p ProgressFuncs) FeaturesProcessed(stage string, done, total int) {
+	if p.Features != nil {
+		p.Features(stage, done, total)
+	}
+}
+
+// lockedProgress serialises the calls to a progress that's used from several goroutines, like when
+// the PBF decoder reads the file on one while the objects are scanned on another.
+type lockedProgress struct {
+	progress Progress
+	mutex    sync.Mutex
+}
+
+func (p *lockedProgress) BytesRead(read, total int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.progress.BytesRead(read, total)
+}
+
+func (p *lockedProgress) FeaturesProcessed(stage string, done, total int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.progress.FeaturesProcessed(stage, done, total)
+}
+
+// lockProgress returns the progress with its calls serialised, or nil if there's no progress.
+func lockProgress(progress Progress) Progress {
+	if progress == nil {
+		return nil
+	}
+
+	return &lockedProgress{progress: progress}
+}
+
+// progressReader reports the bytes that are read through it.
+type progressReader struct {
+	io.Reader
+	progress Progress
+	read     int64
+	total    int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += int64(n)
+	r.progress.BytesRead(r.read, r.total)
+
+	return n, err
+}
+
+// withProgress returns a reader that reports what's read from it, if there's a progress.
+func withProgress(r io.Reader, progress Progress, total int64) io.Reader {
+	if progress == nil {
+		return r
+	}
+
+	return &progressReader{Reader: r, progress: progress, total: total}
+}
@@ -0,0 +1,155 @@
+package gis
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/wroge/wgs84"
+)
+
+// The EPSG code of Web Mercator, which maps are drawn in by default.
+const WebMercatorCode = 3857
+
+// The number of points along each edge of a bounding box that are projected to find its extent,
+// since the edges can be curved in the projection.
+const extentSamples = 16
+
+// Projection converts points between WGS84 and a projected coordinate reference system, which is
+// the one that maps are drawn in.
+type Projection struct {
+	Code     int
+	toXY     wgs84.Func
+	toLonLat wgs84.Func
+}
+
+// NewProjection returns the projection of the EPSG code, as long as the wgs84 package supports it.
+func NewProjection(code int) (*Projection, error) {
+	crs := wgs84.EPSG().Code(code)
+
+	if crs == nil {
+		return nil, fmt.Errorf("unsupported EPSG code: %d", code)
+	}
+
+	return &Projection{
+		Code:     code,
+		toXY:     wgs84.Transform(wgs84.LonLat(), crs),
+		toLonLat: wgs84.Transform(crs, wgs84.LonLat()),
+	}, nil
+}
+
+// ParseProjection parses a projection from its EPSG code (e.g. "EPSG:32635" or "32635"), from
+// "mercator" for Web Mercator, or from a UTM zone (e.g. "UTM35N" or "utm 35s").
+func ParseProjection(s string) (*Projection, error) {
+	name := strings.ToLower(strings.Join(strings.Fields(s), ""))
+
+	switch {
+	case name == "" || name == "mercator" || name == "webmercator":
+		return NewProjection(WebMercatorCode)
+	case strings.HasPrefix(name, "utm"):
+		zoneStr := strings.TrimPrefix(name, "utm")
+		code := 32600
+
+		if strings.HasSuffix(zoneStr, "s") {
+			code = 32700
+		}
+
+		zone, err := strconv.Atoi(strings.TrimRight(zoneStr, "ns"))
+
+		if err != nil || zone < 1 || zone > 60 {
+			return nil, fmt.Errorf("invalid UTM zone: %s", s)
+		}
+
+		return NewProjection(code + zone)
+	}
+
+	code, err := strconv.Atoi(strings.TrimPrefix(name, "epsg:"))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid projection: %s", s)
+	}
+
+	return NewProjection(code)
+}
+
+// DefaultProjection returns Web Mercator.
+func DefaultProjection() *Projection {
+	projection, _ := NewProjection(WebMercatorCode)
+	return projection
+}
+
+// Project converts the point to the coordinates of the projection.
+func (proj *Projection) Project(p Point) (float64, float64) {
+	x, y, _ := proj.toXY(p.Lon, p.Lat, 0)
+	return x, y
+}
+
+// Unproject converts coordinates of the projection back to a point.
+func (proj *Projection) Unproject(x, y float64) Point {
+	lon, lat, _ := proj.toLonLat(x, y, 0)
+	return Point{Lat: lat, Lon: lon}
+}
+
+// Extent returns the projected rectangle that contains the bounding box.
+func (proj *Projection) Extent(b *BBox) (xmin, ymin, xmax, ymax float64) {
+	xmin, ymin = math.Inf(1), math.Inf(1)
+	xmax, ymax = math.Inf(-1), math.Inf(-1)
+
+	for _, p := range bboxOutline(b) {
+		x, y := proj.Project(p)
+		xmin, xmax = math.Min(xmin, x), math.Max(xmax, x)
+		ymin, ymax = math.Min(ymin, y), math.Max(ymax, y)
+	}
+
+	return
+}
+
+// BBox returns the bounding box of a projected rectangle.
+func (proj *Projection) BBox(xmin, ymin, xmax, ymax float64) *BBox {
+	bbox := &BBox{
+		SW: Point{Lat: math.Inf(1), Lon: math.Inf(1)},
+		NE: Point{Lat: math.Inf(-1), Lon: math.Inf(-1)},
+	}
+
+	for i := 0; i <= extentSamples; i++ {
+		t := float64(i) / extentSamples
+		x := xmin + (xmax-xmin)*t
+		y := ymin + (ymax-ymin)*t
+
+		for _, p := range []Point{
+			proj.Unproject(x, ymin),
+			proj.Unproject(x, ymax),
+			proj.Unproject(xmin, y),
+			proj.Unproject(xmax, y),
+		} {
+			bbox.SW.Lat = math.Min(bbox.SW.Lat, p.Lat)
+			bbox.SW.Lon = math.Min(bbox.SW.Lon, p.Lon)
+			bbox.NE.Lat = math.Max(bbox.NE.Lat, p.Lat)
+			bbox.NE.Lon = math.Max(bbox.NE.Lon, p.Lon)
+		}
+	}
+
+	return bbox
+}
+
+// bboxOutline returns points along all of the edges of the box.
+func bboxOutline(b *BBox) []Point {
+	points := make([]Point, 0, 4*(extentSamples+1))
+	east := b.SW.Lon + b.lonSpan()
+
+	for i := 0; i <= extentSamples; i++ {
+		t := float64(i) / extentSamples
+		lon := normalizeLon(b.SW.Lon + (east-b.SW.Lon)*t)
+		lat := b.SW.Lat + (b.NE.Lat-b.SW.Lat)*t
+
+		points = append(points,
+			Point{Lat: b.SW.Lat, Lon: lon},
+			Point{Lat: b.NE.Lat, Lon: lon},
+			Point{Lat: lat, Lon: b.SW.Lon},
+			Point{Lat: lat, Lon: b.NE.Lon},
+		)
+	}
+
+	return points
+}
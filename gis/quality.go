@@ -0,0 +1,310 @@
+package gis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+)
+
+// IssueKind is the kind of problem that a way or a relation of the OSM data has.
+type IssueKind string
+
+const (
+	// The way references nodes that aren't in the data, so they're left out of it.
+	IssueMissingNodes IssueKind = "missing_nodes"
+	// The outer ring of the multipolygon doesn't close, so the rest of it is left out.
+	IssueUnclosedMultipolygon IssueKind = "unclosed_multipolygon"
+	// A ring crosses itself.
+	IssueSelfIntersection IssueKind = "self_intersection"
+	// The way has the same node, or two nodes in the same place, one after the other.
+	IssueDuplicateNodes IssueKind = "duplicate_nodes"
+	// All of the nodes of the way are in the same place.
+	IssueZeroLength IssueKind = "zero_length"
+)
+
+// QualityIssue is a problem with a way or a relation, which is found when the data is loaded.
+type QualityIssue struct {
+	Kind IssueKind `json:"kind"`
+	// The type of the object, "way" or "relation", and its id.
+	Type osm.Type `json:"type"`
+	ID   int64    `json:"id"`
+	// The nodes that the issue is about, e.g. the ones that are missing.
+	NodeIDs []osm.NodeID `json:"node_ids,omitempty"`
+	// Where the issue is, or nil if none of the nodes could be found.
+	Location *Point `json:"location,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (issue QualityIssue) String() string {
+	if issue.Location == nil {
+		return fmt.Sprintf("%s %d: %s: %s", issue.Type, issue.ID, issue.Kind, issue.Message)
+	}
+
+	return fmt.Sprintf("%s %d at %f,%f: %s: %s", issue.Type, issue.ID, issue.Location.Lat, issue.Location.Lon, issue.Kind, issue.Message)
+}
+
+// QualityReport is the list of the problems of the loaded data, by the type and the id of the
+// objects.
+type QualityReport struct {
+	Issues []QualityIssue `json:"issues"`
+}
+
+// Count returns the number of issues of the kind.
+func (report *QualityReport) Count(kind IssueKind) int {
+	count := 0
+
+	for _, issue := range report.Issues {
+		if issue.Kind == kind {
+			count++
+		}
+	}
+
+	return count
+}
+
+// WriteJSON writes the report as a JSON document.
+func (report *QualityReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(report)
+}
+
+// WriteGeoJSON writes the issues as a feature collection of points, with the kind, the object and
+// the message of the issue as the properties. Issues without a location have no geometry.
+func (report *QualityReport) WriteGeoJSON(w io.Writer) error {
+	fc := geojson.NewFeatureCollection()
+
+	for _, issue := range report.Issues {
+		var geometry orb.Geometry
+
+		if issue.Location != nil {
+			geometry = orb.Point{issue.Location.Lon, issue.Location.Lat}
+		}
+
+		feature := geojson.NewFeature(geometry)
+		feature.Properties["kind"] = issue.Kind
+		feature.Properties["type"] = issue.Type
+		feature.Properties["id"] = issue.ID
+		feature.Properties["message"] = issue.Message
+
+		if len(issue.NodeIDs) > 0 {
+			feature.Properties["node_ids"] = issue.NodeIDs
+		}
+
+		fc.Append(feature)
+	}
+
+	data, err := json.MarshalIndent(fc, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// QualityReport returns the problems that were found while the data was loaded, like missing nodes
+// and multipolygons that don't close, along with the ones that are checked now: self-intersecting
+// rings, duplicate nodes and ways without a length.
+func (pbf *PBF) QualityReport() *QualityReport {
+	issues := append([]QualityIssue{}, pbf.issues...)
+
+	for _, way := range pbf.ways {
+		issues = append(issues, pbf.checkWay(way)...)
+	}
+
+	for _, relation := range pbf.relations {
+		for _, ring := range relation.Points {
+			if issue, ok := checkRing(ring); ok {
+				issue.Type = osm.TypeRelation
+				issue.ID = int64(relation.Way.ID)
+				issues = append(issues, issue)
+			}
+		}
+	}
+
+	// The ways come first, as they do in the data.
+	sort.SliceStable(issues, func(a, b int) bool {
+		if issues[a].Type != issues[b].Type {
+			return issues[a].Type > issues[b].Type
+		}
+
+		return issues[a].ID < issues[b].ID
+	})
+
+	return &QualityReport{Issues: issues}
+}
+
+// addIssue records a problem that's found while an object is built.
+func (pbf *PBF) addIssue(issue QualityIssue) {
+	pbf.issues = append(pbf.issues, issue)
+}
+
+// checkWay finds the duplicate nodes of the way, whether it has no length and whether it crosses
+// itself, if it's closed.
+func (pbf *PBF) checkWay(way *RichWay) []QualityIssue {
+	issues := make([]QualityIssue, 0)
+	duplicates := make([]osm.NodeID, 0)
+	var location *Point
+	var first *Point
+	zeroLength := true
+
+	for i, nodeID := range way.NodeIDs {
+		point := pbf.pointFromNodeID(nodeID)
+
+		if point == nil {
+			continue
+		} else if first == nil {
+			first = point
+		} else if *point != *first {
+			zeroLength = false
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		previous := pbf.pointFromNodeID(way.NodeIDs[i-1])
+
+		if nodeID == way.NodeIDs[i-1] || (previous != nil && *previous == *point) {
+			duplicates = append(duplicates, nodeID)
+
+			if location == nil {
+				location = point
+			}
+		}
+	}
+
+	if len(duplicates) == 1 {
+		issues = append(issues, QualityIssue{
+			Kind:     IssueDuplicateNodes,
+			NodeIDs:  duplicates,
+			Location: location,
+			Message:  "a node repeats the one before it",
+		})
+	} else if len(duplicates) > 1 {
+		issues = append(issues, QualityIssue{
+			Kind:     IssueDuplicateNodes,
+			NodeIDs:  duplicates,
+			Location: location,
+			Message:  fmt.Sprintf("%d nodes repeat the ones before them", len(duplicates)),
+		})
+	}
+
+	if first != nil && zeroLength {
+		issues = append(issues, QualityIssue{
+			Kind:     IssueZeroLength,
+			Location: first,
+			Message:  fmt.Sprintf("all of its %d nodes are in the same place", len(way.NodeIDs)),
+		})
+	} else if len(way.NodeIDs) > 3 && way.NodeIDs[0] == way.NodeIDs[len(way.NodeIDs)-1] {
+		if issue, ok := checkRing(way.Points[0]); ok {
+			issues = append(issues, issue)
+		}
+	}
+
+	for i := range issues {
+		issues[i].Type = osm.TypeWay
+		issues[i].ID = int64(way.Way.ID)
+	}
+
+	return issues
+}
+
+// checkRing returns the first place where the ring crosses or overlaps itself, if it's closed.
+// Rings that only touch themselves at a point aren't reported. The segments are sorted by their
+// western ends, so that only the ones that overlap from west to east are compared.
+func checkRing(ring []Point) (QualityIssue, bool) {
+	if len(ring) < 4 || ring[0] != ring[len(ring)-1] {
+		return QualityIssue{}, false
+	}
+
+	segments := make([]int, len(ring)-1)
+
+	for i := range segments {
+		segments[i] = i
+	}
+
+	west := func(i int) float64 { return min(ring[i].Lon, ring[i+1].Lon) }
+	east := func(i int) float64 { return max(ring[i].Lon, ring[i+1].Lon) }
+
+	sort.Slice(segments, func(a, b int) bool {
+		return west(segments[a]) < west(segments[b])
+	})
+
+	for a, i := range segments {
+		for _, j := range segments[a+1:] {
+			if west(j) > east(i) {
+				break
+			}
+
+			if location, ok := segmentIntersection(ring[i], ring[i+1], ring[j], ring[j+1]); ok {
+				return QualityIssue{
+					Kind:     IssueSelfIntersection,
+					Location: &location,
+					Message:  "the ring crosses itself",
+				}, true
+			} else if location, ok := segmentOverlap(ring[i], ring[i+1], ring[j], ring[j+1]); ok {
+				return QualityIssue{
+					Kind:     IssueSelfIntersection,
+					Location: &location,
+					Message:  "the ring overlaps itself",
+				}, true
+			}
+		}
+	}
+
+	return QualityIssue{}, false
+}
+
+// segmentIntersection returns where the segments ab and cd cross each other, if they do.
+func segmentIntersection(a, b, c, d Point) (Point, bool) {
+	denominator := (b.Lon-a.Lon)*(d.Lat-c.Lat) - (b.Lat-a.Lat)*(d.Lon-c.Lon)
+
+	// Parallel segments can only overlap, which segmentOverlap finds.
+	if denominator == 0 || !segmentsIntersect(a, b, c, d) {
+		return Point{}, false
+	}
+
+	t := ((c.Lon-a.Lon)*(d.Lat-c.Lat) - (c.Lat-a.Lat)*(d.Lon-c.Lon)) / denominator
+
+	return Point{Lat: a.Lat + t*(b.Lat-a.Lat), Lon: a.Lon + t*(b.Lon-a.Lon)}, true
+}
+
+// segmentOverlap returns where the segments ab and cd start to overlap, if they're on the same line
+// and share more than a point.
+func segmentOverlap(a, b, c, d Point) (Point, bool) {
+	if a == b || orientation(a, b, c) != 0 || orientation(a, b, d) != 0 {
+		return Point{}, false
+	}
+
+	// The segments are compared along whichever axis the line changes the most in.
+	axis := func(p Point) float64 { return p.Lon }
+
+	if math.Abs(b.Lat-a.Lat) > math.Abs(b.Lon-a.Lon) {
+		axis = func(p Point) float64 { return p.Lat }
+	}
+
+	start := max(min(axis(a), axis(b)), min(axis(c), axis(d)))
+	end := min(max(axis(a), axis(b)), max(axis(c), axis(d)))
+
+	if start >= end {
+		return Point{}, false
+	}
+
+	for _, p := range []Point{a, b, c, d} {
+		if axis(p) == start {
+			return p, true
+		}
+	}
+
+	return Point{}, false
+}
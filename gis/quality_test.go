@@ -0,0 +1,207 @@
+package gis
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func TestQualityReport(t *testing.T) {
+	tests := []struct {
+		name string
+		// The elements of the document, which is wrapped in <osm>.
+		elements string
+		want     []QualityIssue
+	}{
+		{
+			name: "square",
+			elements: `
+				<node id="1" lat="0" lon="0"/><node id="2" lat="0" lon="1"/>
+				<node id="3" lat="1" lon="1"/><node id="4" lat="1" lon="0"/>
+				<way id="10"><nd ref="1"/><nd ref="2"/><nd ref="3"/><nd ref="4"/><nd ref="1"/></way>`,
+			want: []QualityIssue{},
+		},
+		{
+			name: "figure-8",
+			elements: `
+				<node id="1" lat="0" lon="0"/><node id="2" lat="1" lon="1"/>
+				<node id="3" lat="0" lon="1"/><node id="4" lat="1" lon="0"/>
+				<way id="10"><nd ref="1"/><nd ref="2"/><nd ref="3"/><nd ref="4"/><nd ref="1"/></way>`,
+			want: []QualityIssue{
+				{Kind: IssueSelfIntersection, Type: osm.TypeWay, ID: 10, Location: &Point{Lat: 0.5, Lon: 0.5}},
+			},
+		},
+		{
+			name: "touching at a shared vertex",
+			elements: `
+				<node id="1" lat="0" lon="0"/><node id="2" lat="2" lon="0"/>
+				<node id="3" lat="1" lon="1"/><node id="4" lat="2" lon="2"/>
+				<node id="5" lat="0" lon="2"/>
+				<way id="10"><nd ref="1"/><nd ref="2"/><nd ref="3"/><nd ref="4"/><nd ref="5"/><nd ref="3"/><nd ref="1"/></way>`,
+			want: []QualityIssue{},
+		},
+		{
+			name: "collinear overlap",
+			elements: `
+				<node id="1" lat="0" lon="0"/><node id="2" lat="0" lon="3"/>
+				<node id="3" lat="1" lon="3"/><node id="4" lat="1" lon="2"/>
+				<node id="5" lat="0" lon="2"/><node id="6" lat="0" lon="1"/>
+				<node id="7" lat="-1" lon="1"/><node id="8" lat="-1" lon="0"/>
+				<way id="10"><nd ref="1"/><nd ref="2"/><nd ref="3"/><nd ref="4"/><nd ref="5"/><nd ref="6"/><nd ref="7"/><nd ref="8"/><nd ref="1"/></way>`,
+			want: []QualityIssue{
+				{Kind: IssueSelfIntersection, Type: osm.TypeWay, ID: 10, Location: &Point{Lat: 0, Lon: 1}},
+			},
+		},
+		{
+			name: "spike",
+			elements: `
+				<node id="1" lat="0" lon="0"/><node id="2" lat="0" lon="2"/>
+				<node id="3" lat="0" lon="1"/><node id="4" lat="1" lon="1"/>
+				<way id="10"><nd ref="1"/><nd ref="2"/><nd ref="3"/><nd ref="4"/><nd ref="1"/></way>`,
+			want: []QualityIssue{
+				{Kind: IssueSelfIntersection, Type: osm.TypeWay, ID: 10, Location: &Point{Lat: 0, Lon: 1}},
+			},
+		},
+		{
+			name: "straight line through the closing node",
+			elements: `
+				<node id="1" lat="0" lon="0"/><node id="2" lat="0" lon="1"/>
+				<node id="3" lat="0" lon="2"/><node id="4" lat="1" lon="1"/>
+				<way id="10"><nd ref="1"/><nd ref="2"/><nd ref="3"/><nd ref="4"/><nd ref="1"/></way>`,
+			want: []QualityIssue{},
+		},
+		{
+			name: "duplicate nodes",
+			elements: `
+				<node id="1" lat="0" lon="0"/><node id="2" lat="0" lon="1"/>
+				<node id="3" lat="0" lon="1"/><node id="4" lat="1" lon="1"/>
+				<way id="10"><nd ref="1"/><nd ref="1"/><nd ref="2"/><nd ref="3"/><nd ref="4"/></way>`,
+			want: []QualityIssue{
+				{Kind: IssueDuplicateNodes, Type: osm.TypeWay, ID: 10, NodeIDs: []osm.NodeID{1, 3}, Location: &Point{Lat: 0, Lon: 0}},
+			},
+		},
+		{
+			name: "zero length",
+			elements: `
+				<node id="1" lat="1" lon="2"/><node id="2" lat="1" lon="2"/>
+				<way id="10"><nd ref="1"/><nd ref="2"/></way>
+				<way id="11"><nd ref="1"/></way>`,
+			want: []QualityIssue{
+				{Kind: IssueDuplicateNodes, Type: osm.TypeWay, ID: 10, NodeIDs: []osm.NodeID{2}, Location: &Point{Lat: 1, Lon: 2}},
+				{Kind: IssueZeroLength, Type: osm.TypeWay, ID: 10, Location: &Point{Lat: 1, Lon: 2}},
+				{Kind: IssueZeroLength, Type: osm.TypeWay, ID: 11, Location: &Point{Lat: 1, Lon: 2}},
+			},
+		},
+		{
+			name: "missing nodes",
+			elements: `
+				<node id="1" lat="0" lon="0"/><node id="2" lat="0" lon="1"/>
+				<way id="10"><nd ref="1"/><nd ref="99"/><nd ref="2"/></way>
+				<way id="11"><nd ref="98"/></way>`,
+			want: []QualityIssue{
+				{Kind: IssueMissingNodes, Type: osm.TypeWay, ID: 10, NodeIDs: []osm.NodeID{99}, Location: &Point{Lat: 0, Lon: 0}},
+				{Kind: IssueMissingNodes, Type: osm.TypeWay, ID: 11, NodeIDs: []osm.NodeID{98}},
+			},
+		},
+		{
+			name: "closed multipolygon",
+			elements: `
+				<node id="1" lat="0" lon="0"/><node id="2" lat="0" lon="1"/>
+				<node id="3" lat="1" lon="1"/>
+				<way id="10"><nd ref="1"/><nd ref="2"/></way>
+				<way id="11"><nd ref="2"/><nd ref="3"/><nd ref="1"/></way>
+				<relation id="20">
+					<member type="way" ref="10" role="outer"/><member type="way" ref="11" role="outer"/>
+					<tag k="type" v="multipolygon"/>
+				</relation>`,
+			want: []QualityIssue{},
+		},
+		{
+			name: "unclosed multipolygon",
+			elements: `
+				<node id="1" lat="0" lon="0"/><node id="2" lat="0" lon="1"/>
+				<node id="3" lat="1" lon="1"/>
+				<way id="10"><nd ref="1"/><nd ref="2"/><nd ref="3"/></way>
+				<relation id="20">
+					<member type="way" ref="10" role="outer"/><member type="way" ref="11" role="outer"/>
+					<tag k="type" v="multipolygon"/>
+				</relation>`,
+			want: []QualityIssue{
+				{Kind: IssueUnclosedMultipolygon, Type: osm.TypeRelation, ID: 20, Location: &Point{Lat: 1, Lon: 1}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pbf := loadXML(t, fmt.Sprintf(`<osm version="0.6">%s</osm>`, test.elements))
+			issues := pbf.QualityReport().Issues
+
+			if len(issues) != len(test.want) {
+				t.Fatalf("got the issues %v, want %d", issues, len(test.want))
+			}
+
+			for i, issue := range issues {
+				want := test.want[i]
+
+				if issue.Kind != want.Kind || issue.Type != want.Type || issue.ID != want.ID ||
+					fmt.Sprint(issue.NodeIDs) != fmt.Sprint(want.NodeIDs) ||
+					fmt.Sprint(issue.Location) != fmt.Sprint(want.Location) {
+					t.Errorf("got the issue %+v, want %+v", issue, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSegmentIntersection(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b, c, d Point
+		want       Point
+		ok         bool
+	}{
+		{"crossing", Point{0, 0}, Point{2, 2}, Point{0, 2}, Point{2, 0}, Point{1, 1}, true},
+		{"parallel", Point{0, 0}, Point{0, 2}, Point{1, 0}, Point{1, 2}, Point{}, false},
+		{"collinear", Point{0, 0}, Point{0, 2}, Point{0, 1}, Point{0, 3}, Point{}, false},
+		{"sharing an end", Point{0, 0}, Point{1, 1}, Point{1, 1}, Point{2, 0}, Point{}, false},
+		{"apart", Point{0, 0}, Point{1, 1}, Point{3, 0}, Point{2, 1}, Point{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := segmentIntersection(test.a, test.b, test.c, test.d)
+
+			if ok != test.ok || got != test.want {
+				t.Errorf("got %v, %t, want %v, %t", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestSegmentOverlap(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b, c, d Point
+		want       Point
+		ok         bool
+	}{
+		{"overlapping", Point{0, 0}, Point{0, 2}, Point{0, 3}, Point{0, 1}, Point{0, 1}, true},
+		{"nested vertically", Point{0, 5}, Point{4, 5}, Point{1, 5}, Point{2, 5}, Point{1, 5}, true},
+		{"touching at an end", Point{0, 0}, Point{0, 1}, Point{0, 1}, Point{0, 2}, Point{}, false},
+		{"collinear apart", Point{0, 0}, Point{0, 1}, Point{0, 2}, Point{0, 3}, Point{}, false},
+		{"parallel", Point{0, 0}, Point{0, 2}, Point{1, 0}, Point{1, 2}, Point{}, false},
+		{"zero length", Point{0, 0}, Point{0, 0}, Point{0, 0}, Point{0, 1}, Point{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := segmentOverlap(test.a, test.b, test.c, test.d)
+
+			if ok != test.ok || got != test.want {
+				t.Errorf("got %v, %t, want %v, %t", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
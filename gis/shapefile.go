@@ -1,15 +1,23 @@
 package gis
 
 import (
+	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/jonas-p/go-shp"
 )
 
 type Shapefile struct {
 	Filename string
+	// Progress is told how many of the polygons have been clipped or iterated over, if it's set.
+	Progress Progress
 	reader   *shp.Reader
 	polygons []*ShapePolygon
+	// The shapes that were read into memory by ReadAll, which can be clipped any number of times.
+	shapes []*shp.Polygon
 }
 
 func (shapefile *Shapefile) Load() error {
@@ -24,93 +32,159 @@ func (shapefile *Shapefile) Load() error {
 	return nil
 }
 
-func (shapefile *Shapefile) Clip(bbox *BBox) ([]*ShapePolygon, error) {
+// Close closes the shapefile, which can't be read any more afterwards, except from what ReadAll read
+// into memory.
+func (shapefile *Shapefile) Close() error {
 	if shapefile.reader == nil {
-		return nil, errors.New("no shapefile was loaded")
+		return nil
 	}
 
-	shapefile.polygons = make([]*ShapePolygon, 0)
-	// convert := wgs84.LonLat().To(wgs84.WebMercator())
+	err := shapefile.reader.Close()
+	shapefile.reader = nil
 
-	for shapefile.reader.Next() {
-		_, p := shapefile.reader.Shape()
+	return err
+}
 
-		var intermediate interface{} = p
-		polygon := intermediate.(*shp.Polygon)
+// ReadAll reads all of the shapes of the loaded shapefile into memory and closes it, so that it can
+// be clipped to many areas, like tiles, without reading it again every time.
+func (shapefile *Shapefile) ReadAll() error {
+	return shapefile.ReadAllContext(context.Background())
+}
 
-		points := make([]Point, 0)
-		insideBBox := false
+// ReadAllContext is ReadAll, which stops with the error of the context when it's cancelled.
+func (shapefile *Shapefile) ReadAllContext(ctx context.Context) error {
+	shapes := make([]*shp.Polygon, 0)
+	err := shapefile.IterContext(ctx, func(_ int, polygon *shp.Polygon) error {
+		shapes = append(shapes, polygon)
+		return nil
+	})
 
-		for i, point := range polygon.Points {
-			var lat, lon, xmin, ymin, xmax, ymax float64
-			// var lon float64
+	if err != nil {
+		return err
+	}
 
-			lat = point.Y
-			lon = point.X
+	shapefile.shapes = shapes
 
-			xmin = bbox.SW.Lon
-			ymin = bbox.SW.Lat
-			xmax = bbox.NE.Lon
-			ymax = bbox.NE.Lat
+	return shapefile.Close()
+}
 
-			// lon, lat, _ = wgs84.WebMercator().To(wgs84.LonLat())(point.X, point.Y, 0)
-			// fmt.Println(point.X, point.Y, lat, lon)
+// Clip returns the polygons of the shapefile that have at least one point inside the area, that cross
+// its edge, or that surround it. Their points are clamped to the bounding box of the area.
+func (shapefile *Shapefile) Clip(area Area) ([]*ShapePolygon, error) {
+	return shapefile.ClipContext(context.Background(), area)
+}
 
-			// xmin, ymin, _ := convert(bbox.SW.Lon, bbox.SW.Lat, 0)
-			// xmax, ymax, _ := convert(bbox.NE.Lon, bbox.NE.Lat, 0)
+// ClipContext is Clip, which stops with the error of the context when it's cancelled. The shapes
+// are read from the file, unless ReadAll read them into memory already.
+func (shapefile *Shapefile) ClipContext(ctx context.Context, area Area) ([]*ShapePolygon, error) {
+	bbox := area.Bounds()
+	polygons := make([]*ShapePolygon, 0)
+	clip := func(_ int, polygon *shp.Polygon) error {
+		if newPolygon := clipShape(polygon, area, bbox); newPolygon != nil {
+			polygons = append(polygons, newPolygon)
+		}
 
-			if lon >= bbox.SW.Lon && lon <= bbox.NE.Lon && lat <= bbox.NE.Lat && lat >= bbox.SW.Lat {
-				insideBBox = true
-			}
+		return nil
+	}
 
-			if point.X < xmin {
-				point.X = xmin
-			} else if point.X > xmax {
-				point.X = xmax
+	if shapefile.shapes != nil {
+		for i, polygon := range shapefile.shapes {
+			if err := shapefile.checkProgress(ctx, "land", i, len(shapefile.shapes)); err != nil {
+				return nil, err
 			}
 
-			if point.Y < ymin {
-				point.Y = ymin
-			} else if point.Y > ymax {
-				point.Y = ymax
-			}
+			clip(i, polygon)
+		}
+	} else if err := shapefile.IterContext(ctx, clip); err != nil {
+		return nil, err
+	}
 
-			if lon < bbox.SW.Lon {
-				lon = bbox.SW.Lon
-			} else if lon > bbox.NE.Lon {
-				lon = bbox.NE.Lon
-			}
+	shapefile.polygons = polygons
 
-			if lat < bbox.SW.Lat {
-				lat = bbox.SW.Lat
-			} else if lat > bbox.NE.Lat {
-				lat = bbox.NE.Lat
-			}
+	return polygons, nil
+}
+
+// clipShape returns the polygon if it has at least one point inside the area, crosses its edge or
+// surrounds it, with its points clamped to the bounding box of the area, and nil otherwise. The
+// shape is copied, so that it can be clipped again.
+func clipShape(polygon *shp.Polygon, area Area, bbox *BBox) *ShapePolygon {
+	clipped := *polygon
+	clipped.Points = make([]shp.Point, len(polygon.Points))
+	points := make([]Point, 0, len(polygon.Points))
+	originals := make([]Point, 0, len(polygon.Points))
+
+	for i, point := range polygon.Points {
+		original := Point{Lat: point.Y, Lon: point.X}
+		originals = append(originals, original)
+
+		clamped := bbox.Clamp(original)
+		points = append(points, clamped)
+		clipped.Points[i] = shp.Point{X: clamped.Lon, Y: clamped.Lat}
+	}
 
-			points = append(points, Point{Lat: lat, Lon: lon})
-			polygon.Points[i] = point
+	// A ring that neither has a point inside the area nor crosses its edge can still cover the
+	// whole area, like when a large piece of land surrounds a small area.
+	vertex := areaVertex(area)
+	intersects := false
+
+	for _, ring := range shapeRings(polygon, originals) {
+		if lineIntersectsArea(ring, area) || ringContainsPoint(ring, vertex) {
+			intersects = true
+			break
 		}
+	}
 
-		if insideBBox {
-			newPolygon := &ShapePolygon{
-				Points: points,
-				Raw:    p,
-			}
+	if !intersects {
+		return nil
+	}
 
-			shapefile.polygons = append(shapefile.polygons, newPolygon)
+	return &ShapePolygon{
+		Points: points,
+		Raw:    &clipped,
+	}
+}
+
+// shapeRings splits the points of the shape into its parts, which are closed rings.
+func shapeRings(polygon *shp.Polygon, points []Point) [][]Point {
+	rings := make([][]Point, 0, len(polygon.Parts))
+
+	for i, start := range polygon.Parts {
+		end := len(points)
+
+		if i+1 < len(polygon.Parts) {
+			end = int(polygon.Parts[i+1])
 		}
+
+		if int(start) < end && end <= len(points) {
+			rings = append(rings, points[start:end])
+		}
+	}
+
+	if len(rings) == 0 {
+		rings = append(rings, points)
 	}
 
-	return shapefile.polygons, nil
+	return rings
 }
 
 func (shapefile *Shapefile) Iter(callback func(int, *shp.Polygon) error) error {
+	return shapefile.IterContext(context.Background(), callback)
+}
+
+// IterContext is Iter, which stops with the error of the context when it's cancelled.
+func (shapefile *Shapefile) IterContext(ctx context.Context, callback func(int, *shp.Polygon) error) error {
 	if shapefile.reader == nil {
 		return errors.New("no shapefile was loaded")
 	}
 
+	total := shapefile.shapeCount()
+
 	for shapefile.reader.Next() {
 		i, p := shapefile.reader.Shape()
+
+		if err := shapefile.checkProgress(ctx, "land", i, total); err != nil {
+			return err
+		}
 		var intermediate interface{} = p
 		polygon := intermediate.(*shp.Polygon)
 
@@ -122,6 +196,33 @@ func (shapefile *Shapefile) Iter(callback func(int, *shp.Polygon) error) error {
 	return nil
 }
 
+// checkProgress returns the error of the context if it was cancelled, and otherwise reports the
+// progress every now and then, before the shape with the index is processed.
+func (shapefile *Shapefile) checkProgress(ctx context.Context, stage string, i, total int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if shapefile.Progress != nil && (i%100 == 0 || i == total-1) {
+		shapefile.Progress.FeaturesProcessed(stage, i+1, total)
+	}
+
+	return nil
+}
+
+// shapeCount returns the number of shapes in the shapefile from the size of its index, which has a
+// 100 byte header and 8 bytes for every shape, or 0 if there's no index.
+func (shapefile *Shapefile) shapeCount() int {
+	ext := filepath.Ext(shapefile.Filename)
+	info, err := os.Stat(strings.TrimSuffix(shapefile.Filename, ext) + ".shx")
+
+	if err != nil || info.Size() < 100 {
+		return 0
+	}
+
+	return int(info.Size()-100) / 8
+}
+
 // GetPolygons just retruns the list of polygons that were captured from a shapefile.
 func (shapefile *Shapefile) GetPolygons() []*ShapePolygon {
 	return shapefile.polygons
@@ -0,0 +1,132 @@
+package gis
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/wisepythagoras/gis-utils/config"
+)
+
+// Tile is a slippy map tile.
+type Tile struct {
+	X uint32
+	Y uint32
+	Z uint32
+}
+
+// BBox returns the bounding box of the tile.
+func (t Tile) BBox() *BBox {
+	return GetTileBBox(t.X, t.Y, t.Z)
+}
+
+// NewImage returns an initialized image of the tile, which is TileSize pixels wide and high.
+func (t Tile) NewImage(conf *config.Config) (*Image, error) {
+	zoom := float64(t.Z)
+	img := &Image{
+		BBox:   t.BBox(),
+		Width:  TileSize,
+		Height: TileSize,
+		Zoom:   &zoom,
+		Config: conf,
+	}
+
+	if err := img.Init(); err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+func (t Tile) String() string {
+	return fmt.Sprintf("%d/%d/%d", t.Z, t.X, t.Y)
+}
+
+// Lon2Tile returns the x coordinate of the tile that contains the longitude.
+func Lon2Tile(lon float64, z uint32) uint32 {
+	n := math.Pow(2.0, float64(z))
+	x := math.Floor((lon + 180.0) / 360.0 * n)
+
+	return uint32(math.Max(0, math.Min(n-1, x)))
+}
+
+// Lat2Tile returns the y coordinate of the tile that contains the latitude.
+func Lat2Tile(lat float64, z uint32) uint32 {
+	n := math.Pow(2.0, float64(z))
+	rad := lat * math.Pi / 180.0
+	y := math.Floor((1.0 - math.Log(math.Tan(rad)+1.0/math.Cos(rad))/math.Pi) / 2.0 * n)
+
+	return uint32(math.Max(0, math.Min(n-1, y)))
+}
+
+// TilesInArea returns all of the tiles of the zoom level that intersect the area.
+func TilesInArea(area Area, z uint32) []Tile {
+	bounds := area.Bounds()
+	tiles := make([]Tile, 0)
+
+	minX := Lon2Tile(bounds.SW.Lon, z)
+	maxX := Lon2Tile(bounds.NE.Lon, z)
+	minY := Lat2Tile(bounds.NE.Lat, z)
+	maxY := Lat2Tile(bounds.SW.Lat, z)
+
+	// Tiles that only touch the east or south edge of the area aren't part of it.
+	if maxX != minX && maxX > 0 && Tile2Lon(maxX, z) == bounds.NE.Lon {
+		maxX--
+	}
+
+	if maxY > minY && Tile2Lat(maxY, z) == bounds.SW.Lat {
+		maxY--
+	}
+
+	// Areas that cross the antimeridian wrap around to the first column of tiles. If they start and
+	// end in the same column, they wrap around the whole globe.
+	columns := make([]uint32, 0)
+
+	if bounds.CrossesAntimeridian() && minX == maxX {
+		for i := uint32(0); i < 1<<z; i++ {
+			columns = append(columns, (minX+i)%(1<<z))
+		}
+	} else {
+		for x := minX; x != maxX; x = (x + 1) % (1 << z) {
+			columns = append(columns, x)
+		}
+
+		columns = append(columns, maxX)
+	}
+
+	for _, x := range columns {
+		for y := minY; y <= maxY; y++ {
+			tile := Tile{X: x, Y: y, Z: z}
+
+			if area.IntersectsBBox(tile.BBox()) {
+				tiles = append(tiles, tile)
+			}
+		}
+	}
+
+	return tiles
+}
+
+// The size of a slippy map tile in pixels.
+const TileSize = 256
+
+// BBoxFromCenter returns the area that a slippy map at the zoom level shows around the center, when
+// the map is width by height pixels large.
+func BBoxFromCenter(center Point, zoom, width, height float64) *BBox {
+	worldSize := TileSize * math.Pow(2, zoom)
+	rad := center.Lat * math.Pi / 180
+	x := (center.Lon + 180) / 360 * worldSize
+	y := (1 - math.Log(math.Tan(rad)+1/math.Cos(rad))/math.Pi) / 2 * worldSize
+
+	toLon := func(x float64) float64 {
+		return normalizeLon(x/worldSize*360 - 180)
+	}
+
+	toLat := func(y float64) float64 {
+		return math.Atan(math.Sinh(math.Pi*(1-2*y/worldSize))) * 180 / math.Pi
+	}
+
+	return &BBox{
+		SW: Point{Lat: toLat(y + height/2), Lon: toLon(x - width/2)},
+		NE: Point{Lat: toLat(y - height/2), Lon: toLon(x + width/2)},
+	}
+}
@@ -0,0 +1,56 @@
+package gis
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestTilesInArea(t *testing.T) {
+	tests := []struct {
+		name    string
+		area    Area
+		z       uint32
+		columns []uint32
+		rows    int
+	}{
+		{"one tile", box(1, 1, 2, 2), 1, []uint32{1}, 1},
+		{"touching the east edge of a column", box(-90, 1, 0, 2), 1, []uint32{0}, 1},
+		{"across the equator", box(-1, -1, 1, 1), 1, []uint32{0, 1}, 2},
+		{"crossing the antimeridian", box(170, 1, -170, 2), 3, []uint32{0, 7}, 1},
+		// The box starts and ends in the same column, so it goes around the whole globe.
+		{"around the globe", box(170.1, 1, 170, 2), 3, []uint32{0, 1, 2, 3, 4, 5, 6, 7}, 1},
+	}
+
+	for _, test := range tests {
+		tiles := TilesInArea(test.area, test.z)
+		columns := make(map[uint32]int)
+
+		for _, tile := range tiles {
+			columns[tile.X]++
+		}
+
+		got := make([]uint32, 0, len(columns))
+
+		for x, rows := range columns {
+			got = append(got, x)
+
+			if rows != test.rows {
+				t.Errorf("%s: got %d rows in the column %d, want %d", test.name, rows, x, test.rows)
+			}
+		}
+
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+
+		if len(got) != len(test.columns) {
+			t.Errorf("%s: got the columns %v, want %v", test.name, got, test.columns)
+			continue
+		}
+
+		for i := range got {
+			if got[i] != test.columns[i] {
+				t.Errorf("%s: got the columns %v, want %v", test.name, got, test.columns)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//go:build cgo
+
+package gis
+
+import (
+	"io"
+
+	"github.com/chai2010/webp"
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/rasterizer"
+)
+
+// WebP images can be written, since this build has cgo.
+var errWebPUnavailable error
+
+// webpWriter returns the writer of the WebP formats. The canvas package doesn't come with a WebP
+// encoder, so the canvas is rasterized and encoded with libwebp, which needs cgo.
+func webpWriter(resolution canvas.Resolution, quality int, lossless bool) (canvas.Writer, error) {
+	options := &webp.Options{Quality: float32(quality), Lossless: lossless}
+
+	return func(w io.Writer, c *canvas.Canvas) error {
+		return webp.Encode(w, rasterizer.Draw(c, resolution, canvas.DefaultColorSpace), options)
+	}, nil
+}
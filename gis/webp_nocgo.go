@@ -0,0 +1,17 @@
+//go:build !cgo
+
+package gis
+
+import (
+	"errors"
+
+	"github.com/tdewolff/canvas"
+)
+
+// The WebP encoder is libwebp, so WebP images can only be written by builds with cgo. The other
+// formats don't need it, so the commands can still be built statically.
+var errWebPUnavailable = errors.New("WebP images can't be written by this build, since it was built without cgo (CGO_ENABLED=0)")
+
+func webpWriter(resolution canvas.Resolution, quality int, lossless bool) (canvas.Writer, error) {
+	return nil, errWebPUnavailable
+}
@@ -3,13 +3,18 @@ module github.com/wisepythagoras/gis-utils
 go 1.22.0
 
 require (
+	github.com/chai2010/webp v1.4.0
 	github.com/jonas-p/go-shp v0.1.1
+	github.com/paulmach/orb v0.11.1
 	github.com/paulmach/osm v0.8.0
 	github.com/samber/lo v1.39.0
 	github.com/tdewolff/canvas v0.0.0-20240502214346-a72e4acc2272
 	github.com/tidwall/buntdb v1.2.9
+	github.com/tomchavakis/geojson v0.0.3
 	github.com/wroge/wgs84 v1.1.7
-	gopkg.in/yaml.v2 v2.4.0
+	golang.org/x/image v0.15.0
+	google.golang.org/protobuf v1.28.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -28,7 +33,6 @@ require (
 	github.com/go-text/typesetting v0.1.1 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
-	github.com/paulmach/orb v0.11.1 // indirect
 	github.com/paulmach/protoscan v0.2.1 // indirect
 	github.com/tdewolff/font v0.0.0-20240502124818-41eff0ab0cd8 // indirect
 	github.com/tdewolff/minify/v2 v2.20.20 // indirect
@@ -40,16 +44,13 @@ require (
 	github.com/tidwall/pretty v1.2.0 // indirect
 	github.com/tidwall/rtred v0.1.2 // indirect
 	github.com/tidwall/tinyqueue v0.1.1 // indirect
-	github.com/tomchavakis/geojson v0.0.3 // indirect
 	github.com/wcharczuk/go-chart/v2 v2.1.1 // indirect
 	go.mongodb.org/mongo-driver v1.15.0 // indirect
 	golang.org/x/exp v0.0.0-20240416160154-fe59bbe5cc7f // indirect
-	golang.org/x/image v0.15.0 // indirect
 	golang.org/x/net v0.24.0 // indirect
 	golang.org/x/sys v0.19.0 // indirect
 	golang.org/x/text v0.15.0 // indirect
 	golang.org/x/tools v0.20.0 // indirect
 	gonum.org/v1/plot v0.14.0 // indirect
-	google.golang.org/protobuf v1.28.0 // indirect
 	star-tex.org/x/tex v0.4.0 // indirect
 )